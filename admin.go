@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"project.com/myproject/auth"
+	"project.com/myproject/config"
+	m "project.com/myproject/models"
+	s "project.com/myproject/stores"
+)
+
+// bootstrapAdmin creates the admin user configured in auth.admin_username,
+// unless a user with that name already exists. Registration only ever grants
+// the customer role, so this is how the first admin gets in.
+func bootstrapAdmin(ctx context.Context, users s.UserStore, cfg config.AuthConfig) error {
+	if cfg.AdminUsername == "" {
+		return nil
+	}
+
+	existing, err := users.GetUserByUsername(ctx, cfg.AdminUsername)
+	if err == nil {
+		// An existing user is never changed, so a name registered through the
+		// API cannot be turned into an admin by configuration
+		if !slices.Contains(existing.Roles, auth.RoleAdmin) {
+			slog.Warn("configured admin user exists without the admin role", "username", existing.Username)
+		}
+		return nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	hash, err := auth.NewPasswordHasher(12).Hash(cfg.AdminPassword)
+	if err != nil {
+		return err
+	}
+	user, err := users.CreateUser(ctx, m.User{
+		Username:     cfg.AdminUsername,
+		Email:        cfg.AdminEmail,
+		PasswordHash: hash,
+		Roles:        []string{auth.RoleAdmin},
+	})
+	if errors.Is(err, s.ErrUserExists) {
+		// Another instance starting at the same time may have created it
+		if _, lookupErr := users.GetUserByUsername(ctx, cfg.AdminUsername); lookupErr == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("created admin user", "username", user.Username)
+	return nil
+}
@@ -2,45 +2,96 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
 type JWTManager struct {
-	secretKey     string
+	keys          *KeySet
 	tokenDuration time.Duration
 }
 
 type Claims struct {
-	Username string `json:"username"`
+	Username   string   `json:"username"`
+	Roles      []string `json:"roles,omitempty"`
+	CustomerID int      `json:"customer_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Identity describes the user a token is issued for.
+type Identity struct {
+	Username   string
+	Roles      []string
+	CustomerID int
+}
+
+// NewJWTManager signs tokens with a shared HS256 secret.
 func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
+	return NewJWTManagerWithKeys(NewHMACKeySet(secretKey), tokenDuration)
+}
+
+// NewJWTManagerWithKeys signs tokens with the active key of keys and accepts
+// any key still in the set.
+func NewJWTManagerWithKeys(keys *KeySet, tokenDuration time.Duration) *JWTManager {
 	return &JWTManager{
-		secretKey:     secretKey,
+		keys:          keys,
 		tokenDuration: tokenDuration,
 	}
 }
 
-func (j *JWTManager) Generate(username string) (string, error) {
+func (j *JWTManager) Generate(identity Identity) (string, error) {
+	key, err := j.keys.Active()
+	if err != nil {
+		return "", err
+	}
+
+	jti, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
 	now := time.Now()
 	claims := &Claims{
-		Username: username,
+		Username:   identity.Username,
+		Roles:      identity.Roles,
+		CustomerID: identity.CustomerID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(j.tokenDuration)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.secretKey))
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// TokenDuration is the lifetime of issued access tokens.
+func (j *JWTManager) TokenDuration() time.Duration {
+	return j.tokenDuration
+}
+
+// Keys returns the key set used to sign and verify tokens.
+func (j *JWTManager) Keys() *KeySet {
+	return j.keys
 }
 
 func (j *JWTManager) Validate(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		return []byte(j.secretKey), nil
+		kid, _ := t.Header["kid"].(string)
+		key, err := j.keys.Lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+		// Reject tokens whose alg header does not match the key, e.g. an
+		// RS256 public key being used as an HS256 secret.
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+		}
+		return key.public, nil
 	})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,404 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// keyReloadInterval limits how often an unknown kid makes a key set reread
+// its directory, so tokens with made-up kids cannot flood the disk.
+const keyReloadInterval = 10 * time.Second
+
+// SigningKey is one key in a KeySet. Retired keys keep verifying tokens until
+// ExpiresAt so tokens signed just before a rotation stay valid.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	ExpiresAt time.Time // zero while the key has not been retired
+
+	private interface{} // []byte for HMAC, crypto.Signer otherwise
+	public  interface{}
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// KeySet holds the active signing key and any retired keys still accepted for verification.
+type KeySet struct {
+	mu       sync.RWMutex
+	keys     map[string]*SigningKey
+	activeID string
+
+	// Set by LoadKeySet so the set can be reloaded when other instances
+	// sharing the directory rotate keys
+	dir        string
+	grace      time.Duration
+	lastReload time.Time
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*SigningKey)}
+}
+
+// NewHMACKeySet returns a key set with a single shared-secret HS256 key.
+func NewHMACKeySet(secret string) *KeySet {
+	ks := NewKeySet()
+	ks.Add(&SigningKey{ID: "hmac", Algorithm: AlgHS256, CreatedAt: time.Now(), private: []byte(secret), public: []byte(secret)})
+	return ks
+}
+
+// Add inserts key and makes it the active signing key.
+func (ks *KeySet) Add(key *SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys[key.ID] = key
+	ks.activeID = key.ID
+}
+
+// Active returns the key new tokens are signed with.
+func (ks *KeySet) Active() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[ks.activeID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Lookup returns the key with the given ID if it is still accepted. An
+// unknown kid may have just been generated by another instance, so the set is
+// reloaded from its directory first, at most once per keyReloadInterval.
+func (ks *KeySet) Lookup(kid string) (*SigningKey, error) {
+	key, err := ks.lookup(kid)
+	if err == ErrUnknownKey && ks.reloadDue() {
+		if err := ks.Reload(); err != nil {
+			slog.Error("error reloading signing keys", "err", err)
+		}
+		key, err = ks.lookup(kid)
+	}
+	return key, err
+}
+
+func (ks *KeySet) lookup(kid string) (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	if !ok || (!key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt)) {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// reloadDue reports whether the set has a directory that was not read within
+// keyReloadInterval, and if so claims the next reload.
+func (ks *KeySet) reloadDue() bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.dir == "" || time.Since(ks.lastReload) < keyReloadInterval {
+		return false
+	}
+	ks.lastReload = time.Now()
+	return true
+}
+
+// Reload replaces the keys with the *.pem files in the directory the set was
+// loaded from, picking up keys that other instances generated or pruned. Sets
+// not loaded by LoadKeySet are left alone, as is the current set when the
+// directory holds no keys.
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+	loaded, err := readKeyDir(ks.dir, ks.grace)
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.lastReload = time.Now()
+	if err != nil {
+		return err
+	}
+	if len(loaded.keys) > 0 {
+		ks.keys, ks.activeID = loaded.keys, loaded.activeID
+	}
+	return nil
+}
+
+// Retire stops every key except the active one from being used after grace.
+func (ks *KeySet) Retire(grace time.Duration) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	deadline := time.Now().Add(grace)
+	for id, key := range ks.keys {
+		if id != ks.activeID && key.ExpiresAt.IsZero() {
+			key.ExpiresAt = deadline
+		}
+	}
+}
+
+// Prune drops retired keys whose grace period has ended and returns their IDs.
+func (ks *KeySet) Prune() []string {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	now := time.Now()
+	var pruned []string
+	for id, key := range ks.keys {
+		if id != ks.activeID && !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+			delete(ks.keys, id)
+			pruned = append(pruned, id)
+		}
+	}
+	return pruned
+}
+
+// JWK is the public part of a key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of every accepted asymmetric key. Shared HMAC
+// secrets are never published.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JWKS{Keys: []JWK{}}
+	now := time.Now()
+	for _, id := range ids {
+		key := ks.keys[id]
+		if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+			continue
+		}
+		if jwk, ok := publicJWK(key); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func publicJWK(key *SigningKey) (JWK, bool) {
+	jwk := JWK{Kid: key.ID, Alg: key.Algorithm, Use: "sig"}
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(bigEndian(pub.E))
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = b64(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = b64(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// LoadKeySet reads every *.pem private key in dir. The key ID is the file name
+// without extension and the newest file becomes the active signing key; each
+// older key stays valid for grace after the key that replaced it was created.
+// The set remembers dir; see Reload.
+func LoadKeySet(dir string, grace time.Duration) (*KeySet, error) {
+	ks, err := readKeyDir(dir, grace)
+	if err != nil {
+		return nil, err
+	}
+	ks.dir, ks.grace, ks.lastReload = dir, grace, time.Now()
+	return ks, nil
+}
+
+func readKeyDir(dir string, grace time.Duration) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	type loaded struct {
+		key     *SigningKey
+		modTime time.Time
+	}
+	var keys []loaded
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := parsePrivateKeyPEM(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("loading key %s: %w", path, err)
+		}
+		key.CreatedAt = info.ModTime()
+		keys = append(keys, loaded{key: key, modTime: info.ModTime()})
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].modTime.Equal(keys[j].modTime) {
+			return keys[i].key.ID < keys[j].key.ID
+		}
+		return keys[i].modTime.Before(keys[j].modTime)
+	})
+
+	ks := NewKeySet()
+	for i, k := range keys {
+		if i < len(keys)-1 {
+			k.key.ExpiresAt = keys[i+1].modTime.Add(grace)
+		}
+		ks.Add(k.key)
+	}
+	ks.Prune()
+	return ks, nil
+}
+
+func parsePrivateKeyPEM(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(id, parsed)
+}
+
+func newSigningKey(id string, private interface{}) (*SigningKey, error) {
+	key := &SigningKey{ID: id, CreatedAt: time.Now(), private: private}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgRS256
+		key.public = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA keys are supported")
+		}
+		key.Algorithm = AlgES256
+		key.public = &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgEdDSA
+		key.public = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+	return key, nil
+}
+
+// GenerateKey creates a new private key for alg and writes it to dir as PKCS#8 PEM.
+func GenerateKey(dir, alg string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	suffix, err := randomString(4)
+	if err != nil {
+		return nil, err
+	}
+	id := time.Now().UTC().Format("20060102T150405Z") + "-" + suffix
+	// Write under a temporary name first so that instances reloading the
+	// directory never read a half-written key
+	path := filepath.Join(dir, id+".pem")
+	if err := os.WriteFile(path+".tmp", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return nil, err
+	}
+	return newSigningKey(id, private)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func bigEndian(n int) []byte {
+	var out []byte
+	for n > 0 {
+		out = append([]byte{byte(n & 0xff)}, out...)
+		n >>= 8
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeySet_LookupReloadsKeysFromOtherInstances(t *testing.T) {
+	dir := t.TempDir()
+	first, _ := LoadKeySet(dir, time.Hour)
+	if err := NewKeyRotator(first, dir, AlgES256, 24*time.Hour, time.Hour).EnsureKey(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadKeySet(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first instance rotates; the second learns the new kid on first use
+	if err := NewKeyRotator(first, dir, AlgES256, 24*time.Hour, time.Hour).Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	active, _ := first.Active()
+	second.lastReload = time.Time{}
+	if _, err := second.Lookup(active.ID); err != nil {
+		t.Fatalf("Lookup of the other instance's key: %v", err)
+	}
+	if got, _ := second.Active(); got.ID != active.ID {
+		t.Errorf("active key = %s, want %s", got.ID, active.ID)
+	}
+
+	// Unknown kids reload at most once per interval
+	if _, err := second.Lookup("made-up"); err != ErrUnknownKey {
+		t.Errorf("Lookup of an unknown kid = %v", err)
+	}
+	if second.reloadDue() {
+		t.Error("reload due again right after one")
+	}
+}
+
+func TestKeyRotator_OnlyOneInstanceRotates(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GenerateKey(dir, AlgES256); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.pem"))
+	os.Chtimes(paths[0], old, old)
+
+	var rotators []*KeyRotator
+	for range 2 {
+		keys, err := LoadKeySet(dir, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotators = append(rotators, NewKeyRotator(keys, dir, AlgES256, 24*time.Hour, time.Hour))
+	}
+
+	// While another instance holds the lock nobody rotates
+	lock := filepath.Join(dir, rotationLockFile)
+	os.WriteFile(lock, nil, 0600)
+	if err := rotators[0].rotateIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(lock)
+
+	for _, rotator := range rotators {
+		if err := rotator.rotateIfDue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths, _ = filepath.Glob(filepath.Join(dir, "*.pem"))
+	if len(paths) != 2 {
+		t.Fatalf("%d key files, want the old key and one new one", len(paths))
+	}
+	first, _ := rotators[0].Keys.Active()
+	second, _ := rotators[1].Keys.Active()
+	if first.ID != second.ID {
+		t.Errorf("instances sign with different keys: %s and %s", first.ID, second.ID)
+	}
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Error("rotation lock not released")
+	}
+}
@@ -1,39 +1,57 @@
 package auth
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
+
+	"project.com/myproject/internal/apperr"
 )
 
 type AuthMiddleware struct {
-	jwtManager *JWTManager
+	jwtManager  *JWTManager
+	revocations RevocationList
 }
 
-func NewAuthMiddleware(jwtManager *JWTManager) *AuthMiddleware {
-	return &AuthMiddleware{jwtManager: jwtManager}
+// NewAuthMiddleware validates bearer tokens; revocations may be nil to skip
+// the revocation check.
+func NewAuthMiddleware(jwtManager *JWTManager, revocations RevocationList) *AuthMiddleware {
+	return &AuthMiddleware{jwtManager: jwtManager, revocations: revocations}
 }
 
 func (am *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "missing Authorization header", http.StatusUnauthorized)
+			apperr.Write(w, r, apperr.Unauthorized("missing_token", "Missing Authorization header"))
 			return
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			http.Error(w, "invalid Authorization header format", http.StatusUnauthorized)
+			apperr.Write(w, r, apperr.Unauthorized("invalid_token", "Invalid Authorization header format"))
 			return
 		}
 		tokenString := parts[1]
 
-		_, err := am.jwtManager.Validate(tokenString)
+		claims, err := am.jwtManager.Validate(tokenString)
 		if err != nil {
-			http.Error(w, "invalid or expired token: "+err.Error(), http.StatusUnauthorized)
+			apperr.Write(w, r, apperr.Unauthorized("invalid_token", "Invalid or expired token").Wrap(err))
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if am.revocations != nil {
+			revoked, err := am.revocations.IsRevoked(r.Context(), claims.ID)
+			if err != nil {
+				apperr.Write(w, r, fmt.Errorf("checking token revocation: %w", err))
+				return
+			}
+			if revoked {
+				apperr.Write(w, r, apperr.Unauthorized("revoked_token", "Token has been revoked"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
 	})
 }
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordMismatch is returned when a password does not match its hash.
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordHasher hashes and verifies passwords with bcrypt. Raising Cost makes
+// existing hashes report NeedsRehash so they are upgraded on next login.
+type PasswordHasher struct {
+	Cost int
+}
+
+func NewPasswordHasher(cost int) *PasswordHasher {
+	if cost < bcrypt.MinCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &PasswordHasher{Cost: cost}
+}
+
+func (p *PasswordHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (p *PasswordHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+// NeedsRehash reports whether hash was produced with different parameters
+// than the hasher is currently configured for.
+func (p *PasswordHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost != p.Cost
+}
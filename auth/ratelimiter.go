@@ -2,43 +2,224 @@ package auth
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/ulule/limiter/v3"
-	"github.com/ulule/limiter/v3/drivers/store/memory"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
 )
 
-func NewRateLimiterMiddleware() func(next http.Handler) http.Handler {
-	// Define the rate limit (10 requests per minute)
-	rate := limiter.Rate{
-		Period: 1 * time.Minute,
-		Limit:  10,
+// RateLimitRule is one rate limit tier. A request matches when its route
+// template starts with one of Routes, its method is in Methods and its
+// claims carry one of Roles; empty lists match everything.
+type RateLimitRule struct {
+	Name    string // identifies the rule's buckets
+	Routes  []string
+	Methods []string
+	Roles   []string
+	Limit   int64
+	Period  time.Duration
+}
+
+// RateLimitOptions configures NewRateLimiterMiddleware.
+type RateLimitOptions struct {
+	// Default applies when no rule matches.
+	Default RateLimitRule
+	// Rules are tried in order; the first match wins.
+	Rules []RateLimitRule
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For is believed.
+	TrustedProxies []string
+	// Allowlist holds usernames, IPs or CIDRs that are never limited.
+	Allowlist []string
+}
+
+type rateLimitTier struct {
+	RateLimitRule
+	limiter *limiter.Limiter
+}
+
+type rateLimiter struct {
+	tiers          []rateLimitTier // rules, then the default
+	trustedProxies []*net.IPNet
+	allowedUsers   map[string]bool
+	allowedNets    []*net.IPNet
+}
+
+// NewRateLimiterMiddleware limits requests per client and tier. Clients are
+// identified by the authenticated username, or by IP for anonymous requests,
+// so it should run after AuthMiddleware.Middleware. Use the ulule Redis store
+// to share the counters between instances.
+func NewRateLimiterMiddleware(store limiter.Store, opts RateLimitOptions) (func(next http.Handler) http.Handler, error) {
+	rl := &rateLimiter{allowedUsers: make(map[string]bool)}
+
+	opts.Default.Name = "default"
+	opts.Default.Routes, opts.Default.Methods, opts.Default.Roles = nil, nil, nil
+	rules := append(append([]RateLimitRule{}, opts.Rules...), opts.Default)
+	for _, rule := range rules {
+		if rule.Limit <= 0 || rule.Period <= 0 {
+			return nil, fmt.Errorf("rate limit rule %q: limit and period must be positive", rule.Name)
+		}
+		rate := limiter.Rate{Period: rule.Period, Limit: rule.Limit}
+		rl.tiers = append(rl.tiers, rateLimitTier{RateLimitRule: rule, limiter: limiter.New(store, rate)})
+	}
+
+	var err error
+	if rl.trustedProxies, err = parseNets(opts.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	for _, entry := range opts.Allowlist {
+		if nets, err := parseNets([]string{entry}); err == nil {
+			rl.allowedNets = append(rl.allowedNets, nets...)
+		} else {
+			rl.allowedUsers[strings.ToLower(strings.TrimSpace(entry))] = true
+		}
 	}
 
-	// Use an in-memory store
-	store := memory.NewStore()
-	limiterInstance := limiter.New(store, rate)
+	return rl.middleware, nil
+}
 
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get request IP for limiting
-			limiterCtx, err := limiterInstance.Get(r.Context(), r.RemoteAddr)
-			if err != nil {
-				http.Error(w, "Could not apply rate limiting", http.StatusInternalServerError)
-				return
-			}
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		ip := ClientIP(r, rl.trustedProxies)
+		if rl.allowed(claims, ip) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tier := rl.tier(r, claims)
+		client := "ip:" + ip.String()
+		if claims != nil && claims.Username != "" {
+			client = "user:" + claims.Username
+		}
 
-			// Add rate limiting headers
-			w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", limiterCtx.Limit))
-			w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", limiterCtx.Remaining))
+		limiterCtx, err := tier.limiter.Get(r.Context(), tier.Name+":"+client)
+		if err != nil {
+			// Fail open: an unreachable Redis must not take the API down
+			logging.FromContext(r.Context()).Error("could not apply rate limiting", "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
 
-			if limiterCtx.Reached {
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
-				return
+		// Add rate limiting headers
+		w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(limiterCtx.Limit, 10))
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(limiterCtx.Remaining, 10))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(limiterCtx.Reset, 10))
+
+		if limiterCtx.Reached {
+			retryAfter := limiterCtx.Reset - time.Now().Unix()
+			if retryAfter < 1 {
+				retryAfter = 1
 			}
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			apperr.Write(w, r, apperr.New(apperr.KindRateLimited, "rate_limited", "Too many requests"))
+			return
+		}
 
-			next.ServeHTTP(w, r)
-		})
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rl *rateLimiter) allowed(claims *Claims, ip net.IP) bool {
+	if claims != nil && rl.allowedUsers[claims.Username] {
+		return true
+	}
+	return containsIP(rl.allowedNets, ip)
+}
+
+// tier returns the first rule matching the request, or the default.
+func (rl *rateLimiter) tier(r *http.Request, claims *Claims) rateLimitTier {
+	route := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			route = template
+		}
+	}
+
+	for _, tier := range rl.tiers {
+		if matchesAny(tier.Routes, func(prefix string) bool { return strings.HasPrefix(route, prefix) }) &&
+			matchesAny(tier.Methods, func(method string) bool { return strings.EqualFold(method, r.Method) }) &&
+			(len(tier.Roles) == 0 || claims != nil && claims.HasAnyRole(tier.Roles...)) {
+			return tier
+		}
+	}
+	return rl.tiers[len(rl.tiers)-1]
+}
+
+func matchesAny(values []string, match func(string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the client, without the port. X-Forwarded-For is
+// only used when the connection comes from a trusted proxy; it is read from
+// the right, skipping trusted proxies, so clients cannot spoof it.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trustedProxies, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNets parses IPs and CIDRs; a bare IP becomes a single-address network.
+func parseNets(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			entry = ip.String() + "/" + strconv.Itoa(bits)
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
 	}
+	return nets, nil
 }
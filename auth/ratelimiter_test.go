@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := parseNets([]string{"10.0.0.0/8"})
+	tests := []struct {
+		name, remote, forwarded, want string
+	}{
+		{"direct, port stripped", "203.0.113.7:51234", "", "203.0.113.7"},
+		{"untrusted peer cannot spoof", "203.0.113.7:1", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:1", "198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:1", "1.2.3.4, 198.51.100.1, 10.0.0.3", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := ClientIP(r, proxies).String(); got != tt.want {
+			t.Errorf("%s: ClientIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiter_TiersAndHeaders(t *testing.T) {
+	limit, err := NewRateLimiterMiddleware(memory.NewStore(), RateLimitOptions{
+		Default: RateLimitRule{Limit: 3, Period: time.Minute},
+		Rules: []RateLimitRule{
+			{Name: "reports", Routes: []string{"/api/reports"}, Limit: 1, Period: time.Minute},
+		},
+		Allowlist: []string{"monitor"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if user := req.Header.Get("X-Test-User"); user != "" {
+				req = req.WithContext(WithClaims(req.Context(), &Claims{Username: user}))
+			}
+			next.ServeHTTP(w, req)
+		})
+	})
+	r.Use(limit)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/api/reports", ok)
+	r.HandleFunc("/api/books/{id}", ok)
+
+	call := func(path, user, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Test-User", user)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The stricter reports tier has its own bucket
+	call("/api/reports", "alice", "192.0.2.1:1")
+	rec := call("/api/reports", "alice", "192.0.2.1:2")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second report: status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("X-RateLimit-Reset") == "" {
+		t.Errorf("missing Retry-After/X-RateLimit-Reset: %v", rec.Header())
+	}
+	if rec := call("/api/books/1", "alice", "192.0.2.1:3"); rec.Code != http.StatusOK {
+		t.Errorf("catalog read after reports limit: status %d", rec.Code)
+	}
+
+	// Users are limited by name whatever their IP; another user is not affected
+	for i := 0; i < 2; i++ {
+		call("/api/books/1", "alice", "192.0.2.99:1")
+	}
+	if rec := call("/api/books/1", "alice", "192.0.2.100:1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("alice over default limit: status %d, want 429", rec.Code)
+	}
+	if rec := call("/api/books/1", "bob", "192.0.2.1:1"); rec.Code != http.StatusOK {
+		t.Errorf("bob: status %d, want 200", rec.Code)
+	}
+
+	// Allowlisted users are never limited
+	for i := 0; i < 5; i++ {
+		if rec := call("/api/reports", "monitor", "192.0.2.1:1"); rec.Code != http.StatusOK {
+			t.Fatalf("allowlisted user limited: status %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// NewRefreshToken returns an opaque refresh token and the hash to persist.
+// Only the hash is ever stored; the plain token is handed to the client once.
+func NewRefreshToken() (token string, hash string, err error) {
+	token, err = randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hex-encoded SHA-256 of a refresh token.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTokenFamily returns a random identifier shared by a chain of rotated refresh tokens.
+func NewTokenFamily() (string, error) {
+	return randomString(16)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"project.com/myproject/internal/logging"
+)
+
+// RevocationList records access token IDs (jti) that must be rejected before
+// they expire, e.g. after logout.
+type RevocationList interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// MemoryRevocationList keeps revoked IDs in process memory until they expire.
+type MemoryRevocationList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{revoked: make(map[string]time.Time)}
+}
+
+func (l *MemoryRevocationList) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range l.revoked {
+		if now.After(exp) {
+			delete(l.revoked, id)
+		}
+	}
+	l.revoked[jti] = expiresAt
+	return nil
+}
+
+func (l *MemoryRevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	exp, ok := l.revoked[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+// RedisRevocationList stores revoked IDs in Redis so every instance sees them,
+// and mirrors them in memory so revocation still works while Redis is down.
+// Revoke fails if Redis does, since other instances would keep accepting the
+// token.
+type RedisRevocationList struct {
+	client   *redis.Client
+	fallback *MemoryRevocationList
+}
+
+const revokedKeyPrefix = "revoked_jti:"
+
+// NewRevocationList returns a Redis-backed list, or an in-memory one when client is nil.
+func NewRevocationList(client *redis.Client) RevocationList {
+	if client == nil {
+		return NewMemoryRevocationList()
+	}
+	return &RedisRevocationList{client: client, fallback: NewMemoryRevocationList()}
+}
+
+func (l *RedisRevocationList) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	l.fallback.Revoke(ctx, jti, expiresAt)
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := l.client.Set(ctx, revokedKeyPrefix+jti, "1", ttl).Err(); err != nil {
+		logging.FromContext(ctx).Error("error storing revoked token in redis", "err", err)
+		return fmt.Errorf("storing revoked token: %w", err)
+	}
+	return nil
+}
+
+func (l *RedisRevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := l.client.Exists(ctx, revokedKeyPrefix+jti).Result()
+	if err != nil {
+		return l.fallback.IsRevoked(ctx, jti)
+	}
+	if n > 0 {
+		return true, nil
+	}
+	return l.fallback.IsRevoked(ctx, jti)
+}
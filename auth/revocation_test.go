@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisRevocationList_RevokeFailsWhenRedisIsDown(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer client.Close()
+	list := NewRevocationList(client)
+
+	if err := list.Revoke(context.Background(), "jti-1", time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("Revoke succeeded although Redis is unreachable")
+	}
+	// The local mirror still rejects the token on this instance
+	if revoked, _ := list.IsRevoked(context.Background(), "jti-1"); !revoked {
+		t.Error("token not revoked locally")
+	}
+}
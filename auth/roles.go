@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"project.com/myproject/internal/apperr"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleStaff     = "staff"
+	RoleCustomer  = "customer"
+	RoleReporting = "reporting"
+)
+
+// AllRoles lists every role a user may be assigned.
+var AllRoles = []string{RoleAdmin, RoleStaff, RoleCustomer, RoleReporting}
+
+// ValidRole reports whether role is one of AllRoles.
+func ValidRole(role string) bool {
+	for _, r := range AllRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey int
+
+const claimsContextKey contextKey = iota
+
+// WithClaims returns a copy of ctx carrying the authenticated claims.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// ClaimsFromContext returns the claims injected by AuthMiddleware, if any.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// HasAnyRole reports whether the claims carry at least one of roles.
+func (c *Claims) HasAnyRole(roles ...string) bool {
+	for _, have := range c.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequireRoles rejects requests whose claims carry none of the given roles.
+// It must run after AuthMiddleware.Middleware.
+func RequireRoles(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				apperr.Write(w, r, apperr.Unauthorized("missing_token", "Missing authentication"))
+				return
+			}
+			if !claims.HasAnyRole(roles...) {
+				apperr.Write(w, r, apperr.Forbidden("insufficient_permissions", "Insufficient permissions"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
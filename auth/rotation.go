@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// rotationLockFile in the keys directory is held by the instance
+	// generating a key, so instances sharing the directory rotate only once.
+	rotationLockFile = ".rotation.lock"
+	// staleRotationLock is the age after which a lock left behind by a
+	// crashed instance is taken over.
+	staleRotationLock = time.Minute
+)
+
+// KeyRotator periodically generates a new signing key in Dir and retires the
+// previous one after Grace, which should be at least the access token lifetime.
+// Several instances may share Dir: each reloads it on every check, and only
+// the one holding the rotation lock generates a new key.
+type KeyRotator struct {
+	Keys      *KeySet
+	Dir       string
+	Algorithm string
+	Interval  time.Duration
+	Grace     time.Duration
+}
+
+func NewKeyRotator(keys *KeySet, dir, algorithm string, interval, grace time.Duration) *KeyRotator {
+	return &KeyRotator{Keys: keys, Dir: dir, Algorithm: algorithm, Interval: interval, Grace: grace}
+}
+
+// Rotate generates a new active key and starts the grace period of the old ones.
+func (kr *KeyRotator) Rotate() error {
+	key, err := GenerateKey(kr.Dir, kr.Algorithm)
+	if err != nil {
+		return err
+	}
+	kr.Keys.Add(key)
+	kr.Keys.Retire(kr.Grace)
+	slog.Info("rotated signing key", "kid", key.ID)
+	return nil
+}
+
+// EnsureKey rotates immediately if the key set has no active key. If another
+// instance is creating the first key, it waits for that one instead.
+func (kr *KeyRotator) EnsureKey() error {
+	deadline := time.Now().Add(2 * staleRotationLock)
+	for {
+		if _, err := kr.Keys.Active(); err == nil {
+			return nil
+		}
+		unlock, locked, err := kr.lock()
+		if err != nil {
+			return err
+		}
+		if locked {
+			defer unlock()
+			if err := kr.Keys.Reload(); err != nil {
+				return err
+			}
+			if _, err := kr.Keys.Active(); err == nil {
+				return nil
+			}
+			return kr.Rotate()
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for another instance to create a signing key")
+		}
+		time.Sleep(100 * time.Millisecond)
+		if err := kr.Keys.Reload(); err != nil {
+			return err
+		}
+	}
+}
+
+// rotateIfDue rotates if the active key is older than Interval and no other
+// instance is rotating at the same time.
+func (kr *KeyRotator) rotateIfDue() error {
+	if !kr.due() {
+		return nil
+	}
+	unlock, locked, err := kr.lock()
+	if err != nil || !locked {
+		return err
+	}
+	defer unlock()
+
+	// Another instance may have rotated just before the lock was taken
+	if err := kr.Keys.Reload(); err != nil {
+		return err
+	}
+	if !kr.due() {
+		return nil
+	}
+	return kr.Rotate()
+}
+
+func (kr *KeyRotator) due() bool {
+	active, err := kr.Keys.Active()
+	return err != nil || time.Since(active.CreatedAt) >= kr.Interval
+}
+
+// lock takes the rotation lock file in Dir. It reports false if another
+// instance holds it; unlock releases it.
+func (kr *KeyRotator) lock() (unlock func(), locked bool, err error) {
+	path := filepath.Join(kr.Dir, rotationLockFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < staleRotationLock {
+			return nil, false, nil
+		}
+		slog.Warn("taking over a stale signing key rotation lock", "path", path)
+		os.Remove(path)
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			return nil, false, nil
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	f.Close()
+	return func() { os.Remove(path) }, true, nil
+}
+
+// Start reloads the keys and checks the active key's age every checkEvery
+// until ctx is cancelled.
+func (kr *KeyRotator) Start(ctx context.Context, checkEvery time.Duration) {
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := kr.Keys.Reload(); err != nil {
+				slog.Error("error reloading signing keys", "err", err)
+			}
+			for _, id := range kr.Keys.Prune() {
+				if err := os.Remove(filepath.Join(kr.Dir, id+".pem")); err != nil && !os.IsNotExist(err) {
+					slog.Error("error removing retired signing key", "kid", id, "err", err)
+				}
+			}
+
+			if err := kr.rotateIfDue(); err != nil {
+				slog.Error("error rotating signing key", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,535 @@
+// Package config loads the server configuration. Values come from, in order
+// of increasing precedence: built-in defaults, a YAML or TOML file, environment
+// variables and command-line flags.
+//
+// Every environment variable NAME can also be given as NAME_FILE pointing at a
+// file holding the value, which is how secrets are passed in from Docker or
+// Kubernetes secret mounts.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete server configuration.
+//
+// Struct tags: env is the environment variable, flag the command-line flag
+// and secret marks values hidden by `config print --redact`.
+type Config struct {
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	Database    DatabaseConfig    `yaml:"database" toml:"database"`
+	Redis       RedisConfig       `yaml:"redis" toml:"redis"`
+	Cache       CacheConfig       `yaml:"cache" toml:"cache"`
+	Auth        AuthConfig        `yaml:"auth" toml:"auth"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit" toml:"rate_limit"`
+	Idempotency IdempotencyConfig `yaml:"idempotency" toml:"idempotency"`
+	Reports     ReportsConfig     `yaml:"reports" toml:"reports"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	Tracing     TracingConfig     `yaml:"tracing" toml:"tracing"`
+}
+
+type ServerConfig struct {
+	Addr            string        `yaml:"addr" toml:"addr" env:"LISTEN_ADDR" flag:"addr"`
+	RequestTimeout  time.Duration `yaml:"request_timeout" toml:"request_timeout" env:"REQUEST_TIMEOUT" flag:"request-timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout"`
+	// ShutdownDelay is how long /readyz fails before the server stops
+	// accepting connections, so load balancers can take the instance out.
+	ShutdownDelay      time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay" env:"SHUTDOWN_DELAY" flag:"shutdown-delay"`
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout" toml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT" flag:"health-check-timeout"`
+}
+
+type DatabaseConfig struct {
+	// Backend is "postgres" or "memory" (no database, data lost on restart).
+	Backend  string `yaml:"backend" toml:"backend" env:"STORE_BACKEND" flag:"store-backend"`
+	URL      string `yaml:"url" toml:"url" env:"DATABASE_URL" flag:"database-url" secret:"true"`
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST" flag:"db-host"`
+	Port     int    `yaml:"port" toml:"port" env:"DB_PORT" flag:"db-port"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER" flag:"db-user"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME" flag:"db-name"`
+	SSLMode  string `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE" flag:"db-sslmode"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr" toml:"addr" env:"REDIS_ADDR" flag:"redis-addr"`
+	Password string `yaml:"password" toml:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `yaml:"db" toml:"db" env:"REDIS_DB" flag:"redis-db"`
+}
+
+type CacheConfig struct {
+	// Mode is "tiered" (local LRU in front of Redis, local only while Redis
+	// is down), "redis" or "local".
+	Mode                string        `yaml:"mode" toml:"mode" env:"CACHE_MODE" flag:"cache-mode"`
+	LocalSize           int           `yaml:"local_size" toml:"local_size" env:"CACHE_LOCAL_SIZE" flag:"cache-local-size"`
+	LocalTTL            time.Duration `yaml:"local_ttl" toml:"local_ttl" env:"CACHE_LOCAL_TTL" flag:"cache-local-ttl"`
+	HealthCheckInterval time.Duration `yaml:"health_check_interval" toml:"health_check_interval" env:"CACHE_HEALTH_CHECK_INTERVAL" flag:"cache-health-check-interval"`
+	// StaleTTL is how long an expired entry is still served while it is
+	// refreshed in the background.
+	StaleTTL    time.Duration `yaml:"stale_ttl" toml:"stale_ttl" env:"CACHE_STALE_TTL" flag:"cache-stale-ttl"`
+	NegativeTTL time.Duration `yaml:"negative_ttl" toml:"negative_ttl" env:"CACHE_NEGATIVE_TTL" flag:"cache-negative-ttl"`
+	// EarlyExpirationBeta scales probabilistic early refreshes; 0 disables them.
+	EarlyExpirationBeta float64 `yaml:"early_expiration_beta" toml:"early_expiration_beta" env:"CACHE_EARLY_EXPIRATION_BETA" flag:"cache-early-expiration-beta"`
+}
+
+type AuthConfig struct {
+	// JWTSecret switches token signing to a shared HS256 secret instead of
+	// the rotating key files in KeysDir.
+	JWTSecret           string        `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	KeysDir             string        `yaml:"keys_dir" toml:"keys_dir" env:"KEYS_DIR" flag:"keys-dir"`
+	SigningAlgorithm    string        `yaml:"signing_algorithm" toml:"signing_algorithm" env:"SIGNING_ALGORITHM" flag:"signing-algorithm"`
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval" toml:"key_rotation_interval" env:"KEY_ROTATION_INTERVAL" flag:"key-rotation-interval"`
+	TokenDuration       time.Duration `yaml:"token_duration" toml:"token_duration" env:"TOKEN_DURATION" flag:"token-duration"`
+	// AdminUsername, if set, is created with the admin role on startup
+	// unless a user with that name exists, so that a new deployment has
+	// someone who can assign roles.
+	AdminUsername string `yaml:"admin_username" toml:"admin_username" env:"ADMIN_USERNAME" flag:"admin-username"`
+	AdminEmail    string `yaml:"admin_email" toml:"admin_email" env:"ADMIN_EMAIL" flag:"admin-email"`
+	AdminPassword string `yaml:"admin_password" toml:"admin_password" env:"ADMIN_PASSWORD" secret:"true"`
+}
+
+type RateLimitConfig struct {
+	// Store is "memory" (per instance) or "redis" (shared by all instances).
+	Store string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE" flag:"rate-limit-store"`
+	// Requests per Period is the default limit, used when no rule matches.
+	Requests int64         `yaml:"requests" toml:"requests" env:"RATE_LIMIT_REQUESTS" flag:"rate-limit-requests"`
+	Period   time.Duration `yaml:"period" toml:"period" env:"RATE_LIMIT_PERIOD" flag:"rate-limit-period"`
+	// Rules are tried in order; the first one matching the request applies.
+	Rules []RateLimitRule `yaml:"rules" toml:"rules"`
+	// TrustedProxies (IPs or CIDRs) may set X-Forwarded-For.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"RATE_LIMIT_TRUSTED_PROXIES" flag:"rate-limit-trusted-proxies"`
+	// Allowlist holds usernames, IPs or CIDRs that are never limited.
+	Allowlist []string `yaml:"allowlist" toml:"allowlist" env:"RATE_LIMIT_ALLOWLIST" flag:"rate-limit-allowlist"`
+}
+
+// RateLimitRule is a rate limit tier for some routes, methods and roles;
+// empty lists match everything. Routes are path template prefixes such as
+// "/api/reports".
+type RateLimitRule struct {
+	Name     string        `yaml:"name" toml:"name"`
+	Routes   []string      `yaml:"routes,omitempty" toml:"routes"`
+	Methods  []string      `yaml:"methods,omitempty" toml:"methods"`
+	Roles    []string      `yaml:"roles,omitempty" toml:"roles"`
+	Requests int64         `yaml:"requests" toml:"requests"`
+	Period   time.Duration `yaml:"period" toml:"period"`
+}
+
+type IdempotencyConfig struct {
+	// Store is "postgres", "redis" or "memory" (per instance). With the
+	// memory database backend, "postgres" falls back to "memory".
+	Store string `yaml:"store" toml:"store" env:"IDEMPOTENCY_STORE" flag:"idempotency-store"`
+	// TTL is how long a response is replayed for its Idempotency-Key.
+	TTL time.Duration `yaml:"ttl" toml:"ttl" env:"IDEMPOTENCY_TTL" flag:"idempotency-ttl"`
+	// LockTimeout is how long an unfinished request holds its key.
+	LockTimeout time.Duration `yaml:"lock_timeout" toml:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT" flag:"idempotency-lock-timeout"`
+}
+
+type ReportsConfig struct {
+	Dir      string        `yaml:"dir" toml:"dir" env:"REPORTS_DIR" flag:"reports-dir"`
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"REPORT_INTERVAL" flag:"report-interval"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error; Format is json or text.
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format"`
+}
+
+type TracingConfig struct {
+	// Exporter is "none", "otlp" (OTLP over HTTP), "stdout" or "file".
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter"`
+	// Endpoint is the OTLP collector URL; when empty the standard
+	// OTEL_EXPORTER_OTLP_* variables apply (default http://localhost:4318).
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT" flag:"tracing-endpoint"`
+	File        string  `yaml:"file" toml:"file" env:"TRACING_FILE" flag:"tracing-file"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME" flag:"tracing-service-name"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio"`
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:               ":8080",
+			RequestTimeout:     5 * time.Second,
+			ShutdownTimeout:    5 * time.Second,
+			ShutdownDelay:      5 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Backend: "postgres",
+			Host:    "localhost",
+			Port:    5432,
+			User:    "postgres",
+			Name:    "mylibrary",
+			SSLMode: "disable",
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		Cache: CacheConfig{
+			Mode:                "tiered",
+			LocalSize:           10000,
+			LocalTTL:            time.Minute,
+			HealthCheckInterval: 5 * time.Second,
+			StaleTTL:            time.Minute,
+			NegativeTTL:         30 * time.Second,
+			EarlyExpirationBeta: 1,
+		},
+		Auth: AuthConfig{
+			KeysDir:             "keys",
+			SigningAlgorithm:    "ES256",
+			KeyRotationInterval: 30 * 24 * time.Hour,
+			TokenDuration:       time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Store:    "memory",
+			Requests: 10,
+			Period:   time.Minute,
+			Rules: []RateLimitRule{
+				{Name: "reports", Routes: []string{"/api/reports"}, Requests: 2, Period: time.Minute},
+				{Name: "staff", Roles: []string{"admin", "staff"}, Requests: 60, Period: time.Minute},
+				{Name: "catalog", Routes: []string{"/api/books", "/api/authors"}, Methods: []string{"GET"}, Requests: 30, Period: time.Minute},
+			},
+		},
+		Idempotency: IdempotencyConfig{
+			Store:       "postgres",
+			TTL:         24 * time.Hour,
+			LockTimeout: time.Minute,
+		},
+		Reports: ReportsConfig{
+			Dir:      "reports",
+			Interval: 24 * time.Hour,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "traces.jsonl",
+			ServiceName: "bookstore-api",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load builds the configuration from args (without the program name) and the
+// process environment. The file is taken from --config or CONFIG_FILE. It
+// returns the arguments left after the flags, e.g. a subcommand.
+func Load(args []string) (Config, []string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("bookstore", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flagValues := make(map[string]*string)
+	for _, field := range fields(&cfg) {
+		if field.flag != "" {
+			flagValues[field.flag] = fs.String(field.flag, "", "overrides "+field.path)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, &cfg); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return Config{}, nil, err
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, field := range fields(&cfg) {
+			if field.flag == f.Name && flagErr == nil {
+				if err := field.set(*flagValues[f.Name]); err != nil {
+					flagErr = fmt.Errorf("flag --%s: %w", f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return Config{}, nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config file %s: unsupported format (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides cfg from NAME or NAME_FILE environment variables.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	for _, field := range fields(cfg) {
+		if field.env == "" {
+			continue
+		}
+		value, ok := lookup(field.env)
+		if path, fromFile := lookup(field.env + "_FILE"); fromFile && !ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %w", field.env, err)
+			}
+			value, ok = strings.TrimRight(string(data), "\r\n"), true
+		}
+		if !ok {
+			continue
+		}
+		if err := field.set(value); err != nil {
+			return fmt.Errorf("%s: %w", field.env, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Server.RequestTimeout > 0, "server.request_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay must not be negative")
+	check(c.Server.HealthCheckTimeout > 0, "server.health_check_timeout must be positive")
+
+	switch c.Database.Backend {
+	case "memory":
+	case "postgres":
+		if c.Database.URL != "" {
+			_, err := url.Parse(c.Database.URL)
+			check(err == nil, "database.url is not a valid URL")
+		} else {
+			check(c.Database.Host != "", "database.host is required")
+			check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port must be between 1 and 65535")
+			check(c.Database.User != "", "database.user is required")
+			check(c.Database.Name != "", "database.name is required")
+		}
+	default:
+		check(false, "database.backend must be postgres or memory, got %q", c.Database.Backend)
+	}
+
+	check(c.Redis.Addr != "", "redis.addr is required")
+	check(c.Redis.DB >= 0, "redis.db must not be negative")
+
+	switch c.Cache.Mode {
+	case "tiered", "redis", "local":
+	default:
+		check(false, "cache.mode must be tiered, redis or local, got %q", c.Cache.Mode)
+	}
+	check(c.Cache.LocalSize > 0, "cache.local_size must be positive")
+	check(c.Cache.LocalTTL > 0, "cache.local_ttl must be positive")
+	check(c.Cache.HealthCheckInterval > 0, "cache.health_check_interval must be positive")
+	check(c.Cache.StaleTTL >= 0, "cache.stale_ttl must not be negative")
+	check(c.Cache.NegativeTTL >= 0, "cache.negative_ttl must not be negative")
+	check(c.Cache.EarlyExpirationBeta >= 0, "cache.early_expiration_beta must not be negative")
+
+	if c.Auth.JWTSecret == "" {
+		check(c.Auth.KeysDir != "", "auth.keys_dir is required unless auth.jwt_secret is set")
+		switch c.Auth.SigningAlgorithm {
+		case "RS256", "ES256", "EdDSA":
+		default:
+			check(false, "auth.signing_algorithm must be RS256, ES256 or EdDSA, got %q", c.Auth.SigningAlgorithm)
+		}
+		check(c.Auth.KeyRotationInterval > 0, "auth.key_rotation_interval must be positive")
+	} else {
+		check(len(c.Auth.JWTSecret) >= 32, "auth.jwt_secret must be at least 32 characters")
+	}
+	check(c.Auth.TokenDuration > 0, "auth.token_duration must be positive")
+	if c.Auth.AdminUsername != "" {
+		check(c.Auth.AdminEmail != "", "auth.admin_email is required with auth.admin_username")
+		check(len(c.Auth.AdminPassword) >= 8, "auth.admin_password must be at least 8 characters")
+	}
+
+	check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "redis", "rate_limit.store must be memory or redis, got %q", c.RateLimit.Store)
+	check(c.RateLimit.Requests > 0, "rate_limit.requests must be positive")
+	check(c.RateLimit.Period > 0, "rate_limit.period must be positive")
+	ruleNames := make(map[string]bool)
+	for i, rule := range c.RateLimit.Rules {
+		check(rule.Name != "" && rule.Name != "default", "rate_limit.rules[%d].name is required and must not be \"default\"", i)
+		check(!ruleNames[rule.Name], "rate_limit.rules[%d].name %q is used twice", i, rule.Name)
+		check(rule.Requests > 0, "rate_limit.rules[%d].requests must be positive", i)
+		check(rule.Period > 0, "rate_limit.rules[%d].period must be positive", i)
+		ruleNames[rule.Name] = true
+	}
+	for _, proxy := range c.RateLimit.TrustedProxies {
+		check(validIPOrCIDR(proxy), "rate_limit.trusted_proxies: %q is not an IP or CIDR", proxy)
+	}
+
+	switch c.Idempotency.Store {
+	case "postgres", "redis", "memory":
+	default:
+		check(false, "idempotency.store must be postgres, redis or memory, got %q", c.Idempotency.Store)
+	}
+	check(c.Idempotency.TTL > 0, "idempotency.ttl must be positive")
+	check(c.Idempotency.LockTimeout > 0, "idempotency.lock_timeout must be positive")
+
+	check(c.Reports.Dir != "", "reports.dir is required")
+	check(c.Reports.Interval > 0, "reports.interval must be positive")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text, got %q", c.Log.Format)
+
+	exporters := map[string]bool{"none": true, "otlp": true, "stdout": true, "file": true}
+	check(exporters[c.Tracing.Exporter], "tracing.exporter must be none, otlp, stdout or file, got %q", c.Tracing.Exporter)
+	check(c.Tracing.Exporter != "file" || c.Tracing.File != "", "tracing.file is required with the file exporter")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validIPOrCIDR(value string) bool {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return true
+	}
+	return net.ParseIP(value) != nil
+}
+
+// DSN returns the Postgres connection string.
+func (d DatabaseConfig) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		d.Host, d.Port, d.User, quoteDSN(d.Password), d.Name, d.SSLMode)
+}
+
+// quoteDSN quotes a key/value connection string value if it needs it.
+func quoteDSN(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Redacted returns a copy of c with every secret replaced by "******".
+func (c Config) Redacted() Config {
+	for _, field := range fields(&c) {
+		if field.secret && !field.value.IsZero() {
+			field.value.SetString("******")
+		}
+	}
+	return c
+}
+
+// YAML renders the configuration in the config file format.
+func (c Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// field is one leaf setting of Config, found by reflection.
+type field struct {
+	path   string // e.g. database.host
+	env    string
+	flag   string
+	secret bool
+	value  reflect.Value
+}
+
+func fields(cfg *Config) []field {
+	var out []field
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			tag := section.Type().Field(j).Tag
+			out = append(out, field{
+				path:   sectionName + "." + tag.Get("yaml"),
+				env:    tag.Get("env"),
+				flag:   tag.Get("flag"),
+				secret: tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return out
+}
+
+func (f field) set(raw string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(raw)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+	case int, int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(n)
+	case []string:
+		var values []string
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		f.value.Set(reflect.ValueOf(values))
+	case float64:
+		x, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetFloat(x)
+	default:
+		return fmt.Errorf("unsupported setting type %s", f.value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.toml")
+	err := os.WriteFile(file, []byte("[server]\naddr = \":9000\"\nrequest_timeout = \"3s\"\n\n[rate_limit]\nrequests = 50\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "db_password")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("LISTEN_ADDR", ":9100")
+	t.Setenv("DB_PASSWORD_FILE", secret)
+
+	cfg, args, err := Load([]string{"--config", file, "--addr", ":9200", "migrate", "up"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Addr != ":9200" {
+		t.Errorf("Addr = %q, want the flag value", cfg.Server.Addr)
+	}
+	if cfg.Server.RequestTimeout != 3*time.Second {
+		t.Errorf("RequestTimeout = %v, want the file value", cfg.Server.RequestTimeout)
+	}
+	if cfg.RateLimit.Requests != 50 || cfg.RateLimit.Period != time.Minute {
+		t.Errorf("RateLimit = %+v, want 50 per default period", cfg.RateLimit)
+	}
+	if cfg.Database.Password != "from-file" {
+		t.Errorf("Password = %q, want the DB_PASSWORD_FILE contents", cfg.Database.Password)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("args = %v, want [migrate up]", args)
+	}
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Addr = ""
+	cfg.RateLimit.Requests = 0
+	cfg.Auth.JWTSecret = "short"
+	cfg.Auth.AdminUsername = "admin"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	for _, want := range []string{"server.addr", "rate_limit.requests", "auth.jwt_secret", "auth.admin_email", "auth.admin_password"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "hunter2"
+	cfg.Auth.JWTSecret = strings.Repeat("x", 32)
+
+	redacted := cfg.Redacted()
+	if redacted.Database.Password != "******" || redacted.Auth.JWTSecret != "******" {
+		t.Errorf("secrets not redacted: %+v", redacted)
+	}
+	if redacted.Redis.Password != "" {
+		t.Errorf("empty secret should stay empty, got %q", redacted.Redis.Password)
+	}
+	if cfg.Database.Password != "hunter2" {
+		t.Error("Redacted modified the original config")
+	}
+}
+
+func TestDSN_QuotesPassword(t *testing.T) {
+	db := Default().Database
+	db.Password = "it's secret"
+	if !strings.Contains(db.DSN(), `password='it\'s secret'`) {
+		t.Errorf("DSN = %q", db.DSN())
+	}
+}
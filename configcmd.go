@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"project.com/myproject/config"
+)
+
+const configUsage = "usage: config print [--redact]"
+
+// runConfig implements the "config" subcommand.
+func runConfig(cfg config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New(configUsage)
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	redact := fs.Bool("redact", false, "hide passwords and secrets")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *redact {
+		cfg = cfg.Redacted()
+	}
+	data, err := cfg.YAML()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -1,26 +1,51 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
+	"time"
 
 	"project.com/myproject/auth"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
+	"project.com/myproject/internal/validate"
+	m "project.com/myproject/models"
+	s "project.com/myproject/stores"
 
 	"github.com/gorilla/mux"
 )
 
-// In-memory user store (Replace this with a database in production)
-var userStore = make(map[string]string)
-var mu sync.Mutex
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	errInvalidCredentials  = apperr.Unauthorized("invalid_credentials", "Invalid credentials")
+	errInvalidRefreshToken = apperr.Unauthorized("invalid_refresh_token", "Invalid refresh token")
+)
 
 type AuthHandler struct {
-	JWTManager *auth.JWTManager
+	JWTManager  *auth.JWTManager
+	Users       s.AuthStore
+	Hasher      *auth.PasswordHasher
+	Revocations auth.RevocationList
+
+	// dummyHash is compared against when the user does not exist so that
+	// unknown usernames take as long to reject as wrong passwords.
+	dummyHash string
 }
 
-func NewAuthHandler(jwtManager *auth.JWTManager) *AuthHandler {
+func NewAuthHandler(jwtManager *auth.JWTManager, users s.AuthStore, revocations auth.RevocationList) *AuthHandler {
+	hasher := auth.NewPasswordHasher(12)
+	dummyHash, _ := hasher.Hash("not-a-real-password")
 	return &AuthHandler{
-		JWTManager: jwtManager,
+		JWTManager:  jwtManager,
+		Users:       users,
+		Hasher:      hasher,
+		Revocations: revocations,
+		dummyHash:   dummyHash,
 	}
 }
 
@@ -28,19 +53,36 @@ func NewAuthHandler(jwtManager *auth.JWTManager) *AuthHandler {
 func (h *AuthHandler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/login", h.HandleLogin).Methods("POST")
 	router.HandleFunc("/register", h.HandleRegister).Methods("POST") // ✅ Added register route
+	router.HandleFunc("/token/refresh", h.HandleRefresh).Methods("POST")
+	router.HandleFunc("/logout", h.HandleLogout).Methods("POST")
+	router.HandleFunc("/.well-known/jwks.json", h.HandleJWKS).Methods("GET")
 }
 
 // ✅ Struct for Login & Register Requests
 type authRequest struct {
 	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
 	Password string `json:"password"`
 }
 
+// registerRequest adds the registration rules to authRequest
+type registerRequest struct {
+	Username string `json:"username" validate:"required,max=100"`
+	Email    string `json:"email" validate:"required,max=255,email"`
+	Password string `json:"password" validate:"min=8"`
+}
+
+// ✅ Struct for Refresh & Logout Requests
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // ✅ Struct for JSON Response
 type authResponse struct {
-	Token  string `json:"token,omitempty"`
-	Error  string `json:"error,omitempty"`
-	Status string `json:"status,omitempty"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	Status       string `json:"status,omitempty"`
 }
 
 // ✅ Handle User Registration
@@ -48,26 +90,37 @@ func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	var req authRequest
 
 	// Decode JSON Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error": "Invalid JSON request"}`, http.StatusBadRequest)
+	if err := decodeJSON(r, &req); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	// Lock the user store (for thread safety)
-	mu.Lock()
-	defer mu.Unlock()
+	req.Username = s.NormalizeUsername(req.Username)
+	req.Email = s.NormalizeEmail(req.Email)
+	if err := validate.Error(validate.Struct(registerRequest(req))); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
 
-	// Check if user already exists
-	if _, exists := userStore[req.Username]; exists {
-		http.Error(w, `{"error": "User already exists"}`, http.StatusConflict)
+	hash, err := h.Hasher.Hash(req.Password)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	// Store the new user (⚠️ In real applications, **hash** the password before storing)
-	userStore[req.Username] = req.Password
+	_, err = h.Users.CreateUser(r.Context(), m.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: hash,
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
 
 	// ✅ Return success response
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(authResponse{
 		Status: "User registered successfully",
 	})
@@ -78,31 +131,204 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	var req authRequest
 
 	// Decode JSON Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error": "Invalid JSON request"}`, http.StatusBadRequest)
+	if err := decodeJSON(r, &req); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	// Unknown and disabled users cost a hash as well, so timing does not tell
+	// them apart from a wrong password
+	user, err := h.Users.GetUserByUsername(r.Context(), req.Username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, err)
+		return
+	}
+	if err != nil || user.Disabled {
+		h.Hasher.Verify(h.dummyHash, req.Password)
+		respondWithError(w, r, errInvalidCredentials)
+		return
+	}
+	if err := h.Hasher.Verify(user.PasswordHash, req.Password); err != nil {
+		respondWithError(w, r, errInvalidCredentials)
+		return
+	}
+
+	// Upgrade the stored hash if the hashing parameters have changed
+	if h.Hasher.NeedsRehash(user.PasswordHash) {
+		if hash, err := h.Hasher.Hash(req.Password); err == nil {
+			if err := h.Users.UpdateUserPassword(r.Context(), user.ID, hash); err != nil {
+				logging.FromContext(r.Context()).Error("error rehashing password", "err", err)
+			}
+		}
+	}
+
+	// Start a new refresh token family for this login
+	familyID, err := auth.NewTokenFamily()
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	refreshToken, refreshHash, err := auth.NewRefreshToken()
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	_, err = h.Users.CreateRefreshToken(r.Context(), m.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: refreshHash,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	h.respondWithTokens(w, r, user, refreshToken)
+}
+
+// ✅ Handle Refresh Token Rotation
+func (h *AuthHandler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if req.RefreshToken == "" {
+		respondWithError(w, r, apperr.Validation(apperr.FieldError{Field: "refresh_token", Code: "required", Message: "A refresh token is required"}))
+		return
+	}
+
+	refreshToken, refreshHash, err := auth.NewRefreshToken()
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	// Check if the user exists
-	mu.Lock()
-	storedPassword, exists := userStore[req.Username]
-	mu.Unlock()
+	rotated, err := h.Users.RotateRefreshToken(r.Context(), auth.HashRefreshToken(req.RefreshToken), m.RefreshToken{
+		TokenHash: refreshHash,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	})
+	if errors.Is(err, s.ErrRefreshTokenInvalid) || errors.Is(err, s.ErrRefreshTokenReused) {
+		respondWithError(w, r, errInvalidRefreshToken)
+		return
+	} else if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
 
-	if !exists || storedPassword != req.Password {
-		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
+	user, err := h.Users.GetUser(r.Context(), rotated.UserID)
+	if err != nil || user.Disabled {
+		h.Users.RevokeRefreshToken(r.Context(), refreshHash)
+		respondWithError(w, r, errInvalidRefreshToken)
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.JWTManager.Generate(req.Username)
+	h.respondWithTokens(w, r, user, refreshToken)
+}
+
+// ✅ Handle Logout: revoke the presented access token and refresh token family
+func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+	}
+
+	if parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2); len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+		if claims, err := h.JWTManager.Validate(parts[1]); err == nil && h.Revocations != nil {
+			if err := h.Revocations.Revoke(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+				respondWithError(w, r, err)
+				return
+			}
+		}
+	}
+
+	if req.RefreshToken != "" {
+		err := h.Users.RevokeRefreshToken(r.Context(), auth.HashRefreshToken(req.RefreshToken))
+		if err != nil && !errors.Is(err, s.ErrRefreshTokenInvalid) {
+			respondWithError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authResponse{
+		Status: "Logged out successfully",
+	})
+}
+
+// ✅ Publish the public signing keys so other services can verify our tokens
+func (h *AuthHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.JWTManager.Keys().JWKS())
+}
+
+// respondWithTokens issues an access token for user alongside the given refresh token
+func (h *AuthHandler) respondWithTokens(w http.ResponseWriter, r *http.Request, user m.User, refreshToken string) {
+	token, err := h.JWTManager.Generate(auth.Identity{
+		Username:   user.Username,
+		Roles:      user.Roles,
+		CustomerID: user.CustomerID,
+	})
 	if err != nil {
-		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		respondWithError(w, r, err)
 		return
 	}
 
 	// ✅ Return JSON Response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(authResponse{
-		Token: token,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.JWTManager.TokenDuration().Seconds()),
+	})
+}
+
+// ✅ Struct for role assignment requests
+type rolesRequest struct {
+	Roles      []string `json:"roles"`
+	CustomerID int      `json:"customer_id"`
+}
+
+// HandleUserRoles replaces a user's roles and linked customer (PUT /api/users/{id}/roles)
+func (h *AuthHandler) HandleUserRoles(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, r, invalidID("user"))
+		return
+	}
+
+	var req rolesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	var fields []apperr.FieldError
+	if len(req.Roles) == 0 {
+		fields = append(fields, apperr.FieldError{Field: "roles", Code: "required", Message: "At least one role is required"})
+	}
+	for i, role := range req.Roles {
+		if !auth.ValidRole(role) {
+			fields = append(fields, apperr.FieldError{Field: "roles[" + strconv.Itoa(i) + "]", Code: "one_of", Message: "Unknown role"})
+		}
+	}
+	if len(fields) > 0 {
+		respondWithError(w, r, apperr.Validation(fields...))
+		return
+	}
+
+	err = h.Users.SetUserRoles(r.Context(), id, req.Roles, req.CustomerID)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errUserNotFound))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authResponse{
+		Status: "Roles updated successfully",
 	})
 }
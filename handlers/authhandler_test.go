@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"project.com/myproject/auth"
+	m "project.com/myproject/models"
+	"project.com/myproject/stores"
+)
+
+func setupKeyedAuthRouter(t *testing.T) (*mux.Router, *auth.JWTManager) {
+	keys := auth.NewKeySet()
+	rotator := auth.NewKeyRotator(keys, t.TempDir(), auth.AlgES256, 24*time.Hour, time.Hour)
+	if err := rotator.Rotate(); err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	jwtManager := auth.NewJWTManagerWithKeys(keys, time.Hour)
+
+	r := mux.NewRouter()
+	NewAuthHandler(jwtManager, nil, nil).RegisterRoutes(r)
+	return r, jwtManager
+}
+
+func TestHandleJWKS(t *testing.T) {
+	router, jwtManager := setupKeyedAuthRouter(t)
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d", rec.Code)
+	}
+
+	var jwks auth.JWKS
+	if err := json.NewDecoder(rec.Body).Decode(&jwks); err != nil {
+		t.Fatalf("Failed to decode JWKS: %v", err)
+	}
+	active, _ := jwtManager.Keys().Active()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != active.ID || jwks.Keys[0].Kty != "EC" {
+		t.Fatalf("Expected one EC key with kid %s, got %+v", active.ID, jwks.Keys)
+	}
+}
+
+func TestValidate_RejectsAlgorithmMismatch(t *testing.T) {
+	_, jwtManager := setupKeyedAuthRouter(t)
+	active, _ := jwtManager.Keys().Active()
+
+	// An HS256 token claiming the ES256 key's kid must not validate
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{Username: "attacker"})
+	token.Header["kid"] = active.ID
+	forged, _ := token.SignedString([]byte("guessed-secret"))
+
+	if _, err := jwtManager.Validate(forged); err == nil {
+		t.Fatalf("Expected forged token to be rejected")
+	}
+
+	valid, _ := jwtManager.Generate(auth.Identity{Username: "testuser"})
+	if _, err := jwtManager.Validate(valid); err != nil {
+		t.Fatalf("Expected signed token to validate, got %v", err)
+	}
+}
+
+func TestValidate_AcceptsRetiredKeyDuringGrace(t *testing.T) {
+	keys := auth.NewKeySet()
+	rotator := auth.NewKeyRotator(keys, t.TempDir(), auth.AlgEdDSA, 24*time.Hour, time.Hour)
+	if err := rotator.Rotate(); err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	jwtManager := auth.NewJWTManagerWithKeys(keys, time.Hour)
+	oldToken, _ := jwtManager.Generate(auth.Identity{Username: "testuser"})
+
+	if err := rotator.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate signing key: %v", err)
+	}
+
+	if _, err := jwtManager.Validate(oldToken); err != nil {
+		t.Fatalf("Expected token signed with retired key to validate, got %v", err)
+	}
+}
+
+// unavailableUsers fails user lookups like a database that is down.
+type unavailableUsers struct {
+	*stores.MemoryStore
+}
+
+func (unavailableUsers) GetUserByUsername(ctx context.Context, username string) (m.User, error) {
+	return m.User{}, errors.New("connection refused")
+}
+
+func TestHandleLogin_StoreErrorsAreNotInvalidCredentials(t *testing.T) {
+	login := func(users stores.AuthStore) *httptest.ResponseRecorder {
+		r := mux.NewRouter()
+		NewAuthHandler(auth.NewJWTManager("your_secret_key", time.Hour), users, nil).RegisterRoutes(r)
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"username":"nobody","password":"secret-password"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := login(stores.NewMemoryStore()); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown user: status %d, want 401", rec.Code)
+	}
+	if rec := login(unavailableUsers{stores.NewMemoryStore()}); rec.Code != http.StatusInternalServerError {
+		t.Errorf("store error: status %d, want 500: %s", rec.Code, rec.Body)
+	}
+}
@@ -3,26 +3,26 @@ package handlers
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gorilla/mux"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
+	"project.com/myproject/internal/validate"
 	m "project.com/myproject/models"
 )
 
 // ✅ Handle Authors with Goroutines and Cancellation
 func (h *Handler) HandleAuthors(w http.ResponseWriter, r *http.Request) {
 	// Set a request timeout of 5 seconds
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		log.Println("❌ Request cancelled")
-		http.Error(w, "Request cancelled", http.StatusRequestTimeout)
+		logging.FromContext(ctx).Warn("request cancelled", "err", ctx.Err())
+		respondWithError(w, r, errRequestCancelled)
 		return
 	default:
 		switch r.Method {
@@ -38,98 +38,187 @@ func (h *Handler) HandleAuthors(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPost:
 			h.handleCreateAuthor(ctx, w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			respondWithError(w, r, apperr.ErrMethodNotAllowed)
 		}
 	}
 }
 
 func (h *Handler) HandleAuthor(w http.ResponseWriter, r *http.Request) {
 	// Set a request timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		log.Println("❌ Request cancelled")
-		http.Error(w, "Request cancelled", http.StatusRequestTimeout)
+		logging.FromContext(ctx).Warn("request cancelled", "err", ctx.Err())
+		respondWithError(w, r, errRequestCancelled)
 		return
 	default:
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+			respondWithError(w, r, invalidID("author"))
 			return
 		}
 
 		switch r.Method {
 		case http.MethodGet:
-			h.handleGetAuthor(ctx, w, id, w)
+			h.handleGetAuthor(ctx, w, r, id)
 		case http.MethodPut:
 			h.handleUpdateAuthor(ctx, w, r, id)
+		case http.MethodPatch:
+			h.handlePatchAuthor(ctx, w, r, id)
 		case http.MethodDelete:
-			h.handleDeleteAuthor(ctx, w, id, w)
+			h.handleDeleteAuthor(ctx, w, r, id)
 		default:
-			h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			respondWithError(w, r, apperr.ErrMethodNotAllowed)
 		}
 	}
 }
 
 // CRUD operations for Authors
 func (h *Handler) handleGetAllAuthors(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	authors, err := h.Store.GetAllAuthors(ctx) // ✅ Now uses context
+	params, err := parseListParams(r)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve authors")
+		respondWithError(w, r, err)
 		return
 	}
+
+	authors, err := h.Store.GetAllAuthors(ctx, params) // ✅ Now uses context
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	setNextLink(w, r, authors.NextCursor)
 	h.respondWithJSON(w, http.StatusOK, authors)
 }
 
-func (h *Handler) handleGetAuthor(ctx context.Context, w http.ResponseWriter, id int, res http.ResponseWriter) {
+func (h *Handler) handleGetAuthor(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
 	author, err := h.Store.GetAuthor(ctx, id)
 	if err != nil {
-		h.respondWithError(res, http.StatusNotFound, "Author not found")
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
 		return
 	}
-	h.respondWithJSON(res, http.StatusOK, author)
+	respondWithEntity(w, r, author)
 }
 
 func (h *Handler) handleCreateAuthor(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	var author m.Author
-	if err := json.NewDecoder(r.Body).Decode(&author); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if err := decodeJSON(r, &author); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if err := validate.Error(validate.Struct(author)); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
 	newAuthor, err := h.Store.CreateAuthor(ctx, author) // ✅ Now uses context
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to create author")
+		respondWithError(w, r, err)
 		return
 	}
 	h.respondWithJSON(w, http.StatusCreated, newAuthor)
 }
 
 func (h *Handler) handleUpdateAuthor(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetAuthor(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var author m.Author
+	if err := decodeJSON(r, &author); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if err := validate.Error(validate.Struct(author)); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	author.Version = current.Version
+	err = h.Store.UpdateAuthor(ctx, id, author) // ✅ Now uses context
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
+		return
+	}
+	updated, err := h.Store.GetAuthor(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
+		return
+	}
+	respondWithEntity(w, r, updated)
+}
+
+// handlePatchAuthor applies a merge patch or JSON Patch to an author and
+// writes only the fields it touched.
+func (h *Handler) handlePatchAuthor(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetAuthor(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
 	var author m.Author
-	if err := json.NewDecoder(r.Body).Decode(&author); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	fields, err := applyPatch(w, r, current, &author, "first_name", "last_name", "bio")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if err := validate.Error(validate.Struct(author)); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	err := h.Store.UpdateAuthor(ctx, id, author) // ✅ Now uses context
+	patch := m.AuthorPatch{Version: current.Version}
+	if fields["first_name"] {
+		patch.FirstName = &author.FirstName
+	}
+	if fields["last_name"] {
+		patch.LastName = &author.LastName
+	}
+	if fields["bio"] {
+		patch.Bio = &author.Bio
+	}
+	if err := h.Store.PatchAuthor(ctx, id, patch); err != nil {
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
+		return
+	}
+	updated, err := h.Store.GetAuthor(ctx, id)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to update author")
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
 		return
 	}
-	h.respondWithJSON(w, http.StatusOK, "Author updated successfully")
+	respondWithEntity(w, r, updated)
 }
 
-func (h *Handler) handleDeleteAuthor(ctx context.Context, w http.ResponseWriter, id int, res http.ResponseWriter) {
-	err := h.Store.DeleteAuthor(ctx, id) // ✅ Now uses context
+func (h *Handler) handleDeleteAuthor(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetAuthor(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = h.Store.DeleteAuthor(ctx, id, current.Version) // ✅ Now uses context
 	if err != nil {
-		h.respondWithError(res, http.StatusInternalServerError, "Failed to delete author")
+		respondWithError(w, r, orNotFound(err, errAuthorNotFound))
 		return
 	}
-	h.respondWithJSON(res, http.StatusOK, "Author deleted successfully")
+	h.respondWithJSON(w, http.StatusOK, "Author deleted successfully")
 }
 
 func (h *Handler) handleSearchAuthors(ctx context.Context, w http.ResponseWriter, r *http.Request) {
@@ -138,14 +227,21 @@ func (h *Handler) handleSearchAuthors(ctx context.Context, w http.ResponseWriter
 		LastName:  r.URL.Query().Get("last_name"),
 	}
 
-	authors, err := h.Store.SearchAuthors(ctx, criteria)
+	params, err := parseListParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	authors, err := h.Store.SearchAuthors(ctx, criteria, params)
 	if err == sql.ErrNoRows {
-		h.respondWithError(w, http.StatusNotFound, "No authors found")
+		respondWithError(w, r, noResults("authors"))
 		return
 	} else if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to search authors")
+		respondWithError(w, r, err)
 		return
 	}
 
+	setNextLink(w, r, authors.NextCursor)
 	h.respondWithJSON(w, http.StatusOK, authors)
 }
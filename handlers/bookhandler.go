@@ -4,25 +4,42 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
-	"project.com/myproject/internal/cache" // Import cache package
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/cache"
+	"project.com/myproject/internal/logging"
 	m "project.com/myproject/models"
 )
 
+// bookCacheTTL is how long book responses stay cached.
+const bookCacheTTL = 10 * time.Minute
+
+// bookTags returns the cache tags of a response containing books. Lists add
+// cache.BooksTag since any new or changed book may belong in them.
+func bookTags(books ...m.Book) []string {
+	var tags []string
+	for _, book := range books {
+		tags = append(tags, cache.BookTag(book.ID), cache.AuthorTag(book.Author.ID))
+		for _, genre := range book.Genres {
+			tags = append(tags, cache.GenreTag(genre))
+		}
+	}
+	return tags
+}
+
 // Handle Books
 func (h *Handler) HandleBooks(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		log.Println("❌ Request cancelled")
-		http.Error(w, "Request cancelled", http.StatusRequestTimeout)
+		logging.FromContext(ctx).Warn("request cancelled", "err", ctx.Err())
+		respondWithError(w, r, errRequestCancelled)
 		return
 	default:
 		switch r.Method {
@@ -41,40 +58,43 @@ func (h *Handler) HandleBooks(w http.ResponseWriter, r *http.Request) {
 			h.handleCreateBook(ctx, w, r)
 
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			respondWithError(w, r, apperr.ErrMethodNotAllowed)
 		}
 	}
 }
 
 func (h *Handler) HandleBook(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		log.Println("❌ Request cancelled")
-		http.Error(w, "Request cancelled", http.StatusRequestTimeout)
+		logging.FromContext(ctx).Warn("request cancelled", "err", ctx.Err())
+		respondWithError(w, r, errRequestCancelled)
 		return
 	default:
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid book ID")
+			respondWithError(w, r, invalidID("book"))
 			return
 		}
 
 		switch r.Method {
 		case http.MethodGet:
-			h.handleGetBook(ctx, w, id, w)
+			h.handleGetBook(ctx, w, r, id)
 
 		case http.MethodPut:
 			h.handleUpdateBook(ctx, w, r, id)
 
+		case http.MethodPatch:
+			h.handlePatchBook(ctx, w, r, id)
+
 		case http.MethodDelete:
-			h.handleDeleteBook(ctx, w, id, w)
+			h.handleDeleteBook(ctx, w, r, id)
 
 		default:
-			h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			respondWithError(w, r, apperr.ErrMethodNotAllowed)
 		}
 	}
 }
@@ -86,119 +106,225 @@ func (h *Handler) respondWithJSON(w http.ResponseWriter, status int, data interf
 	json.NewEncoder(w).Encode(data)
 }
 
-// respondWithError writes an error message as JSON to the response writer
-func (h *Handler) respondWithError(w http.ResponseWriter, status int, message string) {
-	h.respondWithJSON(w, status, map[string]string{"error": message})
-}
-
-// Modify handleGetAllBooks to use caching
+// handleGetAllBooks serves the default first page from the cache; other
+// pages go straight to the store.
 func (h *Handler) handleGetAllBooks(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	cacheKey := "all_books"
-
-	// Check Redis cache
-	cachedData, err := cache.GetCache(cacheKey)
-	if err == nil {
-		log.Println("✅ Cache hit: Returning books from Redis")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(cachedData))
+	params, err := parseListParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	// If cache miss, fetch from DB
-	books, err := h.Store.GetAllBooks(ctx)
-	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve books")
+	if !isDefaultListParams(params) {
+		books, err := h.Store.GetAllBooks(ctx, params)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+		setNextLink(w, r, books.NextCursor)
+		respondWithEntity(w, r, books)
 		return
 	}
 
-	// Store result in cache for 10 minutes
-	jsonData, _ := json.Marshal(books)
-	cache.SetCache(cacheKey, string(jsonData), 10*time.Minute)
-
-	h.respondWithJSON(w, http.StatusOK, books)
+	data, etag, err := h.Cache.LoadWithETag(ctx, "all_books", bookCacheTTL, func(ctx context.Context) ([]byte, []string, error) {
+		books, err := h.Store.GetAllBooks(ctx, params)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := json.Marshal(books)
+		return data, append(bookTags(books.Data...), cache.BooksTag), err
+	})
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	writeBookPage(w, r, data, etag)
 }
 
-// Modify handleGetBook to use caching
-func (h *Handler) handleGetBook(ctx context.Context, w http.ResponseWriter, id int, res http.ResponseWriter) {
-	cacheKey := "book:" + strconv.Itoa(id)
+// cachedBook is the cache entry of a single book: its JSON and the row
+// version its ETag is made from, which the JSON does not include.
+type cachedBook struct {
+	Version int             `json:"version"`
+	Book    json.RawMessage `json:"book"`
+}
 
-	// Check Redis cache
-	cachedData, err := cache.GetCache(cacheKey)
-	if err == nil {
-		log.Println("✅ Cache hit: Returning book from Redis")
-		res.Header().Set("Content-Type", "application/json")
-		res.Write([]byte(cachedData))
+// handleGetBook serves a book from the cache; unknown IDs are cached too. The
+// cached version lets a cache hit answer If-None-Match without the store.
+func (h *Handler) handleGetBook(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	data, _, err := h.Cache.LoadWithETag(ctx, "versioned_book:"+strconv.Itoa(id), bookCacheTTL, func(ctx context.Context) ([]byte, []string, error) {
+		book, err := h.Store.GetBook(ctx, id)
+		if err == sql.ErrNoRows {
+			return nil, []string{cache.BookTag(id)}, cache.ErrNotFound
+		} else if err != nil {
+			return nil, nil, err
+		}
+		data, err := json.Marshal(book)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err = json.Marshal(cachedBook{Version: book.Version, Book: data})
+		return data, bookTags(book), err
+	})
+	if err == cache.ErrNotFound {
+		respondWithError(w, r, errBookNotFound)
+		return
+	} else if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
-
-	// If cache miss, fetch from DB
-	book, err := h.Store.GetBook(ctx, id)
-	if err != nil {
-		h.respondWithError(res, http.StatusNotFound, "Book not found")
+	var cached cachedBook
+	if err := json.Unmarshal(data, &cached); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
+	writeEntity(w, r, cached.Book, versionETag(cached.Version))
+}
 
-	// Store result in cache for 10 minutes
-	jsonData, _ := json.Marshal(book)
-	cache.SetCache(cacheKey, string(jsonData), 10*time.Minute)
-
-	h.respondWithJSON(res, http.StatusOK, book)
+// writeBookPage writes a serialized page of books and its Link header.
+func writeBookPage(w http.ResponseWriter, r *http.Request, data []byte, etag string) {
+	var page struct {
+		NextCursor string `json:"next_cursor"`
+	}
+	if json.Unmarshal(data, &page) == nil {
+		setNextLink(w, r, page.NextCursor)
+	}
+	writeEntity(w, r, data, etag)
 }
 
-// Modify handleCreateBook to invalidate cache
+// handleCreateBook creates a book; the store invalidates cached book lists
 func (h *Handler) handleCreateBook(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	var book m.Book
-	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if err := decodeJSON(r, &book); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if err := h.validateBook(ctx, book); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
 	newBook, err := h.Store.CreateBook(ctx, book)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to create book")
+		respondWithError(w, r, err)
 		return
 	}
 
-	// Invalidate book list cache
-	cache.DeleteCache("all_books")
-
 	h.respondWithJSON(w, http.StatusCreated, newBook)
 }
 
-// Modify handleUpdateBook to invalidate cache
+// handleUpdateBook updates a book if it still matches If-Match; the store
+// invalidates cached entries containing it
 func (h *Handler) handleUpdateBook(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetBook(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errBookNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
 	var book m.Book
-	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if err := decodeJSON(r, &book); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
+	if err := h.validateBook(ctx, book); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	book.Version = current.Version
+	err = h.Store.UpdateBook(ctx, id, book)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errBookNotFound))
+		return
+	}
+
+	updated, err := h.Store.GetBook(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errBookNotFound))
+		return
+	}
+	respondWithEntity(w, r, updated)
+}
 
-	err := h.Store.UpdateBook(ctx, id, book)
+// handlePatchBook applies a merge patch or JSON Patch to a book and writes
+// only the fields it touched; genres are relinked only if the patch sets them.
+func (h *Handler) handlePatchBook(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetBook(ctx, id)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to update book")
+		respondWithError(w, r, orNotFound(err, errBookNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	// Invalidate both individual book and book list cache
-	cache.DeleteCache("book:" + strconv.Itoa(id))
-	cache.DeleteCache("all_books")
+	var book m.Book
+	fields, err := applyPatch(w, r, current, &book, "title", "author", "genres", "published_at", "price", "stock")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if err := h.validateBook(ctx, book); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
 
-	h.respondWithJSON(w, http.StatusOK, "Book updated successfully")
+	patch := m.BookPatch{Version: current.Version}
+	if fields["title"] {
+		patch.Title = &book.Title
+	}
+	if fields["author"] {
+		patch.AuthorID = &book.Author.ID
+	}
+	if fields["genres"] {
+		patch.Genres = &book.Genres
+	}
+	if fields["published_at"] {
+		patch.PublishedAt = &book.PublishedAt
+	}
+	if fields["price"] {
+		patch.Price = &book.Price
+	}
+	if fields["stock"] {
+		patch.Stock = &book.Stock
+	}
+	if err := h.Store.PatchBook(ctx, id, patch); err != nil {
+		respondWithError(w, r, orNotFound(err, errBookNotFound))
+		return
+	}
+
+	updated, err := h.Store.GetBook(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errBookNotFound))
+		return
+	}
+	respondWithEntity(w, r, updated)
 }
 
-// Modify handleDeleteBook to invalidate cache
-func (h *Handler) handleDeleteBook(ctx context.Context, w http.ResponseWriter, id int, res http.ResponseWriter) {
-	err := h.Store.DeleteBook(ctx, id)
+// handleDeleteBook deletes a book; the store invalidates cached entries containing it
+func (h *Handler) handleDeleteBook(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetBook(ctx, id)
 	if err != nil {
-		h.respondWithError(res, http.StatusInternalServerError, "Failed to delete book")
+		respondWithError(w, r, orNotFound(err, errBookNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	// Invalidate both individual book and book list cache
-	cache.DeleteCache("book:" + strconv.Itoa(id))
-	cache.DeleteCache("all_books")
+	err = h.Store.DeleteBook(ctx, id, current.Version)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errBookNotFound))
+		return
+	}
 
-	h.respondWithJSON(res, http.StatusOK, "Book deleted successfully")
+	h.respondWithJSON(w, http.StatusOK, "Book deleted successfully")
 }
 
 // Modify handleSearchBooks to use caching
@@ -215,27 +341,26 @@ func (h *Handler) handleSearchBooks(ctx context.Context, w http.ResponseWriter,
 	if minPriceStr != "" {
 		minPrice, err = strconv.ParseFloat(minPriceStr, 64)
 		if err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid min_price")
+			respondWithError(w, r, apperr.BadRequest("invalid_min_price", "Invalid min_price"))
 			return
 		}
 	}
 	if maxPriceStr != "" {
 		maxPrice, err = strconv.ParseFloat(maxPriceStr, 64)
 		if err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid max_price")
+			respondWithError(w, r, apperr.BadRequest("invalid_max_price", "Invalid max_price"))
 			return
 		}
 	}
 
-	cacheKey := "search_books:" + title + ":" + authorFirstName + ":" + authorName
-	cachedData, err := cache.GetCache(cacheKey)
-	if err == nil {
-		log.Println("✅ Cache hit: Returning search results from Redis")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(cachedData))
+	params, err := parseListParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
+	cacheKey := "search_books:" + title + ":" + authorFirstName + ":" + authorName + ":" + minPriceStr + ":" + maxPriceStr +
+		":" + r.URL.Query().Get("limit") + ":" + r.URL.Query().Get("sort") + ":" + params.Cursor
 	criteria := m.SearchCriteriaBooks{
 		Title:           title,
 		AuthorFirstName: authorFirstName,
@@ -244,17 +369,23 @@ func (h *Handler) handleSearchBooks(ctx context.Context, w http.ResponseWriter,
 		MaxPrice:        maxPrice,
 	}
 
-	books, err := h.Store.SearchBooks(ctx, criteria)
-	if err == sql.ErrNoRows {
-		h.respondWithError(w, http.StatusNotFound, "No books found")
+	// Empty results are cached as well; any book change invalidates them
+	data, etag, err := h.Cache.LoadWithETag(ctx, cacheKey, bookCacheTTL, func(ctx context.Context) ([]byte, []string, error) {
+		books, err := h.Store.SearchBooks(ctx, criteria, params)
+		if err == sql.ErrNoRows {
+			return nil, []string{cache.BooksTag}, cache.ErrNotFound
+		} else if err != nil {
+			return nil, nil, err
+		}
+		data, err := json.Marshal(books)
+		return data, append(bookTags(books.Data...), cache.BooksTag), err
+	})
+	if err == cache.ErrNotFound {
+		respondWithError(w, r, noResults("books"))
 		return
 	} else if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to search books")
+		respondWithError(w, r, err)
 		return
 	}
-
-	jsonData, _ := json.Marshal(books)
-	cache.SetCache(cacheKey, string(jsonData), 10*time.Minute)
-
-	h.respondWithJSON(w, http.StatusOK, books)
+	writeBookPage(w, r, data, etag)
 }
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/cache"
+	m "project.com/myproject/models"
+)
+
+var (
+	errIfMatchRequired = apperr.New(apperr.KindPreconditionRequired, "if_match_required",
+		"Send the resource's ETag in an If-Match header")
+	errETagMismatch = apperr.New(apperr.KindPreconditionFailed, "etag_mismatch",
+		"The resource has changed since it was read")
+)
+
+// checkIfMatch checks the If-Match header of a PUT, PATCH or DELETE against
+// the ETag current is served with. The header is required so that no write
+// can silently overwrite a change the client has not seen.
+func checkIfMatch(r *http.Request, current any) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return errIfMatchRequired
+	}
+	etag, ok := entityETag(current)
+	if !ok {
+		data, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		etag = cache.ETag(data)
+	}
+	if !etagListed(header, etag, false) {
+		return errETagMismatch
+	}
+	return nil
+}
+
+// entityETag returns the ETag of a book, author, customer or order, which is
+// derived from its row version rather than its JSON. Records embedded in it,
+// like the stock of an order item's book, have versions of their own, so
+// writes to them do not fail an If-Match on the record.
+func entityETag(v any) (string, bool) {
+	switch e := v.(type) {
+	case m.Book:
+		return versionETag(e.Version), true
+	case m.Author:
+		return versionETag(e.Version), true
+	case m.Customer:
+		return versionETag(e.Version), true
+	case m.Order:
+		return versionETag(e.Version), true
+	}
+	return "", false
+}
+
+// versionETag formats a row version as a strong ETag.
+func versionETag(version int) string {
+	return `"v` + strconv.Itoa(version) + `"`
+}
+
+// etagListed reports whether an If-Match or If-None-Match header lists etag
+// or is "*". If-None-Match uses the weak comparison, which ignores the W/
+// prefix; If-Match uses the strong one, which never matches a weak tag.
+func etagListed(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEntity writes a serialized JSON representation with its ETag, or 304
+// Not Modified if a GET's If-None-Match lists the ETag.
+func writeEntity(w http.ResponseWriter, r *http.Request, data []byte, etag string) {
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		etagListed(match, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// respondWithEntity writes v as JSON with its ETag, see entityETag, or the
+// hash of the JSON for other values; see writeEntity.
+func respondWithEntity(w http.ResponseWriter, r *http.Request, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	etag, ok := entityETag(v)
+	if !ok {
+		etag = cache.ETag(data)
+	}
+	writeEntity(w, r, data, etag)
+}
@@ -3,26 +3,26 @@ package handlers
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gorilla/mux"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
+	"project.com/myproject/internal/validate"
 	m "project.com/myproject/models"
 )
 
 // Handle Customers
 func (h *Handler) HandleCustomers(w http.ResponseWriter, r *http.Request) {
 	// Set a request timeout of 5 seconds
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		log.Println("❌ Request cancelled")
-		http.Error(w, "Request cancelled", http.StatusRequestTimeout)
+		logging.FromContext(ctx).Warn("request cancelled", "err", ctx.Err())
+		respondWithError(w, r, errRequestCancelled)
 		return
 	default:
 		switch r.Method {
@@ -38,96 +38,203 @@ func (h *Handler) HandleCustomers(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPost:
 			h.handleCreateCustomer(ctx, w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			respondWithError(w, r, apperr.ErrMethodNotAllowed)
 		}
 	}
 }
 
 func (h *Handler) HandleCustomer(w http.ResponseWriter, r *http.Request) {
 	// Set a request timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		log.Println("❌ Request cancelled")
-		http.Error(w, "Request cancelled", http.StatusRequestTimeout)
+		logging.FromContext(ctx).Warn("request cancelled", "err", ctx.Err())
+		respondWithError(w, r, errRequestCancelled)
 		return
 	default:
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid customer ID")
+			respondWithError(w, r, invalidID("customer"))
 			return
 		}
 
 		switch r.Method {
 		case http.MethodGet:
-			h.handleGetCustomer(ctx, w, id, w)
+			h.handleGetCustomer(ctx, w, r, id)
 		case http.MethodPut:
 			h.handleUpdateCustomer(ctx, w, r, id)
+		case http.MethodPatch:
+			h.handlePatchCustomer(ctx, w, r, id)
 		case http.MethodDelete:
-			h.handleDeleteCustomer(ctx, w, id, w)
+			h.handleDeleteCustomer(ctx, w, r, id)
 		default:
-			h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			respondWithError(w, r, apperr.ErrMethodNotAllowed)
 		}
 	}
 }
 
 // CRUD operations for Customers
 func (h *Handler) handleGetAllCustomers(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	customers, err := h.Store.GetAllCustomers(ctx)
+	params, err := parseListParams(r)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve customers")
+		respondWithError(w, r, err)
 		return
 	}
+
+	customers, err := h.Store.GetAllCustomers(ctx, params)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	setNextLink(w, r, customers.NextCursor)
 	h.respondWithJSON(w, http.StatusOK, customers)
 }
 
-func (h *Handler) handleGetCustomer(ctx context.Context, w http.ResponseWriter, id int, res http.ResponseWriter) {
+func (h *Handler) handleGetCustomer(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
 	customer, err := h.Store.GetCustomer(ctx, id)
 	if err != nil {
-		h.respondWithError(res, http.StatusNotFound, "Customer not found")
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
 		return
 	}
-	h.respondWithJSON(res, http.StatusOK, customer)
+	respondWithEntity(w, r, customer)
 }
 
+// handleCreateCustomer creates a customer. Country codes are accepted as
+// alpha-2 or alpha-3 in any case and stored as upper-case alpha-2.
 func (h *Handler) handleCreateCustomer(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	var customer m.Customer
-	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if err := decodeJSON(r, &customer); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
+	if err := validate.Error(validate.Struct(customer)); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	customer.Country = validate.Country(customer.Country)
 	newCustomer, err := h.Store.CreateCustomer(ctx, customer)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to create customer")
+		respondWithError(w, r, err)
 		return
 	}
 	h.respondWithJSON(w, http.StatusCreated, newCustomer)
 }
 
 func (h *Handler) handleUpdateCustomer(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetCustomer(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var customer m.Customer
+	if err := decodeJSON(r, &customer); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if err := validate.Error(validate.Struct(customer)); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	customer.Country = validate.Country(customer.Country)
+	customer.Version = current.Version
+	err = h.Store.UpdateCustomer(ctx, id, customer)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
+		return
+	}
+	updated, err := h.Store.GetCustomer(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
+		return
+	}
+	respondWithEntity(w, r, updated)
+}
+
+// handlePatchCustomer applies a merge patch or JSON Patch to a customer and
+// writes only the fields it touched.
+func (h *Handler) handlePatchCustomer(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetCustomer(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
 	var customer m.Customer
-	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	fields, err := applyPatch(w, r, current, &customer,
+		"name", "email", "street", "city", "state", "postal_code", "country")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	if err := validate.Error(validate.Struct(customer)); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
-	err := h.Store.UpdateCustomer(ctx, id, customer)
+	customer.Country = validate.Country(customer.Country)
+
+	patch := m.CustomerPatch{Version: current.Version}
+	if fields["name"] {
+		patch.Name = &customer.Name
+	}
+	if fields["email"] {
+		patch.Email = &customer.Email
+	}
+	if fields["street"] {
+		patch.Street = &customer.Street
+	}
+	if fields["city"] {
+		patch.City = &customer.City
+	}
+	if fields["state"] {
+		patch.State = &customer.State
+	}
+	if fields["postal_code"] {
+		patch.PostalCode = &customer.PostalCode
+	}
+	if fields["country"] {
+		patch.Country = &customer.Country
+	}
+	if err := h.Store.PatchCustomer(ctx, id, patch); err != nil {
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
+		return
+	}
+	updated, err := h.Store.GetCustomer(ctx, id)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to update customer")
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
 		return
 	}
-	h.respondWithJSON(w, http.StatusOK, "Customer updated successfully")
+	respondWithEntity(w, r, updated)
 }
 
-func (h *Handler) handleDeleteCustomer(ctx context.Context, w http.ResponseWriter, id int, res http.ResponseWriter) {
-	err := h.Store.DeleteCustomer(ctx, id)
+func (h *Handler) handleDeleteCustomer(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetCustomer(ctx, id)
 	if err != nil {
-		h.respondWithError(res, http.StatusInternalServerError, "Failed to delete customer")
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
 		return
 	}
-	h.respondWithJSON(res, http.StatusOK, "Customer deleted successfully")
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = h.Store.DeleteCustomer(ctx, id, current.Version)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errCustomerNotFound))
+		return
+	}
+	h.respondWithJSON(w, http.StatusOK, "Customer deleted successfully")
 }
 
 func (h *Handler) handleSearchCustomers(ctx context.Context, w http.ResponseWriter, r *http.Request) {
@@ -136,14 +243,21 @@ func (h *Handler) handleSearchCustomers(ctx context.Context, w http.ResponseWrit
 		Email: r.URL.Query().Get("email"),
 	}
 
-	customers, err := h.Store.SearchCustomers(ctx, criteria)
+	params, err := parseListParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	customers, err := h.Store.SearchCustomers(ctx, criteria, params)
 	if err == sql.ErrNoRows {
-		h.respondWithError(w, http.StatusNotFound, "No customers found")
+		respondWithError(w, r, noResults("customers"))
 		return
 	} else if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to search customers")
+		respondWithError(w, r, err)
 		return
 	}
 
+	setNextLink(w, r, customers.NextCursor)
 	h.respondWithJSON(w, http.StatusOK, customers)
 }
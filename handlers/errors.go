@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+
+	"project.com/myproject/internal/apperr"
+)
+
+var (
+	errRequestCancelled = apperr.New(apperr.KindTimeout, "request_cancelled", "Request cancelled")
+
+	errBookNotFound     = apperr.NotFound("book_not_found", "Book not found")
+	errAuthorNotFound   = apperr.NotFound("author_not_found", "Author not found")
+	errCustomerNotFound = apperr.NotFound("customer_not_found", "Customer not found")
+	errOrderNotFound    = apperr.NotFound("order_not_found", "Order not found")
+	errUserNotFound     = apperr.NotFound("user_not_found", "User not found")
+
+	errNoLinkedCustomer = apperr.Forbidden("no_linked_customer", "User is not linked to a customer")
+)
+
+// invalidID reports a path ID that is not a number.
+func invalidID(resource string) error {
+	return apperr.BadRequest("invalid_id", "Invalid "+resource+" ID")
+}
+
+// noResults reports a search that matched nothing.
+func noResults(what string) error {
+	return apperr.NotFound("no_results", "No "+what+" found")
+}
+
+// orNotFound returns notFound if err is sql.ErrNoRows and err otherwise.
+func orNotFound(err, notFound error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	return err
+}
+
+// respondWithError writes err as an application/problem+json response.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	apperr.Write(w, r, err)
+}
+
+// decodeJSON decodes the request body into v. Malformed JSON is a bad
+// request; a value of the wrong type is a validation error on its field.
+func decodeJSON(r *http.Request, v any) error {
+	return decodeError(json.NewDecoder(r.Body).Decode(v))
+}
+
+// decodeError maps a JSON decoding error to the error reported to clients.
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, io.EOF):
+		return apperr.BadRequest("empty_body", "The request body is empty")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return apperr.Validation(apperr.FieldError{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: "Must be " + jsonType(typeErr.Type),
+		})
+	default:
+		return apperr.BadRequest("malformed_json", "The request body is not valid JSON").Wrap(err)
+	}
+}
+
+// jsonType names the JSON type a Go type is decoded from.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -1,13 +1,21 @@
 package handlers
 
 import (
+	"time"
+
+	"project.com/myproject/internal/cache"
 	s "project.com/myproject/stores"
 )
 
+// DefaultRequestTimeout bounds the store calls made for one request.
+const DefaultRequestTimeout = 5 * time.Second
+
 type Handler struct {
-	Store *s.PostgresStore
+	Store          s.Store
+	Cache          *cache.Loader
+	RequestTimeout time.Duration
 }
 
-func NewHandler(store *s.PostgresStore) *Handler {
-	return &Handler{Store: store}
+func NewHandler(store s.Store, c *cache.Loader) *Handler {
+	return &Handler{Store: store, Cache: c, RequestTimeout: DefaultRequestTimeout}
 }
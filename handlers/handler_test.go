@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"project.com/myproject/internal/cache"
+	m "project.com/myproject/models"
+	"project.com/myproject/stores"
+)
+
+// newTestStore returns an in-memory store seeded with author 1, book 1 and
+// customer 1 so handler tests run without Postgres or Redis.
+func newTestStore(t *testing.T) *stores.MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	store := stores.NewMemoryStore()
+
+	author, err := store.CreateAuthor(ctx, m.Author{FirstName: "Ursula", LastName: "Le Guin", Bio: "Author of Earthsea."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.CreateBook(ctx, m.Book{
+		Title:       "A Wizard of Earthsea",
+		Author:      author,
+		Genres:      []string{"Fantasy"},
+		PublishedAt: time.Date(1968, 11, 1, 0, 0, 0, 0, time.UTC),
+		Price:       39.99,
+		Stock:       10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.CreateCustomer(ctx, m.Customer{
+		Name:       "John Doe",
+		Email:      "john@example.com",
+		Street:     "123 Main St",
+		City:       "Springfield",
+		State:      "IL",
+		PostalCode: "62701",
+		Country:    "USA",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// currentETag returns the ETag a GET of path is served with.
+func currentETag(t *testing.T, r http.Handler, path string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET %s: status %d, ETag %q", path, rec.Code, etag)
+	}
+	return etag
+}
+
+// newTestHandler returns a Handler over store with a local cache, invalidated
+// through the store like in production.
+func newTestHandler(store stores.Store) *Handler {
+	loader := cache.NewLoader(cache.NewLRU(100))
+	return NewHandler(stores.NewInvalidatingStore(store, loader), loader)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Business metrics, counted when the API accepts the change.
+var (
+	ordersCreated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "orders_created_total",
+			Help: "Total number of orders placed",
+		},
+	)
+	ordersRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "orders_rejected_total",
+			Help: "Total number of orders refused by the store",
+		},
+		[]string{"reason"},
+	)
+	orderRevenue = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_revenue_total",
+			Help: "Total price of placed orders, including tax",
+		},
+	)
+	orderItemsSold = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "order_items_sold_total",
+			Help: "Total number of book copies in placed orders",
+		},
+	)
+	orderTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "order_status_transitions_total",
+			Help: "Total number of order status changes by new status",
+		},
+		[]string{"status"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(ordersCreated, ordersRejected, orderRevenue, orderItemsSold, orderTransitions)
+}
@@ -3,26 +3,28 @@ package handlers
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gorilla/mux"
+	"project.com/myproject/auth"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
 	m "project.com/myproject/models"
+	s "project.com/myproject/stores"
 )
 
 // Handle Orders
 func (h *Handler) HandleOrders(w http.ResponseWriter, r *http.Request) {
 	// Set a request timeout of 5 seconds
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		log.Println("❌ Request cancelled")
-		http.Error(w, "Request cancelled", http.StatusRequestTimeout)
+		logging.FromContext(ctx).Warn("request cancelled", "err", ctx.Err())
+		respondWithError(w, r, errRequestCancelled)
 		return
 	default:
 		switch r.Method {
@@ -38,126 +40,426 @@ func (h *Handler) HandleOrders(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPost:
 			h.handleCreateOrder(ctx, w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			respondWithError(w, r, apperr.ErrMethodNotAllowed)
 		}
 	}
 }
 
 func (h *Handler) HandleOrder(w http.ResponseWriter, r *http.Request) {
 	// Set a request timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
 	defer cancel()
 
 	select {
 	case <-ctx.Done():
-		log.Println("❌ Request cancelled")
-		http.Error(w, "Request cancelled", http.StatusRequestTimeout)
+		logging.FromContext(ctx).Warn("request cancelled", "err", ctx.Err())
+		respondWithError(w, r, errRequestCancelled)
 		return
 	default:
 		vars := mux.Vars(r)
 		id, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			h.respondWithError(w, http.StatusBadRequest, "Invalid order ID")
+			respondWithError(w, r, invalidID("order"))
 			return
 		}
 
 		switch r.Method {
 		case http.MethodGet:
-			h.handleGetOrder(ctx, w, id, w)
+			h.handleGetOrder(ctx, w, r, id)
 		case http.MethodPut:
 			h.handleUpdateOrder(ctx, w, r, id)
+		case http.MethodPatch:
+			h.handlePatchOrder(ctx, w, r, id)
 		case http.MethodDelete:
-			h.handleDeleteOrder(ctx, w, id, w)
+			h.handleDeleteOrder(ctx, w, r, id)
 		default:
-			h.respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			respondWithError(w, r, apperr.ErrMethodNotAllowed)
 		}
 	}
 }
 
+// customerScope returns the customer ID the caller is restricted to. Staff and
+// admins are unrestricted; customers only ever see their own orders.
+func customerScope(ctx context.Context) (customerID int, scoped bool) {
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok || claims.HasAnyRole(auth.RoleAdmin, auth.RoleStaff) {
+		return 0, false
+	}
+	return claims.CustomerID, true
+}
+
 // CRUD operations for Orders
 func (h *Handler) handleGetAllOrders(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	orders, err := h.Store.GetAllOrders(ctx)
+	params, err := parseListParams(r)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to retrieve orders")
+		respondWithError(w, r, err)
 		return
 	}
+
+	var orders m.Page[m.Order]
+	if customerID, scoped := customerScope(ctx); scoped {
+		if customerID == 0 {
+			h.respondWithJSON(w, http.StatusOK, m.Page[m.Order]{Data: []m.Order{}})
+			return
+		}
+		orders, err = h.Store.SearchOrders(ctx, m.SearchCriteriaOrders{CustomerID: customerID}, params)
+		if err == sql.ErrNoRows {
+			orders, err = m.Page[m.Order]{Data: []m.Order{}}, nil
+		}
+	} else {
+		orders, err = h.Store.GetAllOrders(ctx, params)
+	}
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	setNextLink(w, r, orders.NextCursor)
 	h.respondWithJSON(w, http.StatusOK, orders)
 }
 
-func (h *Handler) handleGetOrder(ctx context.Context, w http.ResponseWriter, id int, res http.ResponseWriter) {
+func (h *Handler) handleGetOrder(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
 	order, err := h.Store.GetOrder(ctx, id)
 	if err != nil {
-		h.respondWithError(res, http.StatusNotFound, "Order not found")
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	if customerID, scoped := customerScope(ctx); scoped && order.Customer.ID != customerID {
+		respondWithError(w, r, errOrderNotFound)
 		return
 	}
-	h.respondWithJSON(res, http.StatusOK, order)
+	respondWithEntity(w, r, order)
 }
 
 func (h *Handler) handleCreateOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	var order m.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if err := decodeJSON(r, &order); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	// Validate the order data
-	if order.Customer.ID == 0 || len(order.Items) == 0 || order.TotalPrice <= 0 {
-		h.respondWithError(w, http.StatusBadRequest, "Missing required order fields")
-		return
+	// Customers may only place orders for themselves
+	if customerID, scoped := customerScope(ctx); scoped {
+		if customerID == 0 {
+			respondWithError(w, r, errNoLinkedCustomer)
+			return
+		}
+		order.Customer.ID = customerID
 	}
 
-	// Check if the customer exists in the system
-	customerExists, _ := h.Store.GetCustomer(ctx, order.Customer.ID)
-	if customerExists.ID == 0 {
-		h.respondWithError(w, http.StatusBadRequest, "Customer does not exist")
+	// Validate the order data (prices and totals are computed by the store)
+	if err := h.validateOrder(ctx, order); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
 	newOrder, err := h.Store.CreateOrder(ctx, order)
-	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to create order")
+	if errors.Is(err, apperr.KindInsufficientStock) {
+		ordersRejected.WithLabelValues("insufficient_stock").Inc()
+		respondWithError(w, r, err)
+		return
+	} else if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
+
+	ordersCreated.Inc()
+	orderRevenue.Add(newOrder.TotalPrice)
+	for _, item := range newOrder.Items {
+		orderItemsSold.Add(float64(item.Quantity))
+	}
 	h.respondWithJSON(w, http.StatusCreated, newOrder)
 }
 
 func (h *Handler) handleUpdateOrder(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetOrder(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
 	var order m.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		h.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if err := decodeJSON(r, &order); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if !h.updateOrder(ctx, w, r, current, order.Customer.ID, s.NormalizeOrderStatus(order.Status)) {
+		return
+	}
+
+	updated, err := h.Store.GetOrder(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	respondWithEntity(w, r, updated)
+}
+
+// handlePatchOrder applies a merge patch or JSON Patch to an order. Only the
+// customer and the status can be patched; items have their own endpoint.
+func (h *Handler) handlePatchOrder(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetOrder(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var order m.Order
+	fields, err := applyPatch(w, r, current, &order, "customer", "status")
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	var customerID int
+	if fields["customer"] {
+		customerID = order.Customer.ID
+	}
+	var status string
+	if fields["status"] {
+		status = s.NormalizeOrderStatus(order.Status)
+	}
+	if !h.updateOrder(ctx, w, r, current, customerID, status) {
+		return
+	}
+
+	updated, err := h.Store.GetOrder(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	respondWithEntity(w, r, updated)
+}
+
+// orderActions maps the transition endpoints to the status they move an order to.
+var orderActions = map[string]string{
+	"pay":     m.OrderStatusPaid,
+	"pack":    m.OrderStatusPacked,
+	"ship":    m.OrderStatusShipped,
+	"deliver": m.OrderStatusDelivered,
+	"cancel":  m.OrderStatusCancelled,
+	"refund":  m.OrderStatusRefunded,
+}
+
+// HandleOrderTransition handles POST /api/orders/{id}/{action}, e.g. /cancel or /ship
+func (h *Handler) HandleOrderTransition(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, r, invalidID("order"))
+		return
+	}
+	status, ok := orderActions[vars["action"]]
+	if !ok {
+		respondWithError(w, r, apperr.NotFound("unknown_action", "Unknown order action"))
+		return
+	}
+
+	current, err := h.Store.GetOrder(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	if customerID, scoped := customerScope(ctx); scoped {
+		if current.Customer.ID != customerID {
+			respondWithError(w, r, errOrderNotFound)
+			return
+		}
+		// Customers may only cancel orders that have not been paid yet
+		if current.Status != m.OrderStatusPending {
+			respondWithError(w, r, apperr.Conflict("order_not_pending", "Only pending orders can be cancelled"))
+			return
+		}
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
 		return
 	}
-	err := h.Store.UpdateOrder(ctx, id, order)
+
+	order, err := h.Store.TransitionOrder(ctx, id, status, changedBy(ctx), current.Version)
 	if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to update order")
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
 		return
 	}
-	h.respondWithJSON(w, http.StatusOK, "Order updated successfully")
+	orderTransitions.WithLabelValues(status).Inc()
+	respondWithEntity(w, r, order)
 }
 
-func (h *Handler) handleDeleteOrder(ctx context.Context, w http.ResponseWriter, id int, res http.ResponseWriter) {
-	err := h.Store.DeleteOrder(ctx, id)
+// updateOrder changes the customer (if customerID is non-zero) and the status
+// (if status is non-empty) of current in one store call, so a rejected status
+// change leaves the customer alone too. It writes the error response on
+// failure and reports whether the update succeeded.
+func (h *Handler) updateOrder(ctx context.Context, w http.ResponseWriter, r *http.Request, current m.Order, customerID int, status string) bool {
+	changeCustomer := customerID != 0 && customerID != current.Customer.ID
+	changeStatus := status != "" && status != current.Status
+	if !changeCustomer && !changeStatus {
+		return true
+	}
+
+	order := m.Order{Customer: current.Customer, Version: current.Version}
+	if changeCustomer {
+		order.Customer = m.Customer{ID: customerID}
+		if err := h.validateOrderUpdate(ctx, order); err != nil {
+			respondWithError(w, r, err)
+			return false
+		}
+	}
+	if changeStatus {
+		order.Status = status
+	}
+	if err := h.Store.UpdateOrder(ctx, current.ID, order, changedBy(ctx)); err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return false
+	}
+	if changeStatus {
+		orderTransitions.WithLabelValues(status).Inc()
+	}
+	return true
+}
+
+// changedBy names the user making a request in the order status history.
+func changedBy(ctx context.Context) string {
+	if claims, ok := auth.ClaimsFromContext(ctx); ok {
+		return claims.Username
+	}
+	return ""
+}
+
+// HandleOrderItems handles PUT (replace all items) and PATCH (change only the
+// listed books; quantity 0 removes a book) on /api/orders/{id}/items
+func (h *Handler) HandleOrderItems(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		h.respondWithError(res, http.StatusInternalServerError, "Failed to delete order")
+		respondWithError(w, r, invalidID("order"))
 		return
 	}
-	h.respondWithJSON(res, http.StatusOK, "Order deleted successfully")
+
+	var items []m.OrderItem
+	if err := decodeJSON(r, &items); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	merge := r.Method == http.MethodPatch
+	if err := validateOrderItems(items, merge); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	current, err := h.Store.GetOrder(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	if customerID, scoped := customerScope(ctx); scoped && current.Customer.ID != customerID {
+		respondWithError(w, r, errOrderNotFound)
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	order, err := h.Store.UpdateOrderItems(ctx, id, items, merge, current.Version)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	respondWithEntity(w, r, order)
+}
+
+// HandleOrderHistory handles GET /api/orders/{id}/history
+func (h *Handler) HandleOrderHistory(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.RequestTimeout)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, r, invalidID("order"))
+		return
+	}
+
+	order, err := h.Store.GetOrder(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	if customerID, scoped := customerScope(ctx); scoped && order.Customer.ID != customerID {
+		respondWithError(w, r, errOrderNotFound)
+		return
+	}
+
+	history, err := h.Store.GetOrderStatusHistory(ctx, id)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+	h.respondWithJSON(w, http.StatusOK, history)
+}
+
+func (h *Handler) handleDeleteOrder(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	current, err := h.Store.GetOrder(ctx, id)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	if err := checkIfMatch(r, current); err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = h.Store.DeleteOrder(ctx, id, current.Version)
+	if err != nil {
+		respondWithError(w, r, orNotFound(err, errOrderNotFound))
+		return
+	}
+	h.respondWithJSON(w, http.StatusOK, "Order deleted successfully")
 }
 
 func (h *Handler) handleSearchOrders(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	criteria := m.SearchCriteriaOrders{
 		CustomerName: r.URL.Query().Get("customer_name"),
-		Status:       r.URL.Query().Get("status"),
+		Status:       s.NormalizeOrderStatus(r.URL.Query().Get("status")),
+	}
+	if criteria.Status != "" && !s.ValidOrderStatus(criteria.Status) {
+		respondWithError(w, r, apperr.BadRequest("invalid_status", "Invalid order status"))
+		return
+	}
+	if customerID, scoped := customerScope(ctx); scoped {
+		if customerID == 0 {
+			respondWithError(w, r, noResults("orders"))
+			return
+		}
+		criteria.CustomerID = customerID
+	}
+
+	params, err := parseListParams(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
 	}
 
-	orders, err := h.Store.SearchOrders(ctx, criteria)
+	orders, err := h.Store.SearchOrders(ctx, criteria, params)
 	if err == sql.ErrNoRows {
-		h.respondWithError(w, http.StatusNotFound, "No orders found")
+		respondWithError(w, r, noResults("orders"))
 		return
 	} else if err != nil {
-		h.respondWithError(w, http.StatusInternalServerError, "Failed to search orders")
+		respondWithError(w, r, err)
 		return
 	}
 
+	setNextLink(w, r, orders.NextCursor)
 	h.respondWithJSON(w, http.StatusOK, orders)
 }
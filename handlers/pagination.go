@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project.com/myproject/internal/apperr"
+	m "project.com/myproject/models"
+	s "project.com/myproject/stores"
+)
+
+var errInvalidLimit = apperr.BadRequest("invalid_limit", "Invalid limit")
+
+// parseListParams reads the limit, cursor and sort query parameters. Sort is a
+// comma-separated list of columns, each optionally prefixed with "-" for
+// descending order, e.g. sort=price,-published_at.
+func parseListParams(r *http.Request) (m.ListParams, error) {
+	query := r.URL.Query()
+	params := m.ListParams{Cursor: query.Get("cursor")}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return m.ListParams{}, errInvalidLimit
+		}
+		params.Limit = n
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		for _, column := range strings.Split(sort, ",") {
+			column = strings.TrimSpace(column)
+			field := m.SortField{Column: strings.TrimPrefix(column, "-"), Desc: strings.HasPrefix(column, "-")}
+			if field.Column == "" {
+				return m.ListParams{}, s.ErrInvalidSort
+			}
+			params.Sort = append(params.Sort, field)
+		}
+	}
+	return params, nil
+}
+
+// isDefaultListParams reports whether the request asks for the first page in
+// the default order, the only page of a list that is cached.
+func isDefaultListParams(params m.ListParams) bool {
+	return params.Limit == 0 && params.Cursor == "" && len(params.Sort) == 0
+}
+
+// setNextLink adds a Link header pointing at the next page, if there is one.
+func setNextLink(w http.ResponseWriter, r *http.Request, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", nextCursor)
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/patch"
+)
+
+// applyPatch applies the PATCH request body to the JSON of current and
+// decodes the result into dst. It returns the top-level fields the patch
+// touched; touching any field outside writable is a validation error.
+func applyPatch(w http.ResponseWriter, r *http.Request, current, dst any, writable ...string) (map[string]bool, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, apperr.BadRequest("unreadable_body", "The request body could not be read").Wrap(err)
+	}
+	if len(body) == 0 {
+		return nil, apperr.BadRequest("empty_body", "The request body is empty")
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	patched, fields, err := patch.Apply(r.Header.Get("Content-Type"), doc, body)
+	if errors.Is(err, apperr.KindUnsupportedMediaType) {
+		w.Header().Set("Accept-Patch", patch.AcceptPatch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool, len(writable))
+	for _, field := range writable {
+		allowed[field] = true
+	}
+	touched := make(map[string]bool, len(fields))
+	var readOnly []apperr.FieldError
+	for _, field := range fields {
+		if !allowed[field] {
+			readOnly = append(readOnly, apperr.FieldError{Field: field, Code: "read_only", Message: "Cannot be changed"})
+		}
+		touched[field] = true
+	}
+	if len(readOnly) > 0 {
+		return nil, apperr.Validation(readOnly...)
+	}
+
+	return touched, decodeError(json.Unmarshal(patched, dst))
+}
@@ -3,10 +3,10 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
+	"project.com/myproject/internal/apperr"
 	s "project.com/myproject/stores"
 )
 
@@ -28,23 +28,22 @@ func (rh *Handler) HandleReports(w http.ResponseWriter, r *http.Request) {
 
 	startDate, err := time.Parse("2006-01-02", startDateStr)
 	if err != nil {
-		http.Error(w, "Invalid start_date format", http.StatusBadRequest)
+		respondWithError(w, r, apperr.BadRequest("invalid_start_date", "Invalid start_date format"))
 		return
 	}
 	endDate, err := time.Parse("2006-01-02", endDateStr)
 	if err != nil {
-		http.Error(w, "Invalid end_date format", http.StatusBadRequest)
+		respondWithError(w, r, apperr.BadRequest("invalid_end_date", "Invalid end_date format"))
 		return
 	}
 	if endDate.Before(startDate) {
-		http.Error(w, "end_date must be after start_date", http.StatusBadRequest)
+		respondWithError(w, r, apperr.BadRequest("invalid_date_range", "end_date must be after start_date"))
 		return
 	}
 
 	report, err := rh.Store.GetSalesReport(ctx, startDate, endDate)
 	if err != nil {
-		http.Error(w, "Error generating report", http.StatusInternalServerError)
-		log.Println("Error generating sales report:", err)
+		respondWithError(w, r, err)
 		return
 	}
 
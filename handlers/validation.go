@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/validate"
+	m "project.com/myproject/models"
+)
+
+// checkReference adds a not_found error on field if lookup reports that the
+// referenced record does not exist. Other lookup errors are returned.
+func checkReference(fields []apperr.FieldError, field string, lookup error) ([]apperr.FieldError, error) {
+	if errors.Is(lookup, sql.ErrNoRows) {
+		return append(fields, apperr.FieldError{Field: field, Code: "not_found", Message: "Does not exist"}), nil
+	}
+	return fields, lookup
+}
+
+// validateBook checks a book's fields and that its author exists.
+func (h *Handler) validateBook(ctx context.Context, book m.Book) error {
+	fields := validate.Struct(book)
+	if book.Author.ID > 0 {
+		_, err := h.Store.GetAuthor(ctx, book.Author.ID)
+		if fields, err = checkReference(fields, "author.id", err); err != nil {
+			return err
+		}
+	}
+	return validate.Error(fields)
+}
+
+// validateOrder checks a new order and that its customer and books exist.
+func (h *Handler) validateOrder(ctx context.Context, order m.Order) error {
+	fields := validate.Struct(order)
+	var err error
+	if order.Customer.ID > 0 {
+		_, err = h.Store.GetCustomer(ctx, order.Customer.ID)
+		if fields, err = checkReference(fields, "customer.id", err); err != nil {
+			return err
+		}
+	}
+	for i, item := range order.Items {
+		if item.Book.ID > 0 {
+			_, err = h.Store.GetBook(ctx, item.Book.ID)
+			if fields, err = checkReference(fields, "items["+strconv.Itoa(i)+"].book.id", err); err != nil {
+				return err
+			}
+		}
+	}
+	return validate.Error(fields)
+}
+
+// validateOrderUpdate checks the new customer of an order; the status is
+// checked by the state machine and items have their own endpoint.
+func (h *Handler) validateOrderUpdate(ctx context.Context, order m.Order) error {
+	_, err := h.Store.GetCustomer(ctx, order.Customer.ID)
+	fields, err := checkReference(nil, "customer.id", err)
+	if err != nil {
+		return err
+	}
+	return validate.Error(fields)
+}
+
+// validateOrderItems checks the body of PUT and PATCH /api/orders/{id}/items.
+func validateOrderItems(items []m.OrderItem, merge bool) error {
+	var fields []apperr.FieldError
+	for i, item := range items {
+		for _, field := range validate.Struct(item) {
+			// A PATCH may set a quantity of 0 to remove a book
+			if merge && field.Field == "quantity" && item.Quantity == 0 {
+				continue
+			}
+			field.Field = "items[" + strconv.Itoa(i) + "]." + field.Field
+			fields = append(fields, field)
+		}
+	}
+	return validate.Error(fields)
+}
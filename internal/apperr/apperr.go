@@ -0,0 +1,163 @@
+// Package apperr defines the typed errors shared by the stores and the HTTP
+// handlers, and writes them as RFC 7807 application/problem+json responses.
+//
+// Every error has a Kind, which decides the HTTP status, and a stable,
+// machine-readable Code such as "book_not_found" that clients can rely on.
+// Anything that is not an *Error is reported as an opaque 500.
+package apperr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Kind classifies an error. A Kind is itself an error, so callers can test
+// for a class of errors with errors.Is(err, apperr.KindNotFound).
+type Kind string
+
+const (
+	KindBadRequest           Kind = "bad_request"
+	KindValidation           Kind = "validation_failed"
+	KindUnauthorized         Kind = "unauthorized"
+	KindForbidden            Kind = "forbidden"
+	KindNotFound             Kind = "not_found"
+	KindMethodNotAllowed     Kind = "method_not_allowed"
+	KindUnsupportedMediaType Kind = "unsupported_media_type"
+	KindUnprocessable        Kind = "unprocessable"
+	KindTimeout              Kind = "timeout"
+	KindConflict             Kind = "conflict"
+	KindPreconditionFailed   Kind = "precondition_failed"
+	KindPreconditionRequired Kind = "precondition_required"
+	KindInsufficientStock    Kind = "insufficient_stock"
+	KindRateLimited          Kind = "rate_limited"
+	KindInternal             Kind = "internal"
+)
+
+var kindStatus = map[Kind]int{
+	KindBadRequest:           http.StatusBadRequest,
+	KindValidation:           http.StatusUnprocessableEntity,
+	KindUnauthorized:         http.StatusUnauthorized,
+	KindForbidden:            http.StatusForbidden,
+	KindNotFound:             http.StatusNotFound,
+	KindMethodNotAllowed:     http.StatusMethodNotAllowed,
+	KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	KindUnprocessable:        http.StatusUnprocessableEntity,
+	KindTimeout:              http.StatusRequestTimeout,
+	KindConflict:             http.StatusConflict,
+	KindPreconditionFailed:   http.StatusPreconditionFailed,
+	KindPreconditionRequired: http.StatusPreconditionRequired,
+	KindInsufficientStock:    http.StatusConflict,
+	KindRateLimited:          http.StatusTooManyRequests,
+	KindInternal:             http.StatusInternalServerError,
+}
+
+func (k Kind) Error() string { return string(k) }
+
+// Status returns the HTTP status code for errors of this kind.
+func (k Kind) Status() int {
+	if status, ok := kindStatus[k]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// FieldError describes one invalid field of a request body. Field is the
+// JSON path of the field, e.g. "items[0].quantity".
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error with a stable code and a message safe to show to
+// clients.
+type Error struct {
+	Kind   Kind
+	Code   string
+	Detail string
+	// Fields lists the invalid fields of a validation error.
+	Fields []FieldError
+	// Extensions are extra members added to the problem document.
+	Extensions map[string]any
+	// Err is the underlying cause; it is logged but never sent to clients.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether target is the Kind of e.
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// With returns a copy of e carrying an extra problem member.
+func (e *Error) With(key string, value any) *Error {
+	c := *e
+	c.Extensions = make(map[string]any, len(e.Extensions)+1)
+	for k, v := range e.Extensions {
+		c.Extensions[k] = v
+	}
+	c.Extensions[key] = value
+	return &c
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// New returns an error of the given kind.
+func New(kind Kind, code, detail string) *Error {
+	return &Error{Kind: kind, Code: code, Detail: detail}
+}
+
+func BadRequest(code, detail string) *Error   { return New(KindBadRequest, code, detail) }
+func Unauthorized(code, detail string) *Error { return New(KindUnauthorized, code, detail) }
+func Forbidden(code, detail string) *Error    { return New(KindForbidden, code, detail) }
+func NotFound(code, detail string) *Error     { return New(KindNotFound, code, detail) }
+func Conflict(code, detail string) *Error     { return New(KindConflict, code, detail) }
+
+// Validation returns a validation error listing every invalid field.
+func Validation(fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: "validation_failed", Detail: "The request body is invalid", Fields: fields}
+}
+
+// InsufficientStock reports the books that do not have enough stock.
+func InsufficientStock(bookIDs []int) *Error {
+	return New(KindInsufficientStock, "insufficient_stock", "Not enough stock for some of the requested books").
+		With("book_ids", bookIDs)
+}
+
+// Coder is implemented by error types that are not an *Error themselves but
+// map to one, such as errors carrying their own fields.
+type Coder interface {
+	AppError() *Error
+}
+
+// As returns err as an *Error. Context deadlines become timeouts and any
+// other unknown error becomes an internal error wrapping it.
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.AppError().Wrap(err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return New(KindTimeout, "timeout", "The request took too long").Wrap(err)
+	}
+	return New(KindInternal, "internal_error", "An internal error occurred").Wrap(err)
+}
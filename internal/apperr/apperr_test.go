@@ -0,0 +1,91 @@
+package apperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type stockError struct{ ids []int }
+
+func (e *stockError) Error() string    { return "out of stock" }
+func (e *stockError) AppError() *Error { return InsufficientStock(e.ids) }
+
+func write(t *testing.T, err error) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Request-ID", "req-1")
+	Write(rec, httptest.NewRequest("POST", "/api/orders", nil), err)
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid problem document %q: %v", rec.Body.String(), err)
+	}
+	return rec, body
+}
+
+func TestWrite_Validation(t *testing.T) {
+	rec, body := write(t, Validation(
+		FieldError{Field: "customer.id", Code: "required", Message: "A customer is required"},
+		FieldError{Field: "items", Code: "required", Message: "An order must contain at least one item"},
+	))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+	if body["status"] != float64(422) || body["code"] != "validation_failed" || body["title"] != "Unprocessable Entity" {
+		t.Errorf("unexpected problem: %v", body)
+	}
+	if body["instance"] != "/api/orders" || body["request_id"] != "req-1" {
+		t.Errorf("instance/request_id = %v/%v", body["instance"], body["request_id"])
+	}
+	fields := body["errors"].([]any)
+	if len(fields) != 2 || fields[0].(map[string]any)["field"] != "customer.id" {
+		t.Errorf("errors = %v", fields)
+	}
+}
+
+func TestWrite_MapsDomainErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"not found", NotFound("book_not_found", "Book not found"), 404, "book_not_found"},
+		{"wrapped conflict", fmt.Errorf("creating user: %w", Conflict("user_exists", "User already exists")), 409, "user_exists"},
+		{"forbidden", Forbidden("insufficient_permissions", "Insufficient permissions"), 403, "insufficient_permissions"},
+		{"coder", &stockError{ids: []int{3}}, 409, "insufficient_stock"},
+		{"deadline", context.DeadlineExceeded, 408, "timeout"},
+		{"unknown", errors.New("pq: connection reset"), 500, "internal_error"},
+	}
+	for _, tt := range tests {
+		rec, body := write(t, tt.err)
+		if rec.Code != tt.status || body["code"] != tt.code {
+			t.Errorf("%s: got %d %v, want %d %s", tt.name, rec.Code, body["code"], tt.status, tt.code)
+		}
+		if strings.Contains(rec.Body.String(), "pq:") {
+			t.Errorf("%s: response leaks the cause: %s", tt.name, rec.Body.String())
+		}
+	}
+
+	_, body := write(t, &stockError{ids: []int{3, 5}})
+	if ids, _ := body["book_ids"].([]any); len(ids) != 2 {
+		t.Errorf("book_ids extension = %v", body["book_ids"])
+	}
+}
+
+func TestError_IsKind(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", NotFound("order_not_found", "Order not found"))
+	if !errors.Is(err, KindNotFound) || errors.Is(err, KindConflict) {
+		t.Error("errors.Is should match the error's kind only")
+	}
+}
@@ -0,0 +1,97 @@
+package apperr
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"project.com/myproject/internal/logging"
+)
+
+// ContentType is the media type of problem documents.
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem document. Code, RequestID and Errors are
+// extension members; Extensions are merged into the top level as well.
+type Problem struct {
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	Status     int            `json:"status"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Code       string         `json:"code"`
+	RequestID  string         `json:"request_id,omitempty"`
+	Errors     []FieldError   `json:"errors,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	data, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+
+	members := make(map[string]any, len(p.Extensions))
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	// The standard members win over extensions of the same name
+	var standard map[string]any
+	if err := json.Unmarshal(data, &standard); err != nil {
+		return nil, err
+	}
+	for k, v := range standard {
+		members[k] = v
+	}
+	return json.Marshal(members)
+}
+
+// NewProblem builds the problem document for err on request r.
+func NewProblem(r *http.Request, err error) Problem {
+	e := As(err)
+	status := e.Kind.Status()
+	return Problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     e.Detail,
+		Instance:   r.URL.Path,
+		Code:       e.Code,
+		Errors:     e.Fields,
+		Extensions: e.Extensions,
+	}
+}
+
+// Write writes err as a problem+json response. Internal errors are logged
+// with their cause, which is never sent to the client.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	problem := NewProblem(r, err)
+	problem.RequestID = w.Header().Get(logging.RequestIDHeader)
+
+	if problem.Status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("request failed", "code", problem.Code, "err", err)
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// NotFoundHandler answers requests for unknown routes.
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, NotFound("route_not_found", "No such endpoint"))
+	})
+}
+
+// MethodNotAllowedHandler answers requests using a method the route does not
+// support.
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, ErrMethodNotAllowed)
+	})
+}
+
+// ErrMethodNotAllowed is returned for methods a resource does not support.
+var ErrMethodNotAllowed = New(KindMethodNotAllowed, "method_not_allowed", "Method not allowed")
@@ -1,44 +1,102 @@
+// Package cache provides the response cache used by the handlers: Redis, a
+// size-bounded in-process LRU, or both in two tiers with Redis as the second.
 package cache
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-var ctx = context.Background()
-var CacheClient *redis.Client
-
-// Initialize Redis Client
-func InitCache() {
-	CacheClient = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379", // Redis container
-		Password: "",               // No password by default
-		DB:       0,                // Default DB
-	})
-
-	// Test connection
-	_, err := CacheClient.Ping(ctx).Result()
-	if err != nil {
-		fmt.Println("❌ Redis connection failed:", err)
-	} else {
-		fmt.Println("✅ Connected to Redis")
-	}
+// ErrMiss is returned by Get when the key is not cached.
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores serialized responses by key.
+type Cache interface {
+	// Get returns the cached value, or ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set caches value for ttl, tagged with the entities it contains.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error
+	// Delete removes the keys; missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+	// InvalidateTags removes every entry carrying one of the tags.
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+// BooksTag is carried by every list or search of books, whose contents can
+// change whenever any book is created, changed or deleted.
+const BooksTag = "books"
+
+// BookTag is carried by entries containing the book.
+func BookTag(id int) string {
+	return "book:" + strconv.Itoa(id)
+}
+
+// AuthorTag is carried by entries containing the author, e.g. embedded in a book.
+func AuthorTag(id int) string {
+	return "author:" + strconv.Itoa(id)
 }
 
-// Set cache with expiration
-func SetCache(key string, value string, duration time.Duration) error {
-	return CacheClient.Set(ctx, key, value, duration).Err()
+// GenreTag is carried by entries containing a book of the genre.
+func GenreTag(name string) string {
+	return "genre:" + strings.ToLower(name)
 }
 
-// Get cache
-func GetCache(key string) (string, error) {
-	return CacheClient.Get(ctx, key).Result()
+// Tier labels for the metrics.
+const (
+	tierLocal = "local"
+	tierRedis = "redis"
+)
+
+var (
+	cacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_hits_total",
+			Help: "Total number of cache hits",
+		},
+		[]string{"tier"},
+	)
+	cacheMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_misses_total",
+			Help: "Total number of cache misses",
+		},
+		[]string{"tier"},
+	)
+	cacheErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_errors_total",
+			Help: "Total number of failed cache operations",
+		},
+		[]string{"tier"},
+	)
+	// cacheLoads counts Loader lookups by result: hit, refresh (a hit that
+	// starts a background refresh) or miss.
+	cacheLoads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_loads_total",
+			Help: "Total number of cached response lookups by result",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(cacheHits, cacheMisses, cacheErrors, cacheLoads)
 }
 
-// Delete cache
-func DeleteCache(key string) error {
-	return CacheClient.Del(ctx, key).Err()
+// observe counts the outcome of a Get on tier.
+func observe(tier string, err error) {
+	switch {
+	case err == nil:
+		cacheHits.WithLabelValues(tier).Inc()
+	case errors.Is(err, ErrMiss):
+		cacheMisses.WithLabelValues(tier).Inc()
+	default:
+		cacheErrors.WithLabelValues(tier).Inc()
+	}
 }
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+	c.Set(ctx, "a", []byte("1"), 0)
+	c.Set(ctx, "b", []byte("2"), 0)
+	c.Get(ctx, "a") // b is now the least recently used
+	c.Set(ctx, "c", []byte("3"), 0)
+
+	if _, err := c.Get(ctx, "b"); !errors.Is(err, ErrMiss) {
+		t.Errorf("b: expected ErrMiss, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := c.Get(ctx, key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want 2", c.Len())
+	}
+}
+
+func TestLRU_Expires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "k", []byte("v"), time.Minute)
+	if _, err := c.Get(ctx, "k"); err != nil {
+		t.Fatalf("before expiry: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, ErrMiss) {
+		t.Errorf("after expiry: expected ErrMiss, got %v", err)
+	}
+}
+
+func TestLRU_InvalidateTags(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+	c.Set(ctx, "book:1", []byte("1"), 0, BookTag(1), AuthorTag(7))
+	c.Set(ctx, "book:2", []byte("2"), 0, BookTag(2), AuthorTag(8))
+	c.Set(ctx, "all_books", []byte("[1,2]"), 0, BooksTag, BookTag(1), BookTag(2))
+
+	c.InvalidateTags(ctx, AuthorTag(7))
+	for key, want := range map[string]bool{"book:1": false, "book:2": true, "all_books": true} {
+		if _, err := c.Get(ctx, key); (err == nil) != want {
+			t.Errorf("%s cached = %v, want %v", key, err == nil, want)
+		}
+	}
+
+	c.InvalidateTags(ctx, BookTag(2))
+	if c.Len() != 0 {
+		t.Errorf("Len = %d, want 0", c.Len())
+	}
+	if len(c.tags) != 0 {
+		t.Errorf("tag index not cleaned up: %v", c.tags)
+	}
+}
+
+// fakeRemote is a Remote whose availability the test controls.
+type fakeRemote struct {
+	*LRU
+	down  bool
+	calls int
+}
+
+var errDown = errors.New("connection refused")
+
+func (f *fakeRemote) Get(ctx context.Context, key string) ([]byte, error) {
+	f.calls++
+	if err := f.err(ctx); err != nil {
+		return nil, err
+	}
+	return f.LRU.Get(ctx, key)
+}
+
+func (f *fakeRemote) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	f.calls++
+	if err := f.err(ctx); err != nil {
+		return err
+	}
+	return f.LRU.Set(ctx, key, value, ttl, tags...)
+}
+
+func (f *fakeRemote) Delete(ctx context.Context, keys ...string) error {
+	f.calls++
+	if err := f.err(ctx); err != nil {
+		return err
+	}
+	return f.LRU.Delete(ctx, keys...)
+}
+
+func (f *fakeRemote) InvalidateTags(ctx context.Context, tags ...string) error {
+	f.calls++
+	if err := f.err(ctx); err != nil {
+		return err
+	}
+	return f.LRU.InvalidateTags(ctx, tags...)
+}
+
+func (f *fakeRemote) Ping(ctx context.Context) error {
+	return f.err(ctx)
+}
+
+// err fails calls made with a cancelled ctx like the Redis client does.
+func (f *fakeRemote) err(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.down {
+		return errDown
+	}
+	return nil
+}
+
+func TestTiered_FallsBackToLocalAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	remote := &fakeRemote{LRU: NewLRU(10)}
+	c := NewTiered(NewLRU(10), remote, time.Minute)
+
+	// Values from L2 are copied into L1
+	remote.LRU.Set(ctx, "book:1", []byte("old"), 0)
+	remote.LRU.Set(ctx, "all_books", []byte("[old]"), 0, BooksTag)
+	if value, err := c.Get(ctx, "book:1"); err != nil || string(value) != "old" {
+		t.Fatalf("Get = %q, %v", value, err)
+	}
+
+	// The first failure switches to local only; later calls skip Redis
+	remote.down = true
+	c.Set(ctx, "book:2", []byte("two"), 0)
+	if c.Healthy() {
+		t.Fatal("expected the remote tier to be marked down")
+	}
+	calls := remote.calls
+	if value, err := c.Get(ctx, "book:2"); err != nil || string(value) != "two" {
+		t.Errorf("Get from L1 = %q, %v", value, err)
+	}
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrMiss) {
+		t.Errorf("expected ErrMiss, got %v", err)
+	}
+	c.Delete(ctx, "book:1")
+	c.InvalidateTags(ctx, BooksTag)
+	if remote.calls != calls {
+		t.Errorf("remote called %d times while down", remote.calls-calls)
+	}
+
+	// Health checks keep it down until Redis answers, then replay the delete
+	c.check(ctx, time.Second)
+	if c.Healthy() {
+		t.Fatal("expected the remote tier to stay down")
+	}
+	remote.down = false
+	c.check(ctx, time.Second)
+	if !c.Healthy() {
+		t.Fatal("expected the remote tier to be back")
+	}
+	if _, err := remote.LRU.Get(ctx, "book:1"); !errors.Is(err, ErrMiss) {
+		t.Errorf("delete made during the outage was not replayed: %v", err)
+	}
+	if _, err := remote.LRU.Get(ctx, "all_books"); !errors.Is(err, ErrMiss) {
+		t.Errorf("tag invalidated during the outage was not replayed: %v", err)
+	}
+}
+
+func TestTiered_CancelledRequestsDoNotMarkRemoteDown(t *testing.T) {
+	remote := &fakeRemote{LRU: NewLRU(10)}
+	c := NewTiered(NewLRU(10), remote, time.Minute)
+	remote.LRU.Set(context.Background(), "all_books", []byte("[old]"), 0, BooksTag)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Get(ctx, "book:1")
+	c.Set(ctx, "book:1", []byte("one"), 0)
+	c.InvalidateTags(ctx, BooksTag)
+	if !c.Healthy() {
+		t.Fatal("a cancelled request marked the remote tier down")
+	}
+	if _, err := remote.LRU.Get(context.Background(), "all_books"); !errors.Is(err, ErrMiss) {
+		t.Errorf("invalidation lost because the request was cancelled: %v", err)
+	}
+}
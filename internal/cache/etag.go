@@ -0,0 +1,14 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// ETag returns a strong entity tag for a serialized response: the quoted,
+// base64url-encoded first 18 bytes of its SHA-256. Equal bytes always get
+// the same tag, so it changes whenever anything embedded in the response does.
+func ETag(value []byte) string {
+	sum := sha256.Sum256(value)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+}
@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"project.com/myproject/internal/tracing"
+)
+
+// ErrNotFound is returned by a LoadFunc when the entity does not exist. The
+// Loader caches the absence for NegativeTTL and returns ErrNotFound.
+var ErrNotFound = errors.New("not found")
+
+// LoadFunc loads the value of a key that is not cached, and the tags to cache
+// it with. ctx is detached from the request that triggered the load.
+type LoadFunc func(ctx context.Context) (value []byte, tags []string, err error)
+
+// Loader reads through a Cache and protects the store behind it:
+//
+//   - concurrent misses for the same key share a single load (singleflight);
+//   - entries stay servable for StaleTTL after their TTL ("soft" expiry)
+//     while one background load refreshes them;
+//   - each read may refresh an entry a little before it expires, more likely
+//     the closer it gets and the slower it was to load (probabilistic early
+//     expiration, "XFetch"), so popular keys rarely expire at all;
+//   - ErrNotFound results are cached for NegativeTTL.
+//
+// Invalidate tags through the Loader rather than its Cache: a load that was
+// already reading when a tag was invalidated may have read the data from
+// before the write, so its result is returned but not cached.
+type Loader struct {
+	Cache          Cache
+	StaleTTL       time.Duration
+	NegativeTTL    time.Duration
+	Beta           float64       // early expiration aggressiveness; 0 disables it
+	RefreshTimeout time.Duration // bounds loads, which outlive the request
+
+	group  singleflight.Group
+	now    func() time.Time
+	random func() float64
+
+	mu          sync.Mutex
+	generation  uint64                  // counts InvalidateTags calls
+	invalidated map[string]invalidation // by tag, for RefreshTimeout
+}
+
+// invalidation is the last InvalidateTags call that named a tag.
+type invalidation struct {
+	generation uint64
+	at         time.Time
+}
+
+func NewLoader(c Cache) *Loader {
+	return &Loader{
+		Cache:          c,
+		StaleTTL:       time.Minute,
+		NegativeTTL:    30 * time.Second,
+		Beta:           1,
+		RefreshTimeout: 5 * time.Second,
+		now:            time.Now,
+		random:         rand.Float64,
+		invalidated:    make(map[string]invalidation),
+	}
+}
+
+// InvalidateTags invalidates the tags in the Cache, and keeps loads that are
+// in progress from caching what they read before.
+func (l *Loader) InvalidateTags(ctx context.Context, tags ...string) error {
+	l.mu.Lock()
+	l.generation++
+	now := l.now()
+	for _, tag := range tags {
+		l.invalidated[tag] = invalidation{generation: l.generation, at: now}
+	}
+	// Loads are bounded by RefreshTimeout, so older invalidations cannot
+	// have overlapped one that is still running
+	for tag, inv := range l.invalidated {
+		if now.Sub(inv.at) > l.RefreshTimeout {
+			delete(l.invalidated, tag)
+		}
+	}
+	l.mu.Unlock()
+	return l.Cache.InvalidateTags(ctx, tags...)
+}
+
+// invalidatedSince reports whether any of tags was invalidated after
+// generation, or whether a load that started at start has run for so long
+// that its invalidations may have been forgotten.
+func (l *Loader) invalidatedSince(generation uint64, start time.Time, tags []string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.now().Sub(start) > l.RefreshTimeout {
+		return true
+	}
+	for _, tag := range tags {
+		if l.invalidated[tag].generation > generation {
+			return true
+		}
+	}
+	return false
+}
+
+// Load returns the cached value of key, calling load on a miss. The value is
+// fresh for ttl and served stale for StaleTTL after that.
+func (l *Loader) Load(ctx context.Context, key string, ttl time.Duration, load LoadFunc) ([]byte, error) {
+	value, _, err := l.LoadWithETag(ctx, key, ttl, load)
+	return value, err
+}
+
+// LoadWithETag is Load that also returns the ETag of the value, computed
+// when it was loaded and cached alongside it.
+func (l *Loader) LoadWithETag(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (value []byte, etag string, err error) {
+	ctx, span := tracer.Start(ctx, "cache.Load", trace.WithAttributes(attribute.String("cache.key", key)))
+	defer func() { tracing.End(span, err, ErrNotFound) }()
+
+	if data, err := l.Cache.Get(ctx, key); err == nil {
+		if e, ok := decodeEntry(data); ok {
+			refresh := l.shouldRefresh(e)
+			span.SetAttributes(attribute.Bool("cache.hit", true), attribute.Bool("cache.refresh", refresh))
+			if !refresh {
+				cacheLoads.WithLabelValues("hit").Inc()
+			} else {
+				cacheLoads.WithLabelValues("refresh").Inc()
+				// Serve the current value; one background load replaces it
+				l.group.DoChan(key, func() (interface{}, error) {
+					return l.fill(ctx, key, ttl, load)
+				})
+			}
+			if e.negative {
+				return nil, "", ErrNotFound
+			}
+			return e.value, e.etag, nil
+		}
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+	cacheLoads.WithLabelValues("miss").Inc()
+
+	// Miss: the first request loads, concurrent ones wait for its result
+	result := l.group.DoChan(key, func() (interface{}, error) {
+		return l.fill(ctx, key, ttl, load)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, "", res.Err
+		}
+		e := res.Val.(entry)
+		return e.value, e.etag, nil
+	}
+}
+
+// fill loads key and caches the result, or its absence, unless one of its
+// tags was invalidated during the load.
+func (l *Loader) fill(ctx context.Context, key string, ttl time.Duration, load LoadFunc) (entry, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.RefreshTimeout)
+	defer cancel()
+
+	l.mu.Lock()
+	generation := l.generation
+	l.mu.Unlock()
+	start := l.now()
+	value, tags, err := load(ctx)
+	e := entry{delta: l.now().Sub(start), value: value}
+	stale := l.invalidatedSince(generation, start, tags)
+
+	if errors.Is(err, ErrNotFound) {
+		if l.NegativeTTL > 0 && !stale {
+			e.negative, e.softExpiry, e.value = true, l.now().Add(l.NegativeTTL), nil
+			l.Cache.Set(ctx, key, e.encode(), l.NegativeTTL, tags...)
+		}
+		return entry{}, ErrNotFound
+	} else if err != nil {
+		return entry{}, err
+	}
+
+	e.softExpiry = l.now().Add(ttl)
+	e.etag = ETag(value)
+	if !stale {
+		l.Cache.Set(ctx, key, e.encode(), ttl+l.StaleTTL, tags...)
+	}
+	return e, nil
+}
+
+// shouldRefresh reports whether e is past its soft expiry, or is chosen for
+// early expiration: now + delta * beta * -ln(rand) >= expiry.
+func (l *Loader) shouldRefresh(e entry) bool {
+	remaining := float64(e.softExpiry.Sub(l.now()))
+	if remaining <= 0 {
+		return true
+	}
+	r := l.random()
+	if l.Beta <= 0 || r <= 0 {
+		return false
+	}
+	return float64(e.delta)*l.Beta*-math.Log(r) >= remaining
+}
+
+// entry is the envelope stored in the cache:
+// version(1) flags(1) softExpiry(8, unix ns) delta(8, ns) etagLen(1) etag value.
+type entry struct {
+	softExpiry time.Time
+	delta      time.Duration // how long the load took
+	negative   bool
+	etag       string
+	value      []byte
+}
+
+const (
+	entryVersion    = 2
+	entryHeaderSize = 19
+	flagNegative    = 1
+)
+
+func (e entry) encode() []byte {
+	data := make([]byte, entryHeaderSize, entryHeaderSize+len(e.etag)+len(e.value))
+	data[0] = entryVersion
+	if e.negative {
+		data[1] = flagNegative
+	}
+	binary.BigEndian.PutUint64(data[2:], uint64(e.softExpiry.UnixNano()))
+	binary.BigEndian.PutUint64(data[10:], uint64(e.delta))
+	data[18] = byte(len(e.etag))
+	data = append(data, e.etag...)
+	return append(data, e.value...)
+}
+
+// decodeEntry parses an envelope; anything else (e.g. an entry written by an
+// older version) is treated as a miss.
+func decodeEntry(data []byte) (entry, bool) {
+	if len(data) < entryHeaderSize || data[0] != entryVersion {
+		return entry{}, false
+	}
+	etagEnd := entryHeaderSize + int(data[18])
+	if len(data) < etagEnd {
+		return entry{}, false
+	}
+	return entry{
+		negative:   data[1]&flagNegative != 0,
+		softExpiry: time.Unix(0, int64(binary.BigEndian.Uint64(data[2:]))),
+		delta:      time.Duration(binary.BigEndian.Uint64(data[10:])),
+		etag:       string(data[entryHeaderSize:etagEnd]),
+		value:      data[etagEnd:],
+	}, true
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLoader() (*Loader, *time.Time) {
+	now := time.Now()
+	l := NewLoader(NewLRU(10))
+	l.now = func() time.Time { return now }
+	l.random = func() float64 { return 1 } // -ln(1) = 0: no early expiration
+	return l, &now
+}
+
+func TestLoader_CoalescesMisses(t *testing.T) {
+	l, _ := newTestLoader()
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		loads.Add(1)
+		<-release
+		return []byte("books"), nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := l.Load(context.Background(), "all_books", time.Minute, load)
+			if err != nil || string(value) != "books" {
+				t.Errorf("Load = %q, %v", value, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("store loaded %d times, want 1", n)
+	}
+}
+
+func TestLoader_ServesStaleWhileRefreshing(t *testing.T) {
+	l, now := newTestLoader()
+	ctx := context.Background()
+	version := "v1"
+	refreshed := make(chan struct{}, 1)
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		defer func() { refreshed <- struct{}{} }()
+		return []byte(version), nil, nil
+	}
+
+	l.Load(ctx, "k", time.Minute, load)
+	<-refreshed
+
+	// Past the TTL but inside the stale window: old value now, new value next
+	*now = now.Add(time.Minute + time.Second)
+	version = "v2"
+	value, err := l.Load(ctx, "k", time.Minute, load)
+	if err != nil || string(value) != "v1" {
+		t.Fatalf("stale Load = %q, %v", value, err)
+	}
+	<-refreshed
+	waitFor(t, func() bool {
+		value, _ := l.Load(ctx, "k", time.Minute, load)
+		return string(value) == "v2"
+	})
+}
+
+func TestLoader_EarlyExpiration(t *testing.T) {
+	l, now := newTestLoader()
+	ctx := context.Background()
+	var loads atomic.Int32
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		loads.Add(1)
+		*now = now.Add(time.Second) // each load takes a second
+		return []byte("v"), nil, nil
+	}
+
+	l.Load(ctx, "k", time.Minute, load)
+
+	// 10s before expiry with delta 1s and beta 1: refresh iff -ln(r) >= 10
+	*now = now.Add(50 * time.Second)
+	l.random = func() float64 { return 0.5 }
+	l.Load(ctx, "k", time.Minute, load)
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("refreshed early with -ln(r) < 10: %d loads", n)
+	}
+	l.random = func() float64 { return 1e-5 }
+	l.Load(ctx, "k", time.Minute, load)
+	waitFor(t, func() bool { return loads.Load() == 2 })
+}
+
+func TestLoader_NegativeCaching(t *testing.T) {
+	l, now := newTestLoader()
+	ctx := context.Background()
+	var loads atomic.Int32
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		loads.Add(1)
+		return nil, []string{BookTag(9)}, ErrNotFound
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := l.Load(ctx, "book:9", time.Minute, load); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("store loaded %d times, want 1", n)
+	}
+
+	// The tag clears the cached absence, e.g. when the book is created
+	l.Cache.InvalidateTags(ctx, BookTag(9))
+	l.Load(ctx, "book:9", time.Minute, load)
+	if n := loads.Load(); n != 2 {
+		t.Errorf("store loaded %d times after invalidation, want 2", n)
+	}
+
+	// Other errors are not cached
+	*now = now.Add(time.Hour)
+	failing := func(ctx context.Context) ([]byte, []string, error) { return nil, nil, errDown }
+	if _, err := l.Load(ctx, "book:10", time.Minute, failing); !errors.Is(err, errDown) {
+		t.Fatalf("expected errDown, got %v", err)
+	}
+	if _, err := l.Cache.Get(ctx, "book:10"); !errors.Is(err, ErrMiss) {
+		t.Errorf("error result was cached: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoader_CachesETag(t *testing.T) {
+	l, _ := newTestLoader()
+	ctx := context.Background()
+	var loads int
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		loads++
+		return []byte(`{"id":1}`), nil, nil
+	}
+
+	_, missTag, err := l.LoadWithETag(ctx, "book:1", time.Minute, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, hitTag, err := l.LoadWithETag(ctx, "book:1", time.Minute, load)
+	if err != nil || loads != 1 {
+		t.Fatalf("second load: %v, %d loads", err, loads)
+	}
+	if missTag != ETag(value) || hitTag != missTag {
+		t.Errorf("ETag on miss %s, on hit %s, want %s", missTag, hitTag, ETag(value))
+	}
+}
+
+func TestLoader_DoesNotCacheLoadOverlappingInvalidation(t *testing.T) {
+	l, _ := newTestLoader()
+	ctx := context.Background()
+	version := "v1"
+	loading, release := make(chan struct{}), make(chan struct{})
+	slow := func(ctx context.Context) ([]byte, []string, error) {
+		value := version // read before the write commits
+		close(loading)
+		<-release
+		return []byte(value), []string{BookTag(1)}, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Load(ctx, "book:1", time.Minute, slow)
+	}()
+	<-loading
+	version = "v2"
+	l.InvalidateTags(ctx, BookTag(1))
+	close(release)
+	<-done
+
+	value, err := l.Load(ctx, "book:1", time.Minute, func(ctx context.Context) ([]byte, []string, error) {
+		return []byte(version), []string{BookTag(1)}, nil
+	})
+	if err != nil || string(value) != "v2" {
+		t.Errorf("Load after the invalidation = %q, %v, want v2", value, err)
+	}
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-process Cache holding at most capacity entries. The least
+// recently used entry is evicted first; expired entries are dropped on read.
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front is most recently used
+	items    map[string]*list.Element
+	tags     map[string]map[string]struct{} // tag -> keys
+	now      func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	tags      []string
+	expiresAt time.Time // zero means no expiry
+}
+
+func NewLRU(capacity int) *LRU {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRU{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+		tags:     make(map[string]map[string]struct{}),
+		now:      time.Now,
+	}
+}
+
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		observe(tierLocal, ErrMiss)
+		return nil, ErrMiss
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		observe(tierLocal, ErrMiss)
+		return nil, ErrMiss
+	}
+
+	c.order.MoveToFront(element)
+	observe(tierLocal, nil)
+	return entry.value, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value, tags: tags, expiresAt: expiresAt})
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]struct{})
+		}
+		c.tags[tag][key] = struct{}{}
+	}
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LRU) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := c.items[key]; ok {
+			c.remove(element)
+		}
+	}
+	return nil
+}
+
+func (c *LRU) InvalidateTags(ctx context.Context, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			c.remove(c.items[key])
+		}
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet dropped.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+	c.order.Remove(element)
+	delete(c.items, entry.key)
+	for _, tag := range entry.tags {
+		delete(c.tags[tag], entry.key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
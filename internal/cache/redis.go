@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisClient connects to Redis and logs whether it is reachable. The
+// client is returned either way; go-redis reconnects on its own.
+func NewRedisClient(addr, password string, db int) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+	client.AddHook(redisTracingHook{})
+
+	// Test connection
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		slog.Error("redis connection failed", "addr", addr, "err", err)
+	} else {
+		slog.Info("connected to redis", "addr", addr)
+	}
+	return client
+}
+
+// Redis is a Cache stored in Redis and shared by every instance.
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		err = ErrMiss
+	}
+	observe(tierRedis, err)
+	return value, err
+}
+
+// Set stores value and adds key to a set per tag. A tag set expires no
+// earlier than its longest-lived member (EXPIRE NX/GT needs Redis 7).
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, ttl)
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagKeyPrefix+tag, key)
+			if ttl > 0 {
+				pipe.ExpireNX(ctx, tagKeyPrefix+tag, ttl)
+				pipe.ExpireGT(ctx, tagKeyPrefix+tag, ttl)
+			} else {
+				pipe.Persist(ctx, tagKeyPrefix+tag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		cacheErrors.WithLabelValues(tierRedis).Inc()
+	}
+	return err
+}
+
+const tagKeyPrefix = "tag:"
+
+// invalidateScript deletes the members of each tag set and the set itself
+// atomically, so an entry tagged concurrently is never left behind.
+var invalidateScript = redis.NewScript(`
+for _, tag in ipairs(KEYS) do
+	local keys = redis.call("SMEMBERS", tag)
+	for i = 1, #keys, 500 do
+		redis.call("DEL", unpack(keys, i, math.min(i + 499, #keys)))
+	end
+	redis.call("DEL", tag)
+end
+return 0
+`)
+
+func (c *Redis) InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = tagKeyPrefix + tag
+	}
+	err := invalidateScript.Run(ctx, c.client, keys).Err()
+	if err != nil {
+		cacheErrors.WithLabelValues(tierRedis).Inc()
+	}
+	return err
+}
+
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	err := c.client.Del(ctx, keys...).Err()
+	if err != nil {
+		cacheErrors.WithLabelValues(tierRedis).Inc()
+	}
+	return err
+}
+
+// Ping reports whether Redis is reachable.
+func (c *Redis) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Remote is a shared second-tier cache that can be health checked.
+type Remote interface {
+	Cache
+	Ping(ctx context.Context) error
+}
+
+// Tiered keeps a local LRU (L1) in front of a shared remote cache (L2).
+//
+// When a remote call fails, or a health check does, the remote tier is
+// skipped and requests are served from L1 only, so a Redis outage does not
+// cost every request a failed round-trip. Invalidations made while the remote tier
+// is down are replayed before it is used again, so it never serves data that
+// was invalidated during the outage.
+type Tiered struct {
+	local    *LRU
+	remote   Remote
+	localTTL time.Duration // upper bound on how stale L1 can be across instances
+
+	healthy atomic.Bool
+
+	// Keys and tags invalidated while the remote tier was down
+	mu          sync.Mutex
+	pendingKeys map[string]struct{}
+	pendingTags map[string]struct{}
+}
+
+func NewTiered(local *LRU, remote Remote, localTTL time.Duration) *Tiered {
+	c := &Tiered{
+		local:       local,
+		remote:      remote,
+		localTTL:    localTTL,
+		pendingKeys: make(map[string]struct{}),
+		pendingTags: make(map[string]struct{}),
+	}
+	c.healthy.Store(true)
+	return c
+}
+
+func (c *Tiered) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, err := c.local.Get(ctx, key); err == nil {
+		return value, nil
+	}
+	if !c.healthy.Load() {
+		return nil, ErrMiss
+	}
+
+	value, err := c.remote.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrMiss) && !callerGaveUp(ctx, err) {
+			c.markDown(err)
+		}
+		return nil, ErrMiss
+	}
+	c.local.Set(ctx, key, value, c.localTTL)
+	return value, nil
+}
+
+func (c *Tiered) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	localTTL := c.localTTL
+	if ttl > 0 && ttl < localTTL {
+		localTTL = ttl
+	}
+	c.local.Set(ctx, key, value, localTTL, tags...)
+
+	if c.healthy.Load() {
+		if err := c.remote.Set(ctx, key, value, ttl, tags...); err != nil && !callerGaveUp(ctx, err) {
+			c.markDown(err)
+		}
+	}
+	return nil
+}
+
+func (c *Tiered) Delete(ctx context.Context, keys ...string) error {
+	c.local.Delete(ctx, keys...)
+	c.invalidateRemote(ctx, keys, nil)
+	return nil
+}
+
+func (c *Tiered) InvalidateTags(ctx context.Context, tags ...string) error {
+	c.local.InvalidateTags(ctx, tags...)
+	c.invalidateRemote(ctx, nil, tags)
+	return nil
+}
+
+// invalidateRemote deletes keys and tags from the remote tier, or queues them
+// for the next health check while it is down. It ignores the cancellation of
+// ctx: a lost invalidation would leave stale data in the remote tier, and a
+// caller giving up must not mark the remote tier down.
+func (c *Tiered) invalidateRemote(ctx context.Context, keys, tags []string) {
+	ctx = context.WithoutCancel(ctx)
+	if c.healthy.Load() {
+		err := c.applyRemote(ctx, keys, tags)
+		if err == nil {
+			return
+		}
+		c.markDown(err)
+	}
+
+	c.mu.Lock()
+	if c.healthy.Load() {
+		// The remote tier recovered in the meantime and the queue was replayed
+		c.mu.Unlock()
+		c.invalidateRemote(ctx, keys, tags)
+		return
+	}
+	for _, key := range keys {
+		c.pendingKeys[key] = struct{}{}
+	}
+	for _, tag := range tags {
+		c.pendingTags[tag] = struct{}{}
+	}
+	c.mu.Unlock()
+}
+
+func (c *Tiered) applyRemote(ctx context.Context, keys, tags []string) error {
+	if err := c.remote.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	return c.remote.InvalidateTags(ctx, tags...)
+}
+
+// Healthy reports whether the remote tier is in use.
+func (c *Tiered) Healthy() bool {
+	return c.healthy.Load()
+}
+
+// Run health checks the remote tier every interval until ctx is cancelled,
+// switching back to two tiers once it responds again.
+func (c *Tiered) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx, interval)
+		}
+	}
+}
+
+func (c *Tiered) check(ctx context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := c.remote.Ping(ctx); err != nil {
+		c.markDown(err)
+		return
+	}
+	if c.healthy.Load() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.applyRemote(ctx, setKeys(c.pendingKeys), setKeys(c.pendingTags)); err != nil {
+		slog.Error("failed to replay cache invalidations", "err", err)
+		return
+	}
+	c.pendingKeys = make(map[string]struct{})
+	c.pendingTags = make(map[string]struct{})
+	c.healthy.Store(true)
+	slog.Info("redis cache is back, using both cache tiers")
+}
+
+// callerGaveUp reports whether err comes from ctx being cancelled or timing
+// out rather than from the remote tier failing, in which case the remote tier
+// must not be marked down.
+func callerGaveUp(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (c *Tiered) markDown(err error) {
+	if c.healthy.CompareAndSwap(true, false) {
+		slog.Warn("redis cache unavailable, using the local cache only", "err", err)
+	}
+}
+
+func setKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"project.com/myproject/internal/tracing"
+)
+
+var tracer = otel.Tracer("project.com/myproject/internal/cache")
+
+// Traced wraps a Cache and records a span for every call.
+type Traced struct {
+	Cache
+}
+
+func NewTraced(c Cache) *Traced {
+	return &Traced{Cache: c}
+}
+
+func (t *Traced) Get(ctx context.Context, key string) (value []byte, err error) {
+	ctx, span := tracer.Start(ctx, "cache.Get", trace.WithAttributes(attribute.String("cache.key", key)))
+	defer func() {
+		span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+		tracing.End(span, err, ErrMiss)
+	}()
+	return t.Cache.Get(ctx, key)
+}
+
+func (t *Traced) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) (err error) {
+	ctx, span := tracer.Start(ctx, "cache.Set", trace.WithAttributes(
+		attribute.String("cache.key", key),
+		attribute.Int("cache.size", len(value)),
+		attribute.StringSlice("cache.tags", tags),
+	))
+	defer func() { tracing.End(span, err) }()
+	return t.Cache.Set(ctx, key, value, ttl, tags...)
+}
+
+func (t *Traced) Delete(ctx context.Context, keys ...string) (err error) {
+	ctx, span := tracer.Start(ctx, "cache.Delete", trace.WithAttributes(attribute.StringSlice("cache.keys", keys)))
+	defer func() { tracing.End(span, err) }()
+	return t.Cache.Delete(ctx, keys...)
+}
+
+func (t *Traced) InvalidateTags(ctx context.Context, tags ...string) (err error) {
+	ctx, span := tracer.Start(ctx, "cache.InvalidateTags", trace.WithAttributes(attribute.StringSlice("cache.tags", tags)))
+	defer func() { tracing.End(span, err) }()
+	return t.Cache.InvalidateTags(ctx, tags...)
+}
+
+// redisTracingHook records a client span per Redis command or pipeline. Only
+// the command name is recorded: keys can contain usernames.
+type redisTracingHook struct{}
+
+func (redisTracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (redisTracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := tracer.Start(ctx, "redis "+cmd.Name(), trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "redis"), attribute.String("db.operation.name", cmd.Name())))
+		err := next(ctx, cmd)
+		tracing.End(span, err, redis.Nil)
+		return err
+	}
+}
+
+func (redisTracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := tracer.Start(ctx, "redis pipeline", trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "redis"), attribute.Int("db.operation.batch.size", len(cmds))))
+		err := next(ctx, cmds)
+		tracing.End(span, err, redis.Nil)
+		return err
+	}
+}
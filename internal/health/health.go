@@ -0,0 +1,173 @@
+// Package health serves the liveness (/healthz) and readiness (/readyz)
+// endpoints. Readiness runs every registered dependency check concurrently,
+// each under its own timeout, and fails once shutdown has begun so load
+// balancers stop routing before connections are drained.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status values reported per check and overall.
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusDegraded     = "degraded" // only optional checks failed
+	StatusShuttingDown = "shutting_down"
+)
+
+// CheckFunc reports whether a dependency is usable; it must honour ctx.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	optional bool
+}
+
+// Checker holds the readiness checks.
+type Checker struct {
+	// Timeout bounds each check separately.
+	Timeout time.Duration
+
+	checks       []check
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{Timeout: timeout}
+}
+
+// Add registers a check that must pass for the instance to be ready.
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// AddOptional registers a check whose failure is reported but leaves the
+// instance ready, for dependencies the service can run without.
+func (c *Checker) AddOptional(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn, optional: true})
+}
+
+// ShutDown makes readiness fail from now on.
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Optional   bool    `json:"optional,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the JSON body of /readyz.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Check runs every check concurrently and reports the overall status.
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, chk)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		switch {
+		case result.Status == StatusOK:
+		case result.Optional:
+			if report.Status == StatusOK {
+				report.Status = StatusDegraded
+			}
+		default:
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, chk check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		err <- chk.fn(ctx)
+	}()
+
+	result := CheckResult{Name: chk.name, Status: StatusOK, Optional: chk.optional}
+	// A check that ignores ctx must not hold up the whole report
+	select {
+	case e := <-err:
+		if e != nil {
+			result.Status, result.Error = StatusFail, e.Error()
+		}
+	case <-ctx.Done():
+		result.Status, result.Error = StatusFail, fmt.Sprintf("timed out after %s", c.Timeout)
+	}
+	result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+// HandleLiveness answers /healthz: the process is up and serving HTTP.
+func (c *Checker) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// HandleReadiness answers /readyz with 200 when ready (or degraded) and 503
+// otherwise.
+func (c *Checker) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+	status := http.StatusOK
+	if report.Status == StatusFail || report.Status == StatusShuttingDown {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// DirWritable checks that a file can be created in dir.
+func DirWritable(dir string) CheckFunc {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	}
+}
@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readiness(t *testing.T, c *Checker) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c.HandleReadiness(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return rec.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+	hang := func(context.Context) error { select {} } // ignores ctx
+
+	tests := []struct {
+		name       string
+		setup      func(c *Checker)
+		wantCode   int
+		wantStatus string
+	}{
+		{"all pass", func(c *Checker) { c.Add("database", ok); c.AddOptional("redis", ok) }, http.StatusOK, StatusOK},
+		{"optional failure degrades", func(c *Checker) { c.Add("database", ok); c.AddOptional("redis", down) }, http.StatusOK, StatusDegraded},
+		{"required failure", func(c *Checker) { c.Add("database", down); c.AddOptional("redis", ok) }, http.StatusServiceUnavailable, StatusFail},
+		{"hanging check times out", func(c *Checker) { c.Add("database", hang) }, http.StatusServiceUnavailable, StatusFail},
+	}
+	for _, tt := range tests {
+		c := NewChecker(50 * time.Millisecond)
+		tt.setup(c)
+		start := time.Now()
+		code, report := readiness(t, c)
+		if code != tt.wantCode || report.Status != tt.wantStatus {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, code, report.Status, tt.wantCode, tt.wantStatus)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: took %s despite the per-check timeout", tt.name, elapsed)
+		}
+		for _, result := range report.Checks {
+			if result.Status == StatusFail && result.Error == "" {
+				t.Errorf("%s: %s failed without an error message", tt.name, result.Name)
+			}
+		}
+	}
+}
+
+func TestReadiness_FailsDuringShutdown(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("database", func(context.Context) error { return nil })
+	c.ShutDown()
+
+	if code, report := readiness(t, c); code != http.StatusServiceUnavailable || report.Status != StatusShuttingDown {
+		t.Errorf("got %d %q, want 503 %q", code, report.Status, StatusShuttingDown)
+	}
+
+	rec := httptest.NewRecorder()
+	c.HandleLiveness(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("liveness = %d during shutdown, want 200", rec.Code)
+	}
+}
+
+func TestDirWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := DirWritable(dir)(context.Background()); err != nil {
+		t.Errorf("writable dir: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("probe file left behind: %v", entries)
+	}
+	if err := DirWritable(filepath.Join(dir, "missing"))(context.Background()); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
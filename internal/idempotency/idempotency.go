@@ -0,0 +1,246 @@
+// Package idempotency makes create requests safe to retry. A client sends an
+// Idempotency-Key header; the first request with a key runs and its response
+// is stored, and retries with the same key and payload get that response
+// replayed instead of creating the resource again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
+)
+
+const (
+	// Header carries the client's key.
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set to "true" on replayed responses.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength     = 255
+	completeAttempts = 3
+)
+
+var (
+	errInvalidKey = apperr.BadRequest("invalid_idempotency_key",
+		"Idempotency-Key must be 1 to 255 visible ASCII characters")
+	errKeyInUse = apperr.Conflict("idempotency_key_in_use",
+		"A request with this Idempotency-Key is still in progress")
+	errKeyReused = apperr.New(apperr.KindUnprocessable, "idempotency_key_reused",
+		"The Idempotency-Key was already used for a different request")
+)
+
+// ErrReservationLost is returned by Store.Complete when the key is no longer
+// held by the reservation, e.g. because its lock expired and another request
+// took it over.
+var ErrReservationLost = errors.New("idempotency key reservation lost")
+
+// Record is what is stored per key.
+type Record struct {
+	// Fingerprint identifies the request the key was first used with.
+	Fingerprint string `json:"fingerprint"`
+	// Token identifies the reservation that owns the record.
+	Token string `json:"token"`
+	// Status is 0 while that request is still in flight.
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Store persists records. Implementations must make Reserve atomic so that
+// only one of several concurrent requests with a key wins it.
+type Store interface {
+	// Reserve claims key with claim, which carries the request's fingerprint
+	// and a new token, for at most lock. If the key is already taken it
+	// returns the existing record and false.
+	Reserve(ctx context.Context, key string, claim Record, lock time.Duration) (Record, bool, error)
+	// Complete stores the response for key for ttl, provided the reservation
+	// with rec.Token still holds it; otherwise it returns ErrReservationLost.
+	Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release drops the reservation with token, if it still holds key, so
+	// that the request can be retried.
+	Release(ctx context.Context, key, token string) error
+}
+
+// Options configures Middleware.
+type Options struct {
+	// TTL is how long a response is replayed for its key.
+	TTL time.Duration
+	// LockTimeout is how long an unfinished request holds its key, so a
+	// crashed instance does not block retries for the whole TTL.
+	LockTimeout time.Duration
+	// Client scopes keys to the caller, e.g. by username, so that two
+	// clients picking the same key do not see each other's responses.
+	Client func(r *http.Request) string
+}
+
+// Middleware honors Idempotency-Key on POST requests. A retry with the same
+// key and payload replays the stored status, headers and body; one sent while
+// the first is still running gets 409, and one with a different payload 422.
+// Server errors and timeouts are not stored, so they can be retried.
+func Middleware(store Store, opts Options) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validKey(key) {
+				apperr.Write(w, r, errInvalidKey)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				apperr.Write(w, r, apperr.BadRequest("unreadable_body", "The request body could not be read").Wrap(err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			if opts.Client != nil {
+				key = opts.Client(r) + ":" + key
+			}
+			claim := Record{Fingerprint: Fingerprint(r, body), Token: newToken()}
+			rec, reserved, err := store.Reserve(r.Context(), key, claim, opts.LockTimeout)
+			switch {
+			case err != nil:
+				// Fail closed: running the request unprotected could duplicate it
+				apperr.Write(w, r, fmt.Errorf("reserving idempotency key: %w", err))
+			case rec.Fingerprint != claim.Fingerprint:
+				apperr.Write(w, r, errKeyReused)
+			case !reserved && rec.Status == 0:
+				w.Header().Set("Retry-After", "1")
+				apperr.Write(w, r, errKeyInUse)
+			case !reserved:
+				replay(w, rec)
+			default:
+				record(w, r, next, store, key, claim, opts.TTL)
+			}
+		})
+	}
+}
+
+// record runs the request that reserved key and stores its response.
+func record(w http.ResponseWriter, r *http.Request, next http.Handler, store Store, key string, claim Record, ttl time.Duration) {
+	rec := &recorder{ResponseWriter: w, before: w.Header().Clone()}
+	release := true
+	defer func() {
+		if !release {
+			return
+		}
+		// Release after server errors, timeouts and panics
+		ctx := context.WithoutCancel(r.Context())
+		if err := store.Release(ctx, key, claim.Token); err != nil {
+			logging.FromContext(ctx).Error("error releasing idempotency key", "err", err)
+		}
+	}()
+
+	next.ServeHTTP(rec, r)
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.status >= http.StatusInternalServerError || rec.status == http.StatusRequestTimeout {
+		return
+	}
+
+	// The response is final from here on. If it cannot be stored the key stays
+	// reserved until the lock times out rather than letting a retry run the
+	// request a second time.
+	release = false
+	ctx := context.WithoutCancel(r.Context())
+	completed := Record{
+		Fingerprint: claim.Fingerprint,
+		Token:       claim.Token,
+		Status:      rec.status,
+		Header:      rec.header,
+		Body:        rec.body.Bytes(),
+	}
+	err := store.Complete(ctx, key, completed, ttl)
+	for attempt := 1; attempt < completeAttempts && err != nil && !errors.Is(err, ErrReservationLost); attempt++ {
+		time.Sleep(time.Duration(attempt) * 50 * time.Millisecond)
+		err = store.Complete(ctx, key, completed, ttl)
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("error storing idempotent response, key stays locked", "err", err)
+	}
+}
+
+// newToken returns a random reservation token.
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func replay(w http.ResponseWriter, rec Record) {
+	for name, values := range rec.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// Fingerprint hashes the method, path and body of a request.
+func Fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func validKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// recorder passes a response through while keeping a copy of it. Only the
+// headers the handler set are kept; those set by outer middleware, such as
+// the request ID, belong to the retry.
+type recorder struct {
+	http.ResponseWriter
+	before      http.Header
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status, rec.wroteHeader = status, true
+		rec.header = make(http.Header)
+		for name, values := range rec.Header() {
+			if !slices.Equal(values, rec.before[name]) {
+				rec.header[name] = slices.Clone(values)
+			}
+		}
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,194 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, store Store, handler http.HandlerFunc) http.Handler {
+	t.Helper()
+	idempotent := Middleware(store, Options{
+		TTL:         time.Hour,
+		LockTimeout: time.Minute,
+		Client:      func(r *http.Request) string { return r.Header.Get("X-Test-User") },
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Set by outer middleware, so never replayed
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		idempotent(handler).ServeHTTP(w, r)
+	})
+}
+
+func post(h http.Handler, key, user, requestID, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	r.Header.Set("X-Test-User", user)
+	r.Header.Set("X-Request-ID", requestID)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestMiddleware_ReplaysResponse(t *testing.T) {
+	var created atomic.Int32
+	h := newTestServer(t, NewMemoryStore(), func(w http.ResponseWriter, r *http.Request) {
+		n := created.Add(1)
+		w.Header().Set("Location", "/api/orders/"+strconv.Itoa(int(n)))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	first := post(h, "abc", "alice", "req-1", `{"customer":{"id":1}}`)
+	retry := post(h, "abc", "alice", "req-2", `{"customer":{"id":1}}`)
+	if created.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", created.Load())
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %s, want %d %s", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get("Location") != "/api/orders/1" || retry.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry headers = %v", retry.Header())
+	}
+	if got := retry.Header().Get("X-Request-ID"); got != "req-2" {
+		t.Errorf("X-Request-ID = %q, want the retry's own", got)
+	}
+
+	// Keys are scoped per client, and requests without a key are not deduplicated
+	post(h, "abc", "bob", "req-3", `{"customer":{"id":1}}`)
+	post(h, "", "alice", "req-4", `{"customer":{"id":1}}`)
+	if created.Load() != 3 {
+		t.Errorf("handler ran %d times, want 3", created.Load())
+	}
+}
+
+func TestMiddleware_RejectsReusedKeyAndInFlightDuplicates(t *testing.T) {
+	store := NewMemoryStore()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := newTestServer(t, store, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(h, "abc", "alice", "req-1", `{"a":1}`) }()
+	<-started
+
+	if w := post(h, "abc", "alice", "req-2", `{"a":1}`); w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("in-flight duplicate = %d, want 409 with Retry-After", w.Code)
+	}
+	if w := post(h, "abc", "alice", "req-3", `{"a":2}`); w.Code != http.StatusUnprocessableEntity ||
+		!strings.Contains(w.Body.String(), "idempotency_key_reused") {
+		t.Errorf("mismatched payload = %d %s, want 422 idempotency_key_reused", w.Code, w.Body)
+	}
+
+	close(release)
+	if w := <-done; w.Code != http.StatusCreated {
+		t.Fatalf("first request = %d", w.Code)
+	}
+	if w := post(h, "abc", "alice", "req-4", `{"a":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("mismatched payload after completion = %d, want 422", w.Code)
+	}
+}
+
+func TestMiddleware_ServerErrorsCanBeRetried(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestServer(t, NewMemoryStore(), func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	if w := post(h, "abc", "alice", "req-1", `{}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("first = %d", w.Code)
+	}
+	if w := post(h, "abc", "alice", "req-2", `{}`); w.Code != http.StatusCreated || w.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("retry after 500 = %d (replayed %q), want a fresh 201", w.Code, w.Header().Get(ReplayedHeader))
+	}
+}
+
+func TestMiddleware_InvalidKey(t *testing.T) {
+	h := newTestServer(t, NewMemoryStore(), func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not run")
+	})
+	for _, key := range []string{"has space", strings.Repeat("k", 256)} {
+		if w := post(h, key, "alice", "req", `{}`); w.Code != http.StatusBadRequest {
+			t.Errorf("key %.20q: status %d, want 400", key, w.Code)
+		}
+	}
+}
+
+func TestMemoryStore_LockExpires(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	first := Record{Fingerprint: "f1", Token: "t1"}
+	if _, ok, _ := store.Reserve(ctx, "k", first, time.Minute); !ok {
+		t.Fatal("first reservation failed")
+	}
+	if _, ok, _ := store.Reserve(ctx, "k", Record{Fingerprint: "f1", Token: "t2"}, time.Minute); ok {
+		t.Fatal("key reserved twice")
+	}
+	now = now.Add(time.Minute)
+	second := Record{Fingerprint: "f2", Token: "t3"}
+	if rec, ok, _ := store.Reserve(ctx, "k", second, time.Minute); !ok || rec.Fingerprint != "f2" {
+		t.Errorf("expired lock not taken over: %+v, %v", rec, ok)
+	}
+
+	// The first request no longer owns the key
+	first.Status = http.StatusCreated
+	if err := store.Complete(ctx, "k", first, time.Hour); !errors.Is(err, ErrReservationLost) {
+		t.Errorf("Complete with a lost reservation = %v, want ErrReservationLost", err)
+	}
+	store.Release(ctx, "k", first.Token)
+	if rec, ok, _ := store.Reserve(ctx, "k", Record{Fingerprint: "f2", Token: "t4"}, time.Minute); ok || rec.Token != "t3" {
+		t.Errorf("stale Release dropped the new reservation: %+v, %v", rec, ok)
+	}
+
+	now = now.Add(time.Minute)
+	store.deleteExpired()
+	if len(store.records) != 0 {
+		t.Errorf("%d expired records left", len(store.records))
+	}
+}
+
+// failingStore cannot store responses.
+type failingStore struct {
+	*MemoryStore
+}
+
+func (failingStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	return errors.New("store unavailable")
+}
+
+func TestMiddleware_KeepsKeyLockedWhenResponseCannotBeStored(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestServer(t, failingStore{NewMemoryStore()}, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	if w := post(h, "abc", "alice", "req-1", `{}`); w.Code != http.StatusCreated {
+		t.Fatalf("first = %d", w.Code)
+	}
+	if w := post(h, "abc", "alice", "req-2", `{}`); w.Code != http.StatusConflict {
+		t.Errorf("retry = %d, want 409 while the key stays locked", w.Code)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler ran %d times, want 1", calls.Load())
+	}
+}
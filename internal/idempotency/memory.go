@@ -0,0 +1,84 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process memory. Keys are only deduplicated
+// per instance and are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+	now     func() time.Time
+}
+
+type memoryRecord struct {
+	Record
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]memoryRecord), now: time.Now}
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key string, claim Record, lock time.Duration) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if rec, ok := s.records[key]; ok && now.Before(rec.expiresAt) {
+		return rec.Record, false, nil
+	}
+	s.records[key] = memoryRecord{Record: claim, expiresAt: now.Add(lock)}
+	return claim, true, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.records[key]; !ok || current.Token != rec.Token {
+		return ErrReservationLost
+	}
+	s.records[key] = memoryRecord{Record: rec, expiresAt: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.records[key]; ok && current.Token == token && current.Status == 0 {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// Run deletes expired records every interval until ctx is cancelled.
+func (s *MemoryStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.deleteExpired()
+		}
+	}
+}
+
+func (s *MemoryStore) deleteExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, rec := range s.records {
+		if !now.Before(rec.expiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
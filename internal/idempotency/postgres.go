@@ -0,0 +1,106 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"project.com/myproject/internal/logging"
+)
+
+// PostgresStore keeps records in the idempotency_keys table, so they survive
+// restarts and are shared by every instance. Times are stored in UTC.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{DB: db}
+}
+
+func (s *PostgresStore) Reserve(ctx context.Context, key string, claim Record, lock time.Duration) (Record, bool, error) {
+	now := time.Now().UTC()
+	// Take the key if it is free or its record has expired
+	res, err := s.DB.ExecContext(ctx, `INSERT INTO idempotency_keys (key, fingerprint, token, expires_at)
+	          VALUES ($1, $2, $3, $4)
+	          ON CONFLICT (key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, token = EXCLUDED.token,
+	              status = NULL, headers = NULL, body = NULL, created_at = $5, expires_at = EXCLUDED.expires_at
+	          WHERE idempotency_keys.expires_at <= $5`,
+		key, claim.Fingerprint, claim.Token, now.Add(lock), now)
+	if err != nil {
+		return Record{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Record{}, false, err
+	} else if n > 0 {
+		return claim, true, nil
+	}
+
+	var (
+		rec     Record
+		status  sql.NullInt64
+		headers []byte
+	)
+	err = s.DB.QueryRowContext(ctx, `SELECT fingerprint, token, status, headers, body FROM idempotency_keys WHERE key = $1`, key).
+		Scan(&rec.Fingerprint, &rec.Token, &status, &headers, &rec.Body)
+	if err == sql.ErrNoRows {
+		// Released in the meantime; the caller will see it as in flight
+		return Record{Fingerprint: claim.Fingerprint}, false, nil
+	} else if err != nil {
+		return Record{}, false, err
+	}
+	rec.Status = int(status.Int64)
+	if headers != nil {
+		if err := json.Unmarshal(headers, &rec.Header); err != nil {
+			return Record{}, false, err
+		}
+	}
+	return rec, false, nil
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	headers, err := json.Marshal(rec.Header)
+	if err != nil {
+		return err
+	}
+	res, err := s.DB.ExecContext(ctx, `UPDATE idempotency_keys SET status = $1, headers = $2, body = $3, expires_at = $4
+	          WHERE key = $5 AND token = $6`,
+		rec.Status, headers, rec.Body, time.Now().UTC().Add(ttl), key, rec.Token)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrReservationLost
+	}
+	return nil
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key, token string) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND token = $2 AND status IS NULL`, key, token)
+	return err
+}
+
+// Run deletes expired records every interval until ctx is cancelled.
+func (s *PostgresStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			res, err := s.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, time.Now().UTC())
+			if err != nil {
+				logging.FromContext(ctx).Error("error deleting expired idempotency keys", "err", err)
+				continue
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				logging.FromContext(ctx).Debug("deleted expired idempotency keys", "count", n)
+			}
+		}
+	}
+}
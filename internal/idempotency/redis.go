@@ -0,0 +1,94 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "idempotency:"
+
+// completeScript replaces the record in KEYS[1] with ARGV[2] for ARGV[3]
+// milliseconds if it still holds the token ARGV[1].
+var completeScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current or cjson.decode(current).token ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
+
+// releaseScript deletes the record in KEYS[1] if it is still the unfinished
+// reservation with token ARGV[1].
+var releaseScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current then
+	local rec = cjson.decode(current)
+	if rec.token == ARGV[1] and not rec.status then
+		redis.call("DEL", KEYS[1])
+	end
+end
+return 0
+`)
+
+// RedisStore keeps records in Redis, shared by every instance.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Reserve(ctx context.Context, key string, claim Record, lock time.Duration) (Record, bool, error) {
+	value, err := json.Marshal(claim)
+	if err != nil {
+		return Record{}, false, err
+	}
+	// The record can expire between SET NX and GET; try again if it did
+	for attempt := 0; attempt < 3; attempt++ {
+		ok, err := s.client.SetNX(ctx, redisKeyPrefix+key, value, lock).Result()
+		if err != nil {
+			return Record{}, false, err
+		}
+		if ok {
+			return claim, true, nil
+		}
+
+		stored, err := s.client.Get(ctx, redisKeyPrefix+key).Bytes()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return Record{}, false, err
+		}
+		var existing Record
+		if err := json.Unmarshal(stored, &existing); err != nil {
+			return Record{}, false, err
+		}
+		return existing, false, nil
+	}
+	// Still churning: report it as in flight
+	return Record{Fingerprint: claim.Fingerprint}, false, nil
+}
+
+func (s *RedisStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	stored, err := completeScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, rec.Token, value, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if stored == 0 {
+		return ErrReservationLost
+	}
+	return nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, key, token string) error {
+	return releaseScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, token).Err()
+}
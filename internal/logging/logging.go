@@ -0,0 +1,83 @@
+// Package logging sets up structured (log/slog) logging: a JSON or text
+// logger that redacts personal data, request IDs, and a request-scoped logger
+// carried in context.Context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// New returns a logger writing JSON (or "text") records at level and above.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+	switch format {
+	case "json", "":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("log format %q: must be json or text", format)
+	}
+}
+
+type contextKey int
+
+const loggerContextKey contextKey = iota
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// FromContext returns the request-scoped logger, or slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Redacted is logged in place of personal data.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are personal data.
+var sensitiveKeys = map[string]bool{
+	"email":       true,
+	"street":      true,
+	"address":     true,
+	"city":        true,
+	"state":       true,
+	"postal_code": true,
+	"password":    true,
+}
+
+// redact masks sensitive attributes wherever they appear, including inside
+// groups. Emails keep their domain, which is useful when debugging.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	if !sensitiveKeys[key] || a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if key == "email" {
+		return slog.String(a.Key, MaskEmail(a.Value.String()))
+	}
+	return slog.String(a.Key, Redacted)
+}
+
+// MaskEmail hides the local part of an email address: "j***@example.com".
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return Redacted
+	}
+	return local[:1] + "***@" + domain
+}
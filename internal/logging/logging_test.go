@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	m "project.com/myproject/models"
+)
+
+func decode(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid JSON log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNew_RedactsPersonalData(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	customer := m.Customer{ID: 7, Name: "Jane Doe", Email: "jane@example.com", Street: "1 Main St", Country: "US"}
+	logger.Info("customer created", "customer", customer, "email", "jane@example.com", "postal_code", "12345")
+	logger.Debug("hidden below the level")
+
+	out := buf.String()
+	for _, leak := range []string{"jane@", "Jane Doe", "1 Main St", "12345"} {
+		if strings.Contains(out, leak) {
+			t.Errorf("log leaks %q: %s", leak, out)
+		}
+	}
+	records := decode(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if got := records[0]["email"]; got != "j***@example.com" {
+		t.Errorf("email = %v, want j***@example.com", got)
+	}
+	if got := records[0]["customer"].(map[string]any)["id"]; got != float64(7) {
+		t.Errorf("customer.id = %v, want 7", got)
+	}
+}
+
+func TestNew_RejectsUnknownLevel(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "loud", "json"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestRequestID_AcceptsOrGenerates(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, "info", "json")
+
+	var fromContext string
+	handler := RequestID(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("inside")
+		fromContext = w.Header().Get(RequestIDHeader)
+	}))
+
+	tests := []struct {
+		name, incoming string
+		keep           bool
+	}{
+		{"valid ID is kept", "abc-123", true},
+		{"missing ID is generated", "", false},
+		{"unsafe ID is replaced", "bad id\nwith newline", false},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.incoming != "" {
+			r.Header.Set(RequestIDHeader, tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		id := w.Header().Get(RequestIDHeader)
+		if tt.keep && id != tt.incoming || !tt.keep && (id == tt.incoming || len(id) != 32) {
+			t.Errorf("%s: response ID = %q", tt.name, id)
+		}
+		if fromContext != id {
+			t.Errorf("%s: handler saw %q, want %q", tt.name, fromContext, id)
+		}
+		if got := decode(t, &buf)[0]["request_id"]; got != id {
+			t.Errorf("%s: logged request_id = %v, want %q", tt.name, got, id)
+		}
+	}
+}
+
+func TestAccessLog_RecordsStatusAndBytes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, "info", "json")
+
+	r := mux.NewRouter()
+	r.Use(RequestID(logger))
+	r.Use(AccessLog)
+	r.HandleFunc("/books/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/books/42", nil))
+
+	record := decode(t, &buf)[0]
+	if record["msg"] != "request" || record["status"] != float64(201) || record["bytes"] != float64(5) {
+		t.Errorf("unexpected access log record: %v", record)
+	}
+	if record["route"] != "/books/{id}" || record["path"] != "/books/42" {
+		t.Errorf("route/path = %v/%v", record["route"], record["path"])
+	}
+	if record["request_id"] == nil {
+		t.Error("access log is missing the request ID")
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID accepts the caller's X-Request-ID (if it looks sane) or generates
+// one, echoes it in the response and stores a logger carrying it in the
+// request context.
+func RequestID(base *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			logger := base.With("request_id", id)
+			next.ServeHTTP(w, r.WithContext(WithLogger(r.Context(), logger)))
+		})
+	}
+}
+
+// AccessLog logs one record per request with its status, size and duration.
+// It must run after RequestID.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+		level := slog.LevelInfo
+		if rec.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		FromContext(r.Context()).LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", rec.Status),
+			slog.Int64("bytes", rec.Bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+// ResponseRecorder records the status code and body size of a response.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int64
+	wroteHeader bool
+}
+
+func (rec *ResponseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.Status, rec.wroteHeader = status, true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *ResponseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.Bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,82 @@
+// Package metrics exposes HTTP and database pool metrics to Prometheus.
+// Packages that own other metrics (cache, handlers) register their own.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"project.com/myproject/internal/logging"
+)
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests",
+		},
+		[]string{"method", "route", "status"},
+	)
+	httpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "route", "status"},
+	)
+	httpResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "Size of HTTP response bodies",
+			Buckets: prometheus.ExponentialBuckets(100, 4, 8), // 100B to ~1.6MB
+		},
+		[]string{"method", "route"},
+	)
+	httpRequestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(httpRequestsTotal, httpRequestDuration, httpResponseSize, httpRequestsInFlight)
+}
+
+// Middleware records request count, latency and response size per route.
+// Routes are labelled by their mux template ("/api/books/{id}"), never by the
+// raw path, so IDs do not create new series; it must run inside mux (r.Use).
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		start := time.Now()
+		rec := &logging.ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		status := strconv.Itoa(rec.Status)
+		httpRequestsTotal.WithLabelValues(r.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+		httpResponseSize.WithLabelValues(r.Method, route).Observe(float64(rec.Bytes))
+	})
+}
+
+// RegisterDBStats exports the sql.DBStats of db (open, in use and idle
+// connections, waits) as go_sql_* metrics labelled db_name.
+func RegisterDBStats(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
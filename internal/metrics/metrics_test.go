@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware_LabelsByRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/api/books/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "404" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := testutil.ToFloat64(httpRequestsInFlight); got != 1 {
+			t.Errorf("in flight = %v during the request, want 1", got)
+		}
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	for _, path := range []string{"/api/books/1", "/api/books/2", "/api/books/404"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "/api/books/{id}", "200")); got != 2 {
+		t.Errorf("200 requests = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "/api/books/{id}", "404")); got != 1 {
+		t.Errorf("404 requests = %v, want 1", got)
+	}
+	// One series per method, route and status, never per raw path
+	if got := testutil.CollectAndCount(httpRequestsTotal); got != 2 {
+		t.Errorf("request series = %d, want 2", got)
+	}
+	if got := testutil.CollectAndCount(httpRequestDuration); got != 2 {
+		t.Errorf("duration series = %d, want 2", got)
+	}
+	if got := testutil.ToFloat64(httpRequestsInFlight); got != 0 {
+		t.Errorf("in flight = %v after the requests, want 0", got)
+	}
+}
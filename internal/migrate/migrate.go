@@ -0,0 +1,286 @@
+// Package migrate applies the numbered SQL migrations embedded in sql/.
+//
+// Each migration is a pair of files NNNN_name.up.sql and NNNN_name.down.sql.
+// Applied versions are recorded in schema_migrations, and every run holds a
+// Postgres advisory lock so two instances never migrate at the same time.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"project.com/myproject/internal/logging"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+// lockKey identifies the advisory lock held while migrating.
+const lockKey = 7_267_812_011
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes one migration and whether it has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration // sorted by version
+}
+
+// New returns a Migrator for the embedded migrations.
+func New(db *sql.DB) (*Migrator, error) {
+	sub, err := fs.Sub(embedded, "sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Load reads every NNNN_name.up.sql / NNNN_name.down.sql pair in fsys.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, name := range names {
+		base := strings.TrimSuffix(name, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+		number, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_name.up.sql", name)
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: label}
+			byVersion[version] = migration
+		} else if migration.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, label)
+		}
+		if direction == ".up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the highest known version, or 0 if there are no migrations.
+func (mg *Migrator) Latest() int {
+	if len(mg.Migrations) == 0 {
+		return 0
+	}
+	return mg.Migrations[len(mg.Migrations)-1].Version
+}
+
+// Up applies every pending migration.
+func (mg *Migrator) Up(ctx context.Context) error {
+	return mg.To(ctx, mg.Latest())
+}
+
+// Down rolls back the most recently applied migration.
+func (mg *Migrator) Down(ctx context.Context) error {
+	return mg.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(mg.Migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[mg.Migrations[i].Version]; ok {
+				return mg.run(ctx, conn, mg.Migrations[i], false)
+			}
+		}
+		logging.FromContext(ctx).Info("no migrations to roll back")
+		return nil
+	})
+}
+
+// To migrates up or down until exactly the migrations up to target are applied.
+func (mg *Migrator) To(ctx context.Context, target int) error {
+	if target < 0 || target > mg.Latest() {
+		return fmt.Errorf("unknown migration version %d (latest is %d)", target, mg.Latest())
+	}
+
+	return mg.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// Roll back newest first, then apply oldest first
+		for i := len(mg.Migrations) - 1; i >= 0; i-- {
+			migration := mg.Migrations[i]
+			if _, ok := applied[migration.Version]; ok && migration.Version > target {
+				if err := mg.run(ctx, conn, migration, false); err != nil {
+					return err
+				}
+			}
+		}
+		for _, migration := range mg.Migrations {
+			if _, ok := applied[migration.Version]; !ok && migration.Version <= target {
+				if err := mg.run(ctx, conn, migration, true); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Status lists every known migration and when it was applied.
+func (mg *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := mg.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range mg.Migrations {
+			appliedAt, ok := applied[migration.Version]
+			statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Version returns the highest applied version, or 0 when nothing is applied.
+func (mg *Migrator) Version(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	err := mg.DB.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// CheckVersion returns an error if the database schema is behind the latest
+// embedded migration. A newer schema is fine: during a rolling deploy the old
+// binaries keep running against the schema the new ones migrated, which is
+// why migrations must stay backward compatible.
+func (mg *Migrator) CheckVersion(ctx context.Context) error {
+	version, err := mg.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if latest := mg.Latest(); version < latest {
+		return fmt.Errorf("schema is at version %d, want %d", version, latest)
+	}
+	return nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory
+// lock, creating the schema_migrations table first if needed.
+func (mg *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := mg.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+	          version integer PRIMARY KEY,
+	          name varchar(255) NOT NULL,
+	          applied_at timestamp without time zone NOT NULL DEFAULT CURRENT_TIMESTAMP)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// run applies (up) or rolls back (down) one migration in its own transaction.
+func (mg *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, direction := migration.Down, "down"
+	if up {
+		script, direction = migration.Up, "up"
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s %s: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Info("migration applied", "version", migration.Version, "name", migration.Name, "direction", direction)
+	return nil
+}
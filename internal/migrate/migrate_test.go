@@ -0,0 +1,48 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestNew_LoadsEmbeddedMigrations(t *testing.T) {
+	migrator, err := New(nil)
+	if err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+	if len(migrator.Migrations) == 0 || migrator.Migrations[0].Version != 1 {
+		t.Fatalf("Expected migration 0001 first, got %+v", migrator.Migrations)
+	}
+}
+
+func TestLoad_SortsAndPairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_index.up.sql":   {Data: []byte("CREATE INDEX x ON t (c);")},
+		"0002_add_index.down.sql": {Data: []byte("DROP INDEX x;")},
+		"0001_init.up.sql":        {Data: []byte("CREATE TABLE t (c int);")},
+		"0001_init.down.sql":      {Data: []byte("DROP TABLE t;")},
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "init" || migrations[1].Version != 2 {
+		t.Fatalf("Unexpected migrations: %+v", migrations)
+	}
+}
+
+func TestLoad_RejectsBadFiles(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {"0001_init.up.sql": {Data: []byte("SELECT 1;")}},
+		"bad name":     {"init.up.sql": {Data: []byte("SELECT 1;")}, "init.down.sql": {Data: []byte("SELECT 1;")}},
+		"name clash": {
+			"0001_a.up.sql": {Data: []byte("SELECT 1;")}, "0001_a.down.sql": {Data: []byte("SELECT 1;")},
+			"0001_b.up.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range cases {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
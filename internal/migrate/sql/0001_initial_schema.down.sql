@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS public.sales_reports;
+DROP TABLE IF EXISTS public.order_items;
+DROP TABLE IF EXISTS public.orders;
+DROP TABLE IF EXISTS public.customers;
+DROP TABLE IF EXISTS public.book_sales;
+DROP TABLE IF EXISTS public.book_genres;
+DROP TABLE IF EXISTS public.books;
+DROP TABLE IF EXISTS public.genres;
+DROP TABLE IF EXISTS public.authors;
@@ -1,11 +1,12 @@
-
-
 -- =========================
--- Schema for  database mylibrary
+-- 0001: initial schema
 -- =========================
+-- Exactly the original db_schema.txt. IF NOT EXISTS lets databases created by
+-- hand from that file be brought under migration control; every later change
+-- is a migration of its own.
 
 -- 1. Authors
-CREATE TABLE public.authors (
+CREATE TABLE IF NOT EXISTS public.authors (
     id serial PRIMARY KEY,
     first_name varchar(100) NOT NULL,
     last_name varchar(100) NOT NULL,
@@ -13,13 +14,13 @@ CREATE TABLE public.authors (
 );
 
 -- 2. Genres
-CREATE TABLE public.genres (
+CREATE TABLE IF NOT EXISTS public.genres (
     id serial PRIMARY KEY,
     name varchar(255) NOT NULL UNIQUE
 );
 
 -- 3. Books
-CREATE TABLE public.books (
+CREATE TABLE IF NOT EXISTS public.books (
     id serial PRIMARY KEY,
     title varchar(255) NOT NULL,
     author_id integer,
@@ -31,7 +32,7 @@ CREATE TABLE public.books (
 );
 
 -- 4. Book_Genres (junction table)
-CREATE TABLE public.book_genres (
+CREATE TABLE IF NOT EXISTS public.book_genres (
     book_id integer NOT NULL,
     genre_id integer NOT NULL,
     PRIMARY KEY (book_id, genre_id),
@@ -42,7 +43,7 @@ CREATE TABLE public.book_genres (
 );
 
 -- 5. Book_Sales
-CREATE TABLE public.book_sales (
+CREATE TABLE IF NOT EXISTS public.book_sales (
     id serial PRIMARY KEY,
     book_id integer,
     quantity_sold integer NOT NULL,
@@ -51,7 +52,7 @@ CREATE TABLE public.book_sales (
 );
 
 -- 6. Customers
-CREATE TABLE public.customers (
+CREATE TABLE IF NOT EXISTS public.customers (
     id serial PRIMARY KEY,
     name varchar(255) NOT NULL,
     email varchar(255) NOT NULL UNIQUE,
@@ -64,7 +65,7 @@ CREATE TABLE public.customers (
 );
 
 -- 7. Orders
-CREATE TABLE public.orders (
+CREATE TABLE IF NOT EXISTS public.orders (
     id serial PRIMARY KEY,
     customer_id integer,
     total_price numeric(10,2) NOT NULL,
@@ -75,7 +76,7 @@ CREATE TABLE public.orders (
 );
 
 -- 8. Order_Items
-CREATE TABLE public.order_items (
+CREATE TABLE IF NOT EXISTS public.order_items (
     id serial PRIMARY KEY,
     order_id integer,
     book_id integer,
@@ -87,19 +88,9 @@ CREATE TABLE public.order_items (
 );
 
 -- 9. Sales_Reports
-CREATE TABLE public.sales_reports (
+CREATE TABLE IF NOT EXISTS public.sales_reports (
     id serial PRIMARY KEY,
     timestamp timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
     total_revenue numeric(10,2) NOT NULL,
     total_orders integer NOT NULL
 );
-
-
-
-
-
-
-
-
-
-
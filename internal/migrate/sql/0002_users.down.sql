@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.refresh_tokens;
+DROP TABLE IF EXISTS public.users;
@@ -0,0 +1,36 @@
+-- =========================
+-- 0002: users and refresh tokens
+-- =========================
+
+-- 1. Users
+CREATE TABLE public.users (
+    id serial PRIMARY KEY,
+    username varchar(100) NOT NULL UNIQUE,
+    email varchar(255) NOT NULL,
+    password_hash varchar(255) NOT NULL,
+    roles text[] NOT NULL DEFAULT '{customer}',
+    customer_id integer,
+    disabled boolean NOT NULL DEFAULT false,
+    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT users_customer_id_fkey FOREIGN KEY (customer_id)
+        REFERENCES public.customers (id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX users_email_lower_key ON public.users (lower(email));
+
+-- 2. Refresh_Tokens (only the SHA-256 of each token is stored)
+CREATE TABLE public.refresh_tokens (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL,
+    token_hash char(64) NOT NULL UNIQUE,
+    family_id varchar(64) NOT NULL,
+    expires_at timestamp without time zone NOT NULL,
+    created_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    used_at timestamp without time zone,
+    revoked_at timestamp without time zone,
+    CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON public.refresh_tokens (family_id);
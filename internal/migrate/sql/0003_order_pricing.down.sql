@@ -0,0 +1,2 @@
+ALTER TABLE public.order_items DROP COLUMN IF EXISTS title, DROP COLUMN IF EXISTS unit_price;
+ALTER TABLE public.orders DROP COLUMN IF EXISTS tax, DROP COLUMN IF EXISTS discount, DROP COLUMN IF EXISTS subtotal;
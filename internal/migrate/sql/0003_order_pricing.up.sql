@@ -0,0 +1,24 @@
+-- =========================
+-- 0003: order pricing
+-- =========================
+-- Orders keep their subtotal, discount and tax next to the total, and items
+-- snapshot the book's price and title when they are ordered. Existing orders
+-- get their total as the subtotal, and existing items the book's current
+-- price and title.
+
+ALTER TABLE public.orders
+    ADD COLUMN subtotal numeric(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN discount numeric(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN tax numeric(10,2) NOT NULL DEFAULT 0;
+UPDATE public.orders SET subtotal = total_price;
+
+ALTER TABLE public.order_items
+    ADD COLUMN unit_price numeric(10,2),
+    ADD COLUMN title varchar(255);
+UPDATE public.order_items oi SET unit_price = b.price, title = b.title
+    FROM public.books b WHERE b.id = oi.book_id;
+UPDATE public.order_items SET unit_price = 0 WHERE unit_price IS NULL;
+UPDATE public.order_items SET title = '' WHERE title IS NULL;
+ALTER TABLE public.order_items
+    ALTER COLUMN unit_price SET NOT NULL,
+    ALTER COLUMN title SET NOT NULL;
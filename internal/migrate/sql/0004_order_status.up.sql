@@ -0,0 +1,28 @@
+-- =========================
+-- 0004: order status workflow
+-- =========================
+-- Statuses are limited to the workflow's and every change is recorded.
+-- Existing statuses are lower-cased and common spellings mapped; the CHECK
+-- fails the migration if any other value is left, so it can be fixed by hand.
+
+UPDATE public.orders SET status = lower(trim(status));
+UPDATE public.orders SET status = 'cancelled' WHERE status = 'canceled';
+UPDATE public.orders SET status = 'delivered' WHERE status = 'completed';
+
+ALTER TABLE public.orders
+    ALTER COLUMN status SET DEFAULT 'pending',
+    ADD CONSTRAINT orders_status_check CHECK (status IN
+        ('pending', 'paid', 'packed', 'shipped', 'delivered', 'cancelled', 'refunded'));
+
+CREATE TABLE public.order_status_history (
+    id serial PRIMARY KEY,
+    order_id integer NOT NULL,
+    from_status varchar(50),
+    to_status varchar(50) NOT NULL,
+    changed_by varchar(100),
+    changed_at timestamp without time zone DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT order_status_history_order_id_fkey FOREIGN KEY (order_id)
+        REFERENCES public.orders (id) ON DELETE CASCADE
+);
+
+CREATE INDEX order_status_history_order_id_idx ON public.order_status_history (order_id);
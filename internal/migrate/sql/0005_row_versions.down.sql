@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS orders_bump_version ON public.orders;
+DROP TRIGGER IF EXISTS customers_bump_version ON public.customers;
+DROP TRIGGER IF EXISTS authors_bump_version ON public.authors;
+DROP TRIGGER IF EXISTS books_bump_version ON public.books;
+DROP FUNCTION IF EXISTS public.bump_version();
+
+ALTER TABLE public.orders DROP COLUMN IF EXISTS version;
+ALTER TABLE public.customers DROP COLUMN IF EXISTS version;
+ALTER TABLE public.authors DROP COLUMN IF EXISTS version;
+ALTER TABLE public.books DROP COLUMN IF EXISTS version;
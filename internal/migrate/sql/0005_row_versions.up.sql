@@ -0,0 +1,26 @@
+-- =========================
+-- 0005: row versions
+-- =========================
+-- Every update of a book, author, customer or order bumps its version, so
+-- writers can update a row only if it has not changed since they read it.
+
+ALTER TABLE public.books ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE public.authors ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE public.customers ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE public.orders ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION public.bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_bump_version BEFORE UPDATE ON public.books
+    FOR EACH ROW EXECUTE FUNCTION public.bump_version();
+CREATE TRIGGER authors_bump_version BEFORE UPDATE ON public.authors
+    FOR EACH ROW EXECUTE FUNCTION public.bump_version();
+CREATE TRIGGER customers_bump_version BEFORE UPDATE ON public.customers
+    FOR EACH ROW EXECUTE FUNCTION public.bump_version();
+CREATE TRIGGER orders_bump_version BEFORE UPDATE ON public.orders
+    FOR EACH ROW EXECUTE FUNCTION public.bump_version();
@@ -0,0 +1,19 @@
+-- =========================
+-- 0006: idempotency keys
+-- =========================
+-- Responses to create requests sent with an Idempotency-Key, replayed when the
+-- request is retried. status is NULL while the first request is in flight;
+-- token identifies the request holding the key.
+
+CREATE TABLE IF NOT EXISTS public.idempotency_keys (
+    key varchar(512) PRIMARY KEY,
+    fingerprint char(64) NOT NULL,
+    token char(32) NOT NULL,
+    status integer,
+    headers jsonb,
+    body bytea,
+    created_at timestamp without time zone NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at timestamp without time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON public.idempotency_keys (expires_at);
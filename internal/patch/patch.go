@@ -0,0 +1,326 @@
+// Package patch applies partial updates to JSON documents: RFC 7396 JSON
+// Merge Patch and RFC 6902 JSON Patch. Handlers apply a patch to the JSON of
+// the current record, then decode, validate and store only the fields the
+// patch touched.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"project.com/myproject/internal/apperr"
+)
+
+// Media types of the supported patch formats. Plain application/json is
+// treated as a merge patch.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// AcceptPatch lists the supported formats, for the Accept-Patch header.
+const AcceptPatch = MergePatchType + ", " + JSONPatchType
+
+var (
+	errNotObject   = apperr.BadRequest("invalid_patch", "The patch must be a JSON object")
+	errInvalidJSON = apperr.BadRequest("invalid_patch", "The patch is not valid JSON")
+)
+
+// Apply patches doc with a patch of the given Content-Type and returns the
+// patched document and the top-level members the patch touched, sorted.
+func Apply(contentType string, doc, patch []byte) ([]byte, []string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case MergePatchType, "application/json", "":
+		return MergePatch(doc, patch)
+	case JSONPatchType:
+		return JSONPatch(doc, patch)
+	default:
+		return nil, nil, apperr.New(apperr.KindUnsupportedMediaType, "unsupported_patch_type",
+			"Use "+MergePatchType+" or "+JSONPatchType)
+	}
+}
+
+// MergePatch applies an RFC 7396 merge patch to the object doc: members set
+// to null are removed, objects are merged recursively and anything else,
+// arrays included, replaces the current value.
+func MergePatch(doc, patch []byte) ([]byte, []string, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, nil, errInvalidJSON.Wrap(err)
+	}
+	members, ok := p.(map[string]any)
+	if !ok {
+		return nil, nil, errNotObject
+	}
+
+	fields := make([]string, 0, len(members))
+	for name := range members {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	patched, err := json.Marshal(merge(target, p))
+	return patched, fields, err
+}
+
+func merge(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = make(map[string]any)
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+		} else {
+			object[name] = merge(object[name], value)
+		}
+	}
+	return object
+}
+
+// Operation is one RFC 6902 operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch applies an RFC 6902 JSON Patch to doc. The operations are
+// applied in order and the whole patch fails if any of them does.
+func JSONPatch(doc, patch []byte) ([]byte, []string, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, nil, apperr.BadRequest("invalid_patch", "The patch must be an array of operations").Wrap(err)
+	}
+
+	touched := make(map[string]bool)
+	for i, op := range ops {
+		path, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, nil, opError(i, err.Error())
+		}
+		if len(path) == 0 {
+			return nil, nil, opError(i, "the whole document cannot be patched")
+		}
+		if op.Op != "test" {
+			touched[path[0]] = true
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, nil, opError(i, "value is required")
+			}
+			value, decodeErr := decode(op.Value)
+			if decodeErr != nil {
+				return nil, nil, opError(i, "value is not valid JSON")
+			}
+			switch op.Op {
+			case "add":
+				target, err = modify(target, path, add(value))
+			case "replace":
+				target, err = modify(target, path, replace(value))
+			case "test":
+				var current any
+				if current, err = get(target, path); err == nil && !reflect.DeepEqual(current, value) {
+					return nil, nil, apperr.Conflict("patch_test_failed", "Test operation "+strconv.Itoa(i)+" failed at "+op.Path)
+				}
+			}
+		case "remove":
+			target, err = modify(target, path, remove)
+		case "move", "copy":
+			var from []string
+			if from, err = parsePointer(op.From); err != nil {
+				return nil, nil, opError(i, err.Error())
+			}
+			if len(from) == 0 {
+				return nil, nil, opError(i, "from cannot be the whole document")
+			}
+			var value any
+			if value, err = get(target, from); err != nil {
+				break
+			}
+			if op.Op == "move" {
+				touched[from[0]] = true
+				if target, err = modify(target, from, remove); err != nil {
+					break
+				}
+			} else {
+				value = clone(value)
+			}
+			target, err = modify(target, path, add(value))
+		default:
+			return nil, nil, opError(i, "unknown op "+strconv.Quote(op.Op))
+		}
+		if err != nil {
+			return nil, nil, opError(i, err.Error())
+		}
+	}
+
+	fields := make([]string, 0, len(touched))
+	for name := range touched {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	patched, err := json.Marshal(target)
+	return patched, fields, err
+}
+
+func opError(i int, reason string) error {
+	return apperr.New(apperr.KindUnprocessable, "invalid_patch_operation", "Patch operation "+strconv.Itoa(i)+": "+reason)
+}
+
+// decode parses JSON keeping numbers as json.Number, so values that are not
+// touched survive the round trip unchanged.
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func clone(v any) any {
+	data, _ := json.Marshal(v)
+	c, _ := decode(data)
+	return c
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("path " + strconv.Quote(pointer) + " must start with /")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// index resolves an array index token; "-" (one past the end) only when end is set.
+func index(token string, length int, end bool) (int, error) {
+	if token == "-" && end {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > length || (i == length && !end) || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.New("index " + strconv.Quote(token) + " is out of range")
+	}
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, errors.New("member " + strconv.Quote(token) + " does not exist")
+			}
+			doc = value
+		case []any:
+			i, err := index(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, errors.New("cannot descend into a scalar at " + strconv.Quote(token))
+		}
+	}
+	return doc, nil
+}
+
+// modify calls fn on the container holding the last token of path and
+// returns doc with the container fn returned in its place.
+func modify(doc any, path []string, fn func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	child, err := get(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = modify(child, path[1:], fn); err != nil {
+		return nil, err
+	}
+	return replace(child)(doc, path[0])
+}
+
+func add(value any) func(any, string) (any, error) {
+	return func(container any, token string) (any, error) {
+		switch node := container.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			i, err := index(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, errors.New("cannot add to a scalar")
+		}
+	}
+}
+
+func replace(value any) func(any, string) (any, error) {
+	return func(container any, token string) (any, error) {
+		if _, err := get(container, []string{token}); err != nil {
+			return nil, err
+		}
+		switch node := container.(type) {
+		case map[string]any:
+			node[token] = value
+		case []any:
+			i, _ := index(token, len(node), false)
+			node[i] = value
+		}
+		return container, nil
+	}
+}
+
+func remove(container any, token string) (any, error) {
+	if _, err := get(container, []string{token}); err != nil {
+		return nil, err
+	}
+	switch node := container.(type) {
+	case map[string]any:
+		delete(node, token)
+	case []any:
+		i, _ := index(token, len(node), false)
+		return append(node[:i], node[i+1:]...), nil
+	}
+	return container, nil
+}
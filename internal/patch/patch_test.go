@@ -0,0 +1,85 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"project.com/myproject/internal/apperr"
+)
+
+const doc = `{"title":"Dune","price":9.99,"genres":["Science Fiction"],"author":{"id":1,"last_name":"Herbert"}}`
+
+func decoded(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+	var v map[string]any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	patched, fields, err := MergePatch([]byte(doc), []byte(`{"price":12.5,"author":{"id":2},"genres":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decoded(t, []byte(`{"title":"Dune","price":12.5,"author":{"id":2,"last_name":"Herbert"}}`))
+	if got := decoded(t, patched); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(fields, []string{"author", "genres", "price"}) {
+		t.Errorf("fields = %v", fields)
+	}
+
+	if _, _, err := MergePatch([]byte(doc), []byte(`[1]`)); !errors.Is(err, apperr.KindBadRequest) {
+		t.Errorf("non-object patch: err = %v", err)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	ops := `[
+		{"op":"test","path":"/title","value":"Dune"},
+		{"op":"add","path":"/genres/0","value":"Classics"},
+		{"op":"replace","path":"/price","value":5},
+		{"op":"copy","from":"/title","path":"/subtitle"},
+		{"op":"remove","path":"/author/last_name"}
+	]`
+	patched, fields, err := JSONPatch([]byte(doc), []byte(ops))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decoded(t, []byte(`{"title":"Dune","subtitle":"Dune","price":5,"genres":["Classics","Science Fiction"],"author":{"id":1}}`))
+	if got := decoded(t, patched); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(fields, []string{"author", "genres", "price", "subtitle"}) {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestJSONPatch_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  string
+		kind apperr.Kind
+	}{
+		{"failed test", `[{"op":"test","path":"/price","value":1}]`, apperr.KindConflict},
+		{"missing member", `[{"op":"replace","path":"/isbn","value":"x"}]`, apperr.KindUnprocessable},
+		{"index out of range", `[{"op":"add","path":"/genres/5","value":"x"}]`, apperr.KindUnprocessable},
+		{"unknown op", `[{"op":"merge","path":"/price","value":1}]`, apperr.KindUnprocessable},
+		{"not an array", `{"op":"add"}`, apperr.KindBadRequest},
+	}
+	for _, tt := range tests {
+		if _, _, err := JSONPatch([]byte(doc), []byte(tt.ops)); !errors.Is(err, tt.kind) {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.kind)
+		}
+	}
+}
+
+func TestApply_UnsupportedType(t *testing.T) {
+	if _, _, err := Apply("application/xml", []byte(doc), []byte(`{}`)); !errors.Is(err, apperr.KindUnsupportedMediaType) {
+		t.Errorf("err = %v", err)
+	}
+}
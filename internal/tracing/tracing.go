@@ -0,0 +1,152 @@
+// Package tracing sets up OpenTelemetry tracing: the exporter, W3C trace
+// context propagation and the server span for every routed request.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"project.com/myproject/internal/logging"
+)
+
+// Options selects where spans are exported.
+type Options struct {
+	// Exporter is "none", "otlp", "stdout" or "file".
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector URL; empty uses OTEL_EXPORTER_OTLP_*.
+	Endpoint    string
+	File        string
+	ServiceName string
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and the W3C trace context and
+// baggage propagators. The returned function flushes pending spans; call it
+// on shutdown. With the "none" exporter spans are not recorded, but incoming
+// trace context is still passed on.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file io.Closer
+	switch opts.Exporter {
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var clientOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "file":
+		f, openErr := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if openErr != nil {
+			return nil, fmt.Errorf("trace file: %w", openErr)
+		}
+		file = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s trace exporter: %w", opts.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+const instrumentationName = "project.com/myproject/internal/tracing"
+
+// Middleware starts a server span per request, named after the method and
+// route template ("GET /api/books/{id}") and continuing the caller's trace
+// from the traceparent header. It adds trace_id to the request logger, so it
+// must run inside mux (r.Use) and after logging.RequestID.
+func Middleware(next http.Handler) http.Handler {
+	tracer := otel.Tracer(instrumentationName)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(r.RemoteAddr),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("trace_id", sc.TraceID().String()))
+		}
+
+		rec := &logging.ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.Status), semconv.HTTPResponseBodySize(int(rec.Bytes)))
+		if rec.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status))
+		}
+	})
+}
+
+// End records err on span, unless it is one of the expected errors (such as
+// sql.ErrNoRows), and ends the span.
+func End(span trace.Span, err error, expected ...error) {
+	if err != nil && !isExpected(err, expected) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func isExpected(err error, expected []error) bool {
+	for _, e := range expected {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"project.com/myproject/internal/logging"
+)
+
+func TestMiddleware_RouteSpanContinuesTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var logs bytes.Buffer
+	logger, _ := logging.New(&logs, "info", "json")
+
+	r := mux.NewRouter()
+	r.Use(logging.RequestID(logger))
+	r.Use(Middleware)
+	r.HandleFunc("/api/books/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("inside")
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	req := httptest.NewRequest("GET", "/api/books/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /api/books/{id}" {
+		t.Errorf("span name = %q", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the caller's", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span ID = %s", got)
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want error for a 502", span.Status().Code)
+	}
+	found := false
+	for _, attr := range span.Attributes() {
+		if attr.Key == semconv.HTTPResponseStatusCodeKey && attr.Value.AsInt64() == http.StatusBadGateway {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("missing status code attribute: %v", span.Attributes())
+	}
+
+	var record map[string]any
+	json.Unmarshal(logs.Bytes(), &record)
+	if record["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("log record has trace_id %v", record["trace_id"])
+	}
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), Options{Exporter: "file", File: path, ServiceName: "test", SampleRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "report.daily")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"report.daily"`) {
+		t.Errorf("trace file does not contain the span: %s", data)
+	}
+}
+
+func TestSetup_RejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "carrier-pigeon"}); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
@@ -0,0 +1,231 @@
+// Package validate checks request bodies against rules declared in struct
+// tags and reports every violation at once as apperr field errors:
+//
+//	Title  string  `json:"title" validate:"required,max=255"`
+//	Price  float64 `json:"price" validate:"min=0"`
+//	Items  []Item  `json:"items" validate:"required,dive"`
+//
+// Rules:
+//
+//	required         non-blank string, non-zero number or time, non-empty slice
+//	max=N, min=N     characters of a string, items of a slice, or a number's value
+//	gt=N             number strictly greater than N
+//	email            a bare email address
+//	country          ISO 3166-1 alpha-2 or alpha-3 code, in any case
+//	postal_code=F    postal code in the format of the country in sibling field F
+//	ref              nested record referenced by ID; its ID must be set
+//	dive             the following rules apply to each slice element; alone,
+//	                 nested structs are validated by their own tags
+//
+// Format rules (email, country, postal_code) skip empty strings; combine them
+// with required when the field is mandatory.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"project.com/myproject/internal/apperr"
+)
+
+// Struct validates the fields of v, a struct or a pointer to one. Field
+// names are JSON paths built from the json tags, e.g. "items[0].quantity".
+func Struct(v any) []apperr.FieldError {
+	var c checker
+	c.structFields("", reflect.Indirect(reflect.ValueOf(v)))
+	return c.errs
+}
+
+// Error returns a validation error for fields, or nil if there are none.
+func Error(fields []apperr.FieldError) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return apperr.Validation(fields...)
+}
+
+// Country returns the alpha-2 code of an ISO 3166-1 alpha-2 or alpha-3
+// country code, or "" if code is not one.
+func Country(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := countries[code]; ok {
+		return code
+	}
+	return alpha3[code]
+}
+
+// postalCodes holds the postal code formats of the countries we ship to most;
+// other countries get a loose alphanumeric check.
+var postalCodes = map[string]*regexp.Regexp{
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"CA": regexp.MustCompile(`^[A-Za-z]\d[A-Za-z] ?\d[A-Za-z]\d$`),
+	"GB": regexp.MustCompile(`^[A-Za-z]{1,2}\d[A-Za-z\d]? ?\d[A-Za-z]{2}$`),
+	"IE": regexp.MustCompile(`^[A-Za-z]\d[\dWw] ?[A-Za-z\d]{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Za-z]{2}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"CH": regexp.MustCompile(`^\d{4}$`),
+	"DK": regexp.MustCompile(`^\d{4}$`),
+	"NO": regexp.MustCompile(`^\d{4}$`),
+	"SE": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{2}-\d{3}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+	"IN": regexp.MustCompile(`^\d{6}$`),
+	"CN": regexp.MustCompile(`^\d{6}$`),
+	"BR": regexp.MustCompile(`^\d{5}-?\d{3}$`),
+}
+
+var anyPostalCode = regexp.MustCompile(`^[A-Za-z\d][A-Za-z\d -]{1,9}$`)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type checker struct {
+	errs []apperr.FieldError
+}
+
+func (c *checker) add(path, code, format string, args ...any) {
+	c.errs = append(c.errs, apperr.FieldError{Field: path, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) structFields(prefix string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		c.field(name, v, v.Field(i), strings.Split(tag, ","))
+	}
+}
+
+// field applies rules to v; parent is the struct holding v, for rules that
+// look at sibling fields.
+func (c *checker) field(path string, parent, v reflect.Value, rules []string) {
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			c.dive(path, v, rules[i+1:])
+			return
+		case "required":
+			if isBlank(v) {
+				c.add(path, "required", "Is required")
+				return
+			}
+		case "max", "min", "gt":
+			c.bound(path, v, name, param)
+		case "email":
+			if s := v.String(); s != "" {
+				if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s || !strings.Contains(s[strings.LastIndex(s, "@"):], ".") {
+					c.add(path, "email", "Must be a valid email address")
+				}
+			}
+		case "country":
+			if s := v.String(); s != "" && Country(s) == "" {
+				c.add(path, "country", "Must be an ISO 3166-1 country code")
+			}
+		case "postal_code":
+			if s := strings.TrimSpace(v.String()); s != "" {
+				country := Country(parent.FieldByName(param).String())
+				format, ok := postalCodes[country]
+				if !ok {
+					format = anyPostalCode
+				}
+				if !format.MatchString(s) {
+					if country != "" {
+						c.add(path, "postal_code", "Is not a valid postal code for %s", country)
+					} else {
+						c.add(path, "postal_code", "Is not a valid postal code")
+					}
+				}
+			}
+		case "ref":
+			if v.FieldByName("ID").Int() <= 0 {
+				c.add(path+".id", "required", "Is required")
+			}
+		default:
+			panic("validate: unknown rule " + strconv.Quote(rule) + " on " + path)
+		}
+	}
+}
+
+func (c *checker) dive(path string, v reflect.Value, rules []string) {
+	if v.Kind() == reflect.Struct {
+		c.structFields(path, v)
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		elemPath := path + "[" + strconv.Itoa(i) + "]"
+		if len(rules) == 0 && elem.Kind() == reflect.Struct {
+			c.structFields(elemPath, elem)
+		} else {
+			c.field(elemPath, v, elem, rules)
+		}
+	}
+}
+
+// bound checks max, min and gt: string length, slice length or numeric value.
+func (c *checker) bound(path string, v reflect.Value, rule, param string) {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("validate: bad " + rule + " limit on " + path)
+	}
+
+	var n float64
+	var code, unit string
+	switch v.Kind() {
+	case reflect.String:
+		n, code, unit = float64(utf8.RuneCountInString(v.String())), "_length", " characters"
+	case reflect.Slice:
+		n, code, unit = float64(v.Len()), "_items", " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		panic("validate: " + rule + " does not apply to " + path)
+	}
+
+	switch {
+	case rule == "max" && n > limit:
+		c.add(path, "max"+code, "Must be at most %s%s", param, unit)
+	case rule == "min" && n < limit:
+		c.add(path, "min"+code, "Must be at least %s%s", param, unit)
+	case rule == "gt" && n <= limit:
+		c.add(path, "gt", "Must be greater than %s", param)
+	}
+}
+
+func isBlank(v reflect.Value) bool {
+	switch {
+	case v.Kind() == reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).IsZero()
+	case v.Kind() == reflect.Slice:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
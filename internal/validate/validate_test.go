@@ -0,0 +1,108 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	m "project.com/myproject/models"
+)
+
+func codes(t *testing.T, v any) map[string]string {
+	t.Helper()
+	got := make(map[string]string)
+	for _, field := range Struct(v) {
+		if _, dup := got[field.Field]; dup {
+			t.Errorf("field %s reported twice", field.Field)
+		}
+		got[field.Field] = field.Code
+	}
+	return got
+}
+
+func TestStruct_ReportsEveryViolation(t *testing.T) {
+	book := m.Book{
+		Title:  "   ",
+		Genres: []string{"Fantasy", "", strings.Repeat("x", 256)},
+		Price:  -1,
+		Stock:  -3,
+	}
+	want := map[string]string{
+		"title":        "required",
+		"author.id":    "required",
+		"genres[1]":    "required",
+		"genres[2]":    "max_length",
+		"published_at": "required",
+		"price":        "min",
+		"stock":        "min",
+	}
+	got := codes(t, book)
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("%s: code %q, want %q", field, got[field], code)
+		}
+	}
+}
+
+func TestStruct_ValidBook(t *testing.T) {
+	book := m.Book{Title: "Dune", Author: m.Author{ID: 1}, PublishedAt: time.Now(), Price: 0, Stock: 0}
+	if errs := Struct(book); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestStruct_Customer(t *testing.T) {
+	tests := []struct {
+		name     string
+		customer m.Customer
+		want     map[string]string
+	}{
+		{"valid US", m.Customer{Name: "Jane", Email: "jane@example.com", PostalCode: "62701-1234", Country: "USA"}, nil},
+		{"valid GB", m.Customer{Name: "Jane", Email: "jane@example.co.uk", PostalCode: "SW1A 1AA", Country: "gb"}, nil},
+		{"unknown format", m.Customer{Name: "Jane", Email: "jane@example.com", PostalCode: "AB-123", Country: "KE"}, nil},
+		{"bad email", m.Customer{Name: "Jane", Email: "Jane <jane@example.com>"}, map[string]string{"email": "email"}},
+		{"email without domain", m.Customer{Name: "Jane", Email: "jane@localhost"}, map[string]string{"email": "email"}},
+		{"bad country", m.Customer{Name: "Jane", Email: "jane@example.com", Country: "Atlantis"}, map[string]string{"country": "country"}},
+		{"bad postal code", m.Customer{Name: "Jane", Email: "jane@example.com", PostalCode: "6270", Country: "US"}, map[string]string{"postal_code": "postal_code"}},
+		{"missing", m.Customer{}, map[string]string{"name": "required", "email": "required"}},
+	}
+	for _, tt := range tests {
+		got := codes(t, tt.customer)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for field, code := range tt.want {
+			if got[field] != code {
+				t.Errorf("%s: %s code %q, want %q", tt.name, field, got[field], code)
+			}
+		}
+	}
+}
+
+func TestStruct_DivesIntoOrderItems(t *testing.T) {
+	order := m.Order{
+		Customer: m.Customer{ID: 1},
+		Items:    []m.OrderItem{{Book: m.Book{ID: 1}, Quantity: 1}, {Quantity: 0}},
+	}
+	want := map[string]string{"items[1].book.id": "required", "items[1].quantity": "gt"}
+	got := codes(t, order)
+	if len(got) != len(want) || got["items[1].book.id"] != "required" || got["items[1].quantity"] != "gt" {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := codes(t, m.Order{Customer: m.Customer{ID: 1}}); got["items"] != "required" {
+		t.Errorf("empty order: got %v", got)
+	}
+}
+
+func TestCountry(t *testing.T) {
+	for in, want := range map[string]string{"US": "US", "usa": "US", " de ": "DE", "XX": "", "": ""} {
+		if got := Country(in); got != want {
+			t.Errorf("Country(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
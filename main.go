@@ -5,94 +5,343 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/ulule/limiter/v3"
+	memorystore "github.com/ulule/limiter/v3/drivers/store/memory"
+	redisstore "github.com/ulule/limiter/v3/drivers/store/redis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"project.com/myproject/auth"
+	"project.com/myproject/config"
 	h "project.com/myproject/handlers"
+	"project.com/myproject/internal/apperr"
 	"project.com/myproject/internal/cache"
+	"project.com/myproject/internal/health"
+	"project.com/myproject/internal/idempotency"
+	"project.com/myproject/internal/logging"
+	"project.com/myproject/internal/metrics"
+	"project.com/myproject/internal/migrate"
+	"project.com/myproject/internal/tracing"
 	s "project.com/myproject/stores"
 )
 
-const (
-	dbHost     = "localhost"
-	dbPort     = 5432
-	dbUser     = "postgres"
-	dbPassword = "2SOUsalma2003"
-	dbName     = "mylibrary"
-)
-
 var (
-	httpRequestsTotal = prometheus.NewCounterVec(
+	reportJobRuns = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
+			Name: "report_job_runs_total",
+			Help: "Total number of daily report runs by result",
+		},
+		[]string{"result"},
+	)
+	reportJobDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "report_job_duration_seconds",
+			Help:    "Time taken to generate the daily report",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 10), // 50ms to ~25s
+		},
+	)
+	reportJobLastSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "report_job_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful daily report",
 		},
-		[]string{"method", "endpoint"},
 	)
 )
 
 func init() {
-	prometheus.MustRegister(httpRequestsTotal)
+	prometheus.MustRegister(reportJobRuns, reportJobDuration, reportJobLastSuccess)
 }
 
-func metricsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		httpRequestsTotal.WithLabelValues(r.Method, r.URL.Path).Inc()
-		next.ServeHTTP(w, r)
-	})
+// apiRoute declares which roles may call a method/path combination under /api.
+type apiRoute struct {
+	path    string
+	methods []string
+	handler http.HandlerFunc
+	roles   []string
+}
+
+var (
+	anyRole     = []string{auth.RoleAdmin, auth.RoleStaff, auth.RoleCustomer, auth.RoleReporting}
+	staffRoles  = []string{auth.RoleAdmin, auth.RoleStaff}
+	orderRoles  = []string{auth.RoleAdmin, auth.RoleStaff, auth.RoleCustomer}
+	reportRoles = []string{auth.RoleAdmin, auth.RoleReporting}
+	adminRoles  = []string{auth.RoleAdmin}
+)
+
+// apiRoutes is the permission table for the protected API. Customers can read
+// the catalog and their own orders; everything else needs an elevated role.
+// Creates are wrapped in idempotent so that they honor Idempotency-Key.
+func apiRoutes(handler *h.Handler, authHandler *h.AuthHandler, idempotent func(http.HandlerFunc) http.HandlerFunc) []apiRoute {
+	return []apiRoute{
+		// Books API
+		{"/books/{id}", []string{"GET"}, handler.HandleBook, anyRole},
+		{"/books/{id}", []string{"PUT", "PATCH", "DELETE"}, handler.HandleBook, staffRoles},
+		{"/books", []string{"GET"}, handler.HandleBooks, anyRole},
+		{"/books", []string{"POST"}, idempotent(handler.HandleBooks), staffRoles},
+
+		// Authors API
+		{"/authors/{id}", []string{"GET"}, handler.HandleAuthor, anyRole},
+		{"/authors/{id}", []string{"PUT", "PATCH", "DELETE"}, handler.HandleAuthor, staffRoles},
+		{"/authors", []string{"GET"}, handler.HandleAuthors, anyRole},
+		{"/authors", []string{"POST"}, idempotent(handler.HandleAuthors), staffRoles},
+
+		// Customers API
+		{"/customers/{id}", []string{"GET", "PUT", "PATCH", "DELETE"}, handler.HandleCustomer, staffRoles},
+		{"/customers", []string{"GET"}, handler.HandleCustomers, staffRoles},
+		{"/customers", []string{"POST"}, idempotent(handler.HandleCustomers), staffRoles},
+
+		// Orders API (customers are scoped to their own orders in the handler)
+		{"/orders/{id}", []string{"GET"}, handler.HandleOrder, orderRoles},
+		{"/orders/{id}", []string{"PUT", "PATCH", "DELETE"}, handler.HandleOrder, staffRoles},
+		{"/orders", []string{"GET"}, handler.HandleOrders, orderRoles},
+		{"/orders", []string{"POST"}, idempotent(handler.HandleOrders), orderRoles},
+		{"/orders/{id}/history", []string{"GET"}, handler.HandleOrderHistory, orderRoles},
+		{"/orders/{id}/items", []string{"PUT", "PATCH"}, handler.HandleOrderItems, orderRoles},
+		{"/orders/{id}/{action:cancel}", []string{"POST"}, handler.HandleOrderTransition, orderRoles},
+		{"/orders/{id}/{action:pay|pack|ship|deliver|refund}", []string{"POST"}, handler.HandleOrderTransition, staffRoles},
+
+		// Reports API
+		{"/reports", []string{"GET"}, handler.HandleReports, reportRoles},
+
+		// Users API
+		{"/users/{id}/roles", []string{"PUT"}, authHandler.HandleUserRoles, adminRoles},
+	}
+}
+
+// openDatabase connects to Postgres using the configured credentials. Every
+// SQL statement is traced (the statement, not its parameters).
+func openDatabase(cfg config.DatabaseConfig) (*sql.DB, error) {
+	return otelsql.Open("postgres", cfg.DSN(),
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 }
 
 func main() {
-	// Initialize Redis Cache
-	cache.InitCache()
+	// Configuration: defaults < config file < environment < flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
 
-	// Connect to Database
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+	// Structured logging; every request gets a logger carrying its request ID
+	logger, err := logging.New(os.Stdout, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal("invalid log configuration", err)
+	}
+	slog.SetDefault(logger)
+
+	// Subcommands: "migrate up|down|status|to N" and "config print [--redact]"
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			if err := runMigrate(cfg, args[1:]); err != nil {
+				fatal("migration failed", err)
+			}
+		case "config":
+			if err := runConfig(cfg, args[1:]); err != nil {
+				fatal("config command failed", err)
+			}
+		default:
+			fatal("unknown command", fmt.Errorf("%q", args[0]))
+		}
+		return
+	}
 
-	db, err := sql.Open("postgres", dsn)
+	// Tracing: spans for routes, store calls, SQL, cache and Redis, continuing
+	// W3C traceparent headers from callers
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		File:        cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("failed to set up tracing", err)
 	}
-	defer db.Close()
 
-	// Initialize Store
-	store := s.NewPostgresStore(db)
+	// Initialize the response cache: a local LRU in front of Redis by default,
+	// falling back to the LRU alone while Redis is unreachable
+	var redisClient *redis.Client
+	if cfg.Cache.Mode != "local" || cfg.RateLimit.Store == "redis" || cfg.Idempotency.Store == "redis" {
+		redisClient = cache.NewRedisClient(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB)
+	}
+	var responseCache cache.Cache
+	switch cfg.Cache.Mode {
+	case "local":
+		responseCache = cache.NewLRU(cfg.Cache.LocalSize)
+	case "redis":
+		responseCache = cache.NewRedis(redisClient)
+	default:
+		tiered := cache.NewTiered(cache.NewLRU(cfg.Cache.LocalSize), cache.NewRedis(redisClient), cfg.Cache.LocalTTL)
+		healthCtx, stopHealthChecks := context.WithCancel(context.Background())
+		defer stopHealthChecks()
+		go tiered.Run(healthCtx, cfg.Cache.HealthCheckInterval)
+		responseCache = tiered
+	}
+	responseCache = cache.NewTraced(responseCache)
+
+	// Readiness checks, each bounded by its own timeout
+	checker := health.NewChecker(cfg.Server.HealthCheckTimeout)
+	if redisClient != nil {
+		ping := func(ctx context.Context) error { return redisClient.Ping(ctx).Err() }
+		if cfg.Cache.Mode == "redis" || cfg.Idempotency.Store == "redis" {
+			checker.Add("redis", ping)
+		} else {
+			// The tiered cache falls back to the local tier and rate limiting fails open
+			checker.AddOptional("redis", ping)
+		}
+	}
 
-	// Initialize JWT Manager and Middleware
-	jwtManager := auth.NewJWTManager("your_secret_key", time.Hour)
-	authMiddleware := auth.NewAuthMiddleware(jwtManager)
+	// Initialize Store. The memory backend runs without Postgres for local
+	// development; data is lost on restart.
+	var store interface {
+		s.Store
+		s.AuthStore
+	}
+	var idempotencyStore idempotency.Store
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	if cfg.Database.Backend == "memory" {
+		logger.Warn("using the in-memory store")
+		store = s.NewMemoryStore()
+	} else {
+		// Connect to Database
+		db, err := openDatabase(cfg.Database)
+		if err != nil {
+			fatal("failed to connect to database", err)
+		}
+		defer db.Close()
+		if err := metrics.RegisterDBStats(db, cfg.Database.Name); err != nil {
+			fatal("failed to register database metrics", err)
+		}
+		migrator, err := migrate.New(db)
+		if err != nil {
+			fatal("failed to load migrations", err)
+		}
+		checker.Add("database", db.PingContext)
+		checker.Add("migrations", migrator.CheckVersion)
+
+		store = s.NewPostgresStore(db)
+		if cfg.Idempotency.Store == "postgres" {
+			keys := idempotency.NewPostgresStore(db)
+			go keys.Run(cleanupCtx, time.Hour)
+			idempotencyStore = keys
+		}
+	}
+	// Create the configured admin user; a failure (e.g. migrations not yet
+	// applied) is logged and the server still starts
+	bootstrapCtx, cancelBootstrap := context.WithTimeout(context.Background(), cfg.Server.RequestTimeout)
+	if err := bootstrapAdmin(bootstrapCtx, store, cfg.Auth); err != nil {
+		logger.Error("failed to create the admin user", "err", err)
+	}
+	cancelBootstrap()
+	if idempotencyStore == nil {
+		if cfg.Idempotency.Store == "redis" {
+			idempotencyStore = idempotency.NewRedisStore(redisClient)
+		} else {
+			keys := idempotency.NewMemoryStore()
+			go keys.Run(cleanupCtx, time.Minute)
+			idempotencyStore = keys
+		}
+	}
+
+	// Initialize the JWT Manager and Middleware. A configured JWT secret signs
+	// with HS256; otherwise signing keys are rotated on disk and old keys are
+	// accepted for twice the token lifetime. Instances sharing the keys
+	// directory reload it every minute to pick up each other's keys.
+	var jwtManager *auth.JWTManager
+	if cfg.Auth.JWTSecret != "" {
+		jwtManager = auth.NewJWTManager(cfg.Auth.JWTSecret, cfg.Auth.TokenDuration)
+	} else {
+		if err := os.MkdirAll(cfg.Auth.KeysDir, 0700); err != nil {
+			fatal("failed to create keys directory", err)
+		}
+		keys, err := auth.LoadKeySet(cfg.Auth.KeysDir, 2*cfg.Auth.TokenDuration)
+		if err != nil {
+			fatal("failed to load signing keys", err)
+		}
+		rotator := auth.NewKeyRotator(keys, cfg.Auth.KeysDir, cfg.Auth.SigningAlgorithm, cfg.Auth.KeyRotationInterval, 2*cfg.Auth.TokenDuration)
+		if err := rotator.EnsureKey(); err != nil {
+			fatal("failed to create signing key", err)
+		}
+		rotationCtx, stopRotation := context.WithCancel(context.Background())
+		defer stopRotation()
+		go rotator.Start(rotationCtx, time.Minute)
+
+		jwtManager = auth.NewJWTManagerWithKeys(keys, cfg.Auth.TokenDuration)
+	}
+	revocations := auth.NewRevocationList(redisClient)
+	authMiddleware := auth.NewAuthMiddleware(jwtManager, revocations)
 
 	// Initialize Handlers
-	authHandler := h.NewAuthHandler(jwtManager)
-	handler := h.NewHandler(store)
+	tracedStore := s.NewTracingStore(store)
+	authHandler := h.NewAuthHandler(jwtManager, s.NewTracingAuthStore(store), revocations)
+	loader := cache.NewLoader(responseCache)
+	loader.StaleTTL = cfg.Cache.StaleTTL
+	loader.NegativeTTL = cfg.Cache.NegativeTTL
+	loader.Beta = cfg.Cache.EarlyExpirationBeta
+	loader.RefreshTimeout = cfg.Server.RequestTimeout
+	handler := h.NewHandler(s.NewInvalidatingStore(tracedStore, loader), loader)
+	handler.RequestTimeout = cfg.Server.RequestTimeout
+
+	// Initialize Rate Limiting, shared between instances with the Redis store
+	rateLimiter, err := newRateLimiter(cfg.RateLimit, redisClient)
+	if err != nil {
+		fatal("failed to set up rate limiting", err)
+	}
+
+	// Idempotency-Key support for creates, scoped per user
+	idempotencyMiddleware := idempotency.Middleware(idempotencyStore, idempotency.Options{
+		TTL:         cfg.Idempotency.TTL,
+		LockTimeout: cfg.Idempotency.LockTimeout,
+		Client: func(r *http.Request) string {
+			claims, _ := auth.ClaimsFromContext(r.Context())
+			if claims == nil {
+				return ""
+			}
+			return claims.Username
+		},
+	})
+	idempotent := func(next http.HandlerFunc) http.HandlerFunc {
+		return idempotencyMiddleware(next).ServeHTTP
+	}
 
-	// Create Router
+	// Create Router; unknown routes and methods get problem+json errors too
 	r := mux.NewRouter()
+	r.NotFoundHandler = apperr.NotFoundHandler()
+	r.MethodNotAllowedHandler = apperr.MethodNotAllowedHandler()
 
-	// Apply logging and metrics middleware
-	r.Use(loggingMiddleware)
-	r.Use(metricsMiddleware)
+	// Apply request ID, tracing, access logging and metrics middleware
+	r.Use(logging.RequestID(logger))
+	r.Use(tracing.Middleware)
+	r.Use(logging.AccessLog)
+	r.Use(metrics.Middleware)
 
 	// Public Routes (No Authentication Needed)
-	r.HandleFunc("/login", authHandler.HandleLogin).Methods("POST")
-	r.HandleFunc("/register", authHandler.HandleRegister).Methods("POST")
+	authHandler.RegisterRoutes(r)
 
 	// Debugging: Print Registered Routes
-	log.Println("🔹 Registered Routes:")
 	_ = r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		path, err := route.GetPathTemplate()
 		if err == nil {
-			log.Println("➡", path)
+			logger.Debug("registered route", "path", path)
 		}
 		return nil
 	})
@@ -100,75 +349,76 @@ func main() {
 	// Protected Routes (Require Authentication)
 	protected := r.PathPrefix("/api").Subrouter()
 	protected.Use(authMiddleware.Middleware)
-	protected.Use(auth.NewRateLimiterMiddleware()) // Apply Rate Limiting
+	protected.Use(rateLimiter) // Apply Rate Limiting
 
-	// Books API
-	protected.HandleFunc("/books/{id}", handler.HandleBook).Methods("GET", "DELETE", "PUT")
-	protected.HandleFunc("/books", handler.HandleBooks).Methods("GET", "POST")
-
-	// Authors API
-	protected.HandleFunc("/authors/{id}", handler.HandleAuthor).Methods("GET", "DELETE", "PUT")
-	protected.HandleFunc("/authors", handler.HandleAuthors).Methods("GET", "POST")
-
-	// Customers API
-	protected.HandleFunc("/customers/{id}", handler.HandleCustomer).Methods("GET", "DELETE", "PUT")
-	protected.HandleFunc("/customers", handler.HandleCustomers).Methods("GET", "POST")
-
-	// Orders API
-	protected.HandleFunc("/orders/{id}", handler.HandleOrder).Methods("GET", "DELETE", "PUT")
-	protected.HandleFunc("/orders", handler.HandleOrders).Methods("GET", "POST")
-
-	// Reports API
-	protected.HandleFunc("/reports", handler.HandleReports).Methods("GET")
+	// Register API routes from the permission table
+	for _, rt := range apiRoutes(handler, authHandler, idempotent) {
+		protected.Handle(rt.path, auth.RequireRoles(rt.roles...)(rt.handler)).Methods(rt.methods...)
+	}
 
 	// Metrics Endpoint (For Prometheus)
 	r.Handle("/metrics", promhttp.Handler())
 
-	// Ensure "reports" directory exists
-	if _, err := os.Stat("reports"); os.IsNotExist(err) {
-		if err := os.Mkdir("reports", 0755); err != nil {
-			log.Fatalf("Failed to create reports directory: %v", err)
-		}
+	// Liveness and readiness probes
+	r.HandleFunc("/healthz", checker.HandleLiveness).Methods("GET")
+	r.HandleFunc("/readyz", checker.HandleReadiness).Methods("GET")
+
+	// Ensure the reports directory exists
+	if err := os.MkdirAll(cfg.Reports.Dir, 0755); err != nil {
+		fatal("failed to create reports directory", err)
 	}
+	checker.Add("reports_dir", health.DirWritable(cfg.Reports.Dir))
 
-	log.Println("🚀 Server running on http://localhost:8080")
+	logger.Info("server listening", "addr", cfg.Server.Addr)
 
 	// Graceful Shutdown Handling
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
 	// Start Daily Report Generator
-	go startDailyReportGenerator(store)
+	go startDailyReportGenerator(tracedStore, cfg.Reports.Dir, cfg.Reports.Interval)
 
 	// Start HTTP Server
 	server := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.Server.Addr,
 		Handler: r,
 	}
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("❌ Could not start server: %v", err)
+			fatal("could not start server", err)
 		}
 	}()
 
 	<-stop
-	log.Println("🛑 Shutting down server...")
+
+	// Fail readiness first so load balancers stop sending new requests; a
+	// second signal skips the wait
+	checker.ShutDown()
+	logger.Info("readiness failing, waiting before shutdown", "delay", cfg.Server.ShutdownDelay)
+	select {
+	case <-time.After(cfg.Server.ShutdownDelay):
+	case <-stop:
+	}
+	logger.Info("shutting down server")
 
 	// Graceful Shutdown of HTTP Server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server Shutdown Failed: %v", err)
+		fatal("server shutdown failed", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("error flushing traces", "err", err)
 	}
 
-	log.Println("✅ Server gracefully stopped.")
+	logger.Info("server gracefully stopped")
 }
 
-// Background Job for Daily Report Generation
-func startDailyReportGenerator(store *s.PostgresStore) {
-	ticker := time.NewTicker(24 * time.Hour)
+// Background Job for Daily Report Generation, writing into dir every interval
+func startDailyReportGenerator(store s.ReportStore, dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 
 	defer ticker.Stop()
 
@@ -178,38 +428,81 @@ func startDailyReportGenerator(store *s.PostgresStore) {
 		now := time.Now()
 		yesterday := now.AddDate(0, 0, -1)
 		start := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, yesterday.Location())
-		end := start.Add(24 * time.Hour)
 
-		ctx := context.Background()
-
-		report, err := store.GetSalesReport(ctx, start, end)
+		ctx := logging.WithLogger(context.Background(), slog.Default().With("job", "daily_report"))
+		began := time.Now()
+		err := generateDailyReport(ctx, store, dir, start)
+		reportJobDuration.Observe(time.Since(began).Seconds())
 		if err != nil {
-			log.Printf("Error generating daily report: %v", err)
+			reportJobRuns.WithLabelValues("failure").Inc()
+			logging.FromContext(ctx).Error("error generating daily report", "err", err)
 			continue
 		}
+		reportJobRuns.WithLabelValues("success").Inc()
+		reportJobLastSuccess.SetToCurrentTime()
+	}
+}
 
-		filename := fmt.Sprintf("reports/daily_report_%s.json", start.Format("20060102"))
-		data, err := json.MarshalIndent(report, "", "  ")
-		if err != nil {
-			log.Printf("Error marshalling daily report: %v", err)
-			continue
-		}
+// generateDailyReport writes the sales report for the day starting at start,
+// traced as one "report.daily" span.
+func generateDailyReport(ctx context.Context, store s.ReportStore, dir string, start time.Time) (err error) {
+	ctx, span := otel.Tracer("project.com/myproject").Start(ctx, "report.daily",
+		trace.WithAttributes(attribute.String("report.date", start.Format("2006-01-02"))))
+	defer func() { tracing.End(span, err) }()
+
+	report, err := store.GetSalesReport(ctx, start, start.Add(24*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(dir, fmt.Sprintf("daily_report_%s.json", start.Format("20060102")))
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling daily report: %w", err)
+	}
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("writing daily report to file: %w", err)
+	}
+
+	span.SetAttributes(attribute.String("report.file", filename))
+	logging.FromContext(ctx).Info("daily report generated", "file", filename)
+	return nil
+}
 
-		err = os.WriteFile(filename, data, 0644)
+// newRateLimiter builds the rate limiting middleware from the configuration.
+func newRateLimiter(cfg config.RateLimitConfig, redisClient *redis.Client) (func(http.Handler) http.Handler, error) {
+	var store limiter.Store
+	if cfg.Store == "redis" {
+		var err error
+		store, err = redisstore.NewStoreWithOptions(redisClient, limiter.StoreOptions{Prefix: "rate_limit"})
 		if err != nil {
-			log.Printf("Error writing daily report to file: %v", err)
-			continue
+			return nil, err
 		}
+	} else {
+		store = memorystore.NewStore()
+	}
 
-		log.Printf("📊 Daily report generated: %s", filename)
+	opts := auth.RateLimitOptions{
+		Default:        auth.RateLimitRule{Limit: cfg.Requests, Period: cfg.Period},
+		TrustedProxies: cfg.TrustedProxies,
+		Allowlist:      cfg.Allowlist,
 	}
+	for _, rule := range cfg.Rules {
+		opts.Rules = append(opts.Rules, auth.RateLimitRule{
+			Name:    rule.Name,
+			Routes:  rule.Routes,
+			Methods: rule.Methods,
+			Roles:   rule.Roles,
+			Limit:   rule.Requests,
+			Period:  rule.Period,
+		})
+	}
+	return auth.NewRateLimiterMiddleware(store, opts)
 }
 
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		duration := time.Since(start)
-		log.Printf("[%s] %s %s %v", r.Method, r.RequestURI, r.RemoteAddr, duration)
-	})
+// fatal logs err as a structured record and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
@@ -1,49 +1,145 @@
 package models
 
 import (
+	"log/slog"
 	"time"
 )
 
+// The validate tags are checked by internal/validate on create and update;
+// length limits match the varchar sizes of the schema.
+//
+// Version is the row version, bumped by every update. Stores only write a
+// record whose version still matches a non-zero Version; clients see it
+// through the ETag header instead of the JSON body.
+
 type Book struct {
 	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Author      Author    `json:"author"`
-	Genres      []string  `json:"genres"`
-	PublishedAt time.Time `json:"published_at"`
-	Price       float64   `json:"price"`
-	Stock       int       `json:"stock"`
+	Title       string    `json:"title" validate:"required,max=255"`
+	Author      Author    `json:"author" validate:"ref"`
+	Genres      []string  `json:"genres" validate:"dive,required,max=255"`
+	PublishedAt time.Time `json:"published_at" validate:"required"`
+	Price       float64   `json:"price" validate:"min=0"`
+	Stock       int       `json:"stock" validate:"min=0"`
+	Version     int       `json:"-"`
 }
 
 type Author struct {
 	ID        int    `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	FirstName string `json:"first_name" validate:"required,max=100"`
+	LastName  string `json:"last_name" validate:"required,max=100"`
 	Bio       string `json:"bio"`
+	Version   int    `json:"-"`
 }
 
 type Customer struct {
 	ID         int    `json:"id"`
-	Name       string `json:"name"`
-	Email      string `json:"email"`
-	Street     string `json:"street"`
-	City       string `json:"city"`
-	State      string `json:"state"`
-	PostalCode string `json:"postal_code"`
-	Country    string `json:"country"`
+	Name       string `json:"name" validate:"required,max=255"`
+	Email      string `json:"email" validate:"required,max=255,email"`
+	Street     string `json:"street" validate:"max=255"`
+	City       string `json:"city" validate:"max=100"`
+	State      string `json:"state" validate:"max=100"`
+	PostalCode string `json:"postal_code" validate:"max=20,postal_code=Country"`
+	Country    string `json:"country" validate:"max=100,country"`
+	Version    int    `json:"-"`
+}
+
+// LogValue keeps a customer's name, email and address out of the logs.
+func (c Customer) LogValue() slog.Value {
+	return slog.GroupValue(slog.Int("id", c.ID), slog.String("country", c.Country))
+}
+
+// BookPatch, AuthorPatch and CustomerPatch describe partial updates: only
+// the non-nil fields are written. A non-nil Genres replaces all genres.
+// Version, if non-zero, is the version the patch was based on.
+type BookPatch struct {
+	Title       *string
+	AuthorID    *int
+	Genres      *[]string
+	PublishedAt *time.Time
+	Price       *float64
+	Stock       *int
+	Version     int
+}
+
+type AuthorPatch struct {
+	FirstName *string
+	LastName  *string
+	Bio       *string
+	Version   int
+}
+
+type CustomerPatch struct {
+	Name       *string
+	Email      *string
+	Street     *string
+	City       *string
+	State      *string
+	PostalCode *string
+	Country    *string
+	Version    int
 }
 
 type Order struct {
 	ID         int         `json:"id"`
-	Customer   Customer    `json:"customer"`
+	Customer   Customer    `json:"customer" validate:"ref"`
+	Subtotal   float64     `json:"subtotal"`
+	Discount   float64     `json:"discount"`
+	Tax        float64     `json:"tax"`
 	TotalPrice float64     `json:"total_price"`
 	Status     string      `json:"status"`
 	CreatedAt  time.Time   `json:"created_at"`
-	Items      []OrderItem `json:"items"`
+	Items      []OrderItem `json:"items" validate:"required,dive"`
+	Version    int         `json:"-"`
+}
+
+// Order statuses. Transitions between them are enforced by the store.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusPacked    = "packed"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
+type OrderStatusChange struct {
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  string    `json:"changed_by,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
 }
 
+// OrderItem carries the title and unit price as they were when the order was
+// placed; Book.Title and Book.Price are filled from that snapshot.
 type OrderItem struct {
-	Book     Book `json:"book"`
-	Quantity int  `json:"quantity"`
+	Book      Book    `json:"book" validate:"ref"`
+	Quantity  int     `json:"quantity" validate:"gt=0"`
+	UnitPrice float64 `json:"unit_price"`
+	LineTotal float64 `json:"line_total"`
+}
+
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	Roles        []string  `json:"roles"`
+	CustomerID   int       `json:"customer_id,omitempty"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	TokenHash string     `json:"-"`
+	FamilyID  string     `json:"family_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
 }
 
 type SalesReport struct {
@@ -58,6 +154,25 @@ type BookSales struct {
 	Quantity int  `json:"quantity_sold"`
 }
 
+// SortField orders a list by Column, descending when Desc is set.
+type SortField struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+// ListParams selects one page of a list: at most Limit items after Cursor.
+type ListParams struct {
+	Limit  int         `json:"limit"`
+	Cursor string      `json:"cursor"`
+	Sort   []SortField `json:"sort"`
+}
+
+// Page is one page of a list; NextCursor is empty on the last page.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
 // type SearchCriteriaBooks struct {
 // 	Title           string `json:"title"`
 // 	AuthorName      string `json:"author_last_name"`
@@ -83,6 +198,7 @@ type SearchCriteriaCustomers struct {
 }
 
 type SearchCriteriaOrders struct {
+	CustomerID   int    `json:"customer_id"`
 	CustomerName string `json:"customer_name"`
 	Status       string `json:"status"`
 }
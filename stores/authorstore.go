@@ -3,9 +3,9 @@ package stores
 import (
 	"context"
 	"database/sql"
-	"log"
 	"strconv"
 
+	"project.com/myproject/internal/logging"
 	m "project.com/myproject/models"
 )
 
@@ -25,7 +25,7 @@ func (s *PostgresStore) CreateAuthor(ctx context.Context, author m.Author) (m.Au
 	var id int
 	err := s.DB.QueryRowContext(ctx, query, author.FirstName, author.LastName, author.Bio).Scan(&id)
 	if err != nil {
-		log.Println("Error inserting author:", err)
+		logging.FromContext(ctx).Error("error inserting author", "err", err)
 		return m.Author{}, err
 	}
 	author.ID = id
@@ -33,11 +33,11 @@ func (s *PostgresStore) CreateAuthor(ctx context.Context, author m.Author) (m.Au
 }
 
 func (s *PostgresStore) GetAuthor(ctx context.Context, id int) (m.Author, error) {
-	query := "SELECT id, first_name, last_name, bio FROM authors WHERE id = $1"
+	query := "SELECT id, first_name, last_name, bio, version FROM authors WHERE id = $1"
 	var author m.Author
-	err := s.DB.QueryRow(query, id).Scan(&author.ID, &author.FirstName, &author.LastName, &author.Bio)
+	err := s.DB.QueryRow(query, id).Scan(&author.ID, &author.FirstName, &author.LastName, &author.Bio, &author.Version)
 	if err != nil {
-		log.Println("Error retrieving author:", err)
+		logging.FromContext(ctx).Error("error retrieving author", "err", err)
 		return m.Author{}, err
 	}
 	return author, nil
@@ -46,26 +46,55 @@ func (s *PostgresStore) GetAuthor(ctx context.Context, id int) (m.Author, error)
 func (s *PostgresStore) UpdateAuthor(ctx context.Context, id int, author m.Author) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	query := "UPDATE authors SET first_name = $1, last_name = $2, bio = $3 WHERE id = $4"
-	_, err := s.DB.Exec(query, author.FirstName, author.LastName, author.Bio, id)
-	return err
+	query := "UPDATE authors SET first_name = $1, last_name = $2, bio = $3 WHERE id = $4 AND " + versionMatches(5)
+	res, err := s.DB.ExecContext(ctx, query, author.FirstName, author.LastName, author.Bio, id, author.Version)
+	if err != nil {
+		return err
+	}
+	return expectVersion(ctx, s.DB, res, "authors", id)
 }
 
-func (s *PostgresStore) DeleteAuthor(ctx context.Context, id int) error {
+// PatchAuthor writes only the fields set in patch.
+func (s *PostgresStore) PatchAuthor(ctx context.Context, id int, patch m.AuthorPatch) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	query := "DELETE FROM authors WHERE id = $1"
-	_, err := s.DB.Exec(query, id)
-	return err
+	var update assignments
+	if patch.FirstName != nil {
+		update.set("first_name", *patch.FirstName)
+	}
+	if patch.LastName != nil {
+		update.set("last_name", *patch.LastName)
+	}
+	if patch.Bio != nil {
+		update.set("bio", *patch.Bio)
+	}
+	return update.exec(ctx, s.DB, "authors", id, patch.Version)
 }
 
-func (s *PostgresStore) GetAllAuthors(ctx context.Context) ([]m.Author, error) {
+func (s *PostgresStore) DeleteAuthor(ctx context.Context, id int, version int) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	query := "DELETE FROM authors WHERE id = $1 AND " + versionMatches(2)
+	res, err := s.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+	return expectVersion(ctx, s.DB, res, "authors", id)
+}
 
-	query := "SELECT id, first_name, last_name, bio FROM authors"
-	rows, err := s.DB.Query(query)
+// GetAllAuthors returns one page of authors.
+func (s *PostgresStore) GetAllAuthors(ctx context.Context, params m.ListParams) (m.Page[m.Author], error) {
+	page, err := authorKeyset.resolve(params)
 	if err != nil {
-		log.Println("Error retrieving authors:", err)
-		return nil, err
+		return m.Page[m.Author]{}, err
+	}
+
+	query := "SELECT id, first_name, last_name, bio FROM authors WHERE 1=1"
+	after, args := page.where(1)
+	rows, err := s.DB.QueryContext(ctx, query+after+page.orderBy(), args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("error retrieving authors", "err", err)
+		return m.Page[m.Author]{}, err
 	}
 	defer rows.Close()
 
@@ -74,21 +103,28 @@ func (s *PostgresStore) GetAllAuthors(ctx context.Context) ([]m.Author, error) {
 		var author m.Author
 		err := rows.Scan(&author.ID, &author.FirstName, &author.LastName, &author.Bio)
 		if err != nil {
-			log.Println("Error scanning author:", err)
-			return nil, err
+			logging.FromContext(ctx).Error("error scanning author", "err", err)
+			return m.Page[m.Author]{}, err
 		}
 		authors = append(authors, author)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Println("Error in rows iteration:", err)
-		return nil, err
+		logging.FromContext(ctx).Error("error in rows iteration", "err", err)
+		return m.Page[m.Author]{}, err
 	}
 
-	return authors, nil
+	return page.page(authors)
 }
 
-func (s *PostgresStore) SearchAuthors(ctx context.Context, criteria m.SearchCriteriaAuthors) ([]m.Author, error) {
+// SearchAuthors returns one page of authors matching criteria. It returns
+// sql.ErrNoRows when nothing matches at all.
+func (s *PostgresStore) SearchAuthors(ctx context.Context, criteria m.SearchCriteriaAuthors, params m.ListParams) (m.Page[m.Author], error) {
+	page, err := authorKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Author]{}, err
+	}
+
 	// Base query
 	query := `SELECT id, first_name, last_name, bio FROM authors WHERE 1=1`
 	args := []interface{}{}
@@ -107,11 +143,15 @@ func (s *PostgresStore) SearchAuthors(ctx context.Context, criteria m.SearchCrit
 		argCount++
 	}
 
+	after, afterArgs := page.where(argCount)
+	query += after + page.orderBy()
+	args = append(args, afterArgs...)
+
 	// Execute query
-	rows, err := s.DB.Query(query, args...)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Println("❌ Error searching authors:", err)
-		return nil, err
+		logging.FromContext(ctx).Error("error searching authors", "err", err)
+		return m.Page[m.Author]{}, err
 	}
 	defer rows.Close()
 
@@ -121,18 +161,21 @@ func (s *PostgresStore) SearchAuthors(ctx context.Context, criteria m.SearchCrit
 		var author m.Author
 		err := rows.Scan(&author.ID, &author.FirstName, &author.LastName, &author.Bio)
 		if err != nil {
-			log.Println("❌ Error scanning author:", err)
-			return nil, err
+			logging.FromContext(ctx).Error("error scanning author", "err", err)
+			return m.Page[m.Author]{}, err
 		}
 		authors = append(authors, author)
 	}
+	if err := rows.Err(); err != nil {
+		return m.Page[m.Author]{}, err
+	}
 
 	// Check if no authors were found
-	if len(authors) == 0 {
-		log.Println("🔍 No matching authors found")
-		return nil, sql.ErrNoRows
+	if len(authors) == 0 && params.Cursor == "" {
+		logging.FromContext(ctx).Debug("no matching authors found")
+		return m.Page[m.Author]{}, sql.ErrNoRows
 	}
 
-	log.Println("✅ Authors search successful")
-	return authors, nil
+	logging.FromContext(ctx).Debug("authors search successful")
+	return page.page(authors)
 }
@@ -57,11 +57,11 @@ func TestGetAllAuthors(t *testing.T) {
 		t.Fatal("❌ store is nil; TestMain did not initialize it")
 	}
 
-	authors, err := store.GetAllAuthors(context.Background())
+	authors, err := store.GetAllAuthors(context.Background(), m.ListParams{})
 	if err != nil {
 		t.Fatalf("Failed to get all authors: %v", err)
 	}
-	if len(authors) == 0 {
+	if len(authors.Data) == 0 {
 		t.Log("No authors found, consider adding some for the test")
 	}
 }
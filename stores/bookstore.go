@@ -3,10 +3,10 @@ package stores
 import (
 	"context"
 	"database/sql"
-	"log"
 	"strconv"
 
 	"github.com/lib/pq"
+	"project.com/myproject/internal/logging"
 	m "project.com/myproject/models"
 )
 
@@ -30,7 +30,7 @@ func (s *PostgresStore) CreateBook(ctx context.Context, book m.Book) (m.Book, er
 	// ✅ Use QueryRowContext to allow timeout/cancellation
 	err := s.DB.QueryRowContext(ctx, query, book.Title, book.Author.ID, book.PublishedAt, book.Price, book.Stock).Scan(&bookID)
 	if err != nil {
-		log.Println("❌ Error inserting book:", err)
+		logging.FromContext(ctx).Error("error inserting book", "err", err)
 		return m.Book{}, err
 	}
 
@@ -43,17 +43,17 @@ func (s *PostgresStore) CreateBook(ctx context.Context, book m.Book) (m.Book, er
 		if err == sql.ErrNoRows {
 			err = s.DB.QueryRowContext(ctx, `INSERT INTO genres (name) VALUES ($1) RETURNING id`, genre).Scan(&genreID)
 			if err != nil {
-				log.Println("❌ Error inserting genre:", err)
+				logging.FromContext(ctx).Error("error inserting genre", "err", err)
 				return m.Book{}, err
 			}
 		} else if err != nil {
-			log.Println("❌ Error checking genre:", err)
+			logging.FromContext(ctx).Error("error checking genre", "err", err)
 			return m.Book{}, err
 		}
 
 		_, err = s.DB.ExecContext(ctx, `INSERT INTO book_genres (book_id, genre_id) VALUES ($1, $2)`, bookID, genreID)
 		if err != nil {
-			log.Println("❌ Error linking book to genre:", err)
+			logging.FromContext(ctx).Error("error linking book to genre", "err", err)
 			return m.Book{}, err
 		}
 	}
@@ -63,8 +63,9 @@ func (s *PostgresStore) CreateBook(ctx context.Context, book m.Book) (m.Book, er
 
 // ✅ Fetch a Single Book with Linked Genres
 func (s *PostgresStore) GetBook(ctx context.Context, id int) (m.Book, error) {
-	query := `SELECT b.id, b.title, b.author_id, b.published_at, b.price, b.stock, 
-	                 COALESCE(array_agg(g.name) FILTER (WHERE g.name IS NOT NULL), '{}') AS genres
+	// Genres are ordered so that the book's ETag is stable
+	query := `SELECT b.id, b.title, b.author_id, b.published_at, b.price, b.stock, b.version,
+	                 COALESCE(array_agg(g.name ORDER BY g.id) FILTER (WHERE g.name IS NOT NULL), '{}') AS genres
 	          FROM books b
 	          LEFT JOIN book_genres bg ON b.id = bg.book_id
 	          LEFT JOIN genres g ON bg.genre_id = g.id
@@ -75,9 +76,9 @@ func (s *PostgresStore) GetBook(ctx context.Context, id int) (m.Book, error) {
 	var authorID int
 	var genres pq.StringArray
 
-	err := s.DB.QueryRow(query, id).Scan(&book.ID, &book.Title, &authorID, &book.PublishedAt, &book.Price, &book.Stock, &genres)
+	err := s.DB.QueryRow(query, id).Scan(&book.ID, &book.Title, &authorID, &book.PublishedAt, &book.Price, &book.Stock, &book.Version, &genres)
 	if err != nil {
-		log.Println("❌ Error retrieving book:", err)
+		logging.FromContext(ctx).Error("error retrieving book", "err", err)
 		return m.Book{}, err
 	}
 
@@ -87,38 +88,54 @@ func (s *PostgresStore) GetBook(ctx context.Context, id int) (m.Book, error) {
 	return book, nil
 }
 
-// ✅ Fetch All Books with Their Genres
-func (s *PostgresStore) GetAllBooks(ctx context.Context) ([]m.Book, error) {
+// ✅ Fetch One Page of Books with Their Genres
+func (s *PostgresStore) GetAllBooks(ctx context.Context, params m.ListParams) (m.Page[m.Book], error) {
+	page, err := bookKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Book]{}, err
+	}
+
 	query := `SELECT b.id, b.title, b.author_id, b.published_at, b.price, b.stock, 
 	                 COALESCE(array_agg(g.name) FILTER (WHERE g.name IS NOT NULL), '{}') AS genres
 	          FROM books b
 	          LEFT JOIN book_genres bg ON b.id = bg.book_id
 	          LEFT JOIN genres g ON bg.genre_id = g.id
-	          GROUP BY b.id`
+	          WHERE 1=1`
+	after, args := page.where(1)
+	query += after + " GROUP BY b.id" + page.orderBy()
 
-	rows, err := s.DB.QueryContext(ctx, query)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Println("❌ Error retrieving books:", err)
-		return nil, err
+		logging.FromContext(ctx).Error("error retrieving books", "err", err)
+		return m.Page[m.Book]{}, err
 	}
 	defer rows.Close()
 
 	var books []m.Book
+	var authorIDs []int
 	for rows.Next() {
 		var book m.Book
 		var authorID int
 		var genres pq.StringArray
 		err := rows.Scan(&book.ID, &book.Title, &authorID, &book.PublishedAt, &book.Price, &book.Stock, &genres)
 		if err != nil {
-			log.Println("❌ Error scanning book:", err)
-			return nil, err
+			logging.FromContext(ctx).Error("error scanning book", "err", err)
+			return m.Page[m.Book]{}, err
 		}
 		book.Genres = genres
-		book.Author, _ = s.GetAuthor(ctx, authorID)
 		books = append(books, book)
+		authorIDs = append(authorIDs, authorID)
+	}
+	if err := rows.Err(); err != nil {
+		return m.Page[m.Book]{}, err
+	}
+	rows.Close()
+
+	for i := range books {
+		books[i].Author, _ = s.GetAuthor(ctx, authorIDs[i])
 	}
 
-	return books, nil
+	return page.page(books)
 }
 
 // ✅ Update a Book (Handles Both Book Info & Genres)
@@ -126,21 +143,17 @@ func (s *PostgresStore) UpdateBook(ctx context.Context, id int, book m.Book) err
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 
-	var exists bool
-	err := s.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM books WHERE id = $1)", id).Scan(&exists)
+	query := `UPDATE books SET title = $1, author_id = $2, published_at = $3, price = $4, stock = $5
+	          WHERE id = $6 AND ` + versionMatches(7)
+	res, err := s.DB.ExecContext(ctx, query, book.Title, book.Author.ID, book.PublishedAt, book.Price, book.Stock, id, book.Version)
 	if err != nil {
-		log.Println("❌ Error checking book existence:", err)
+		logging.FromContext(ctx).Error("error updating book", "err", err)
 		return err
 	}
-	if !exists {
-		log.Println("❌ Book not found for update")
-		return sql.ErrNoRows
-	}
-
-	query := `UPDATE books SET title = $1, author_id = $2, published_at = $3, price = $4, stock = $5 WHERE id = $6`
-	_, err = s.DB.ExecContext(ctx, query, book.Title, book.Author.ID, book.PublishedAt, book.Price, book.Stock, id)
-	if err != nil {
-		log.Println("❌ Error updating book:", err)
+	if err := expectVersion(ctx, s.DB, res, "books", id); err != nil {
+		if err == sql.ErrNoRows {
+			logging.FromContext(ctx).Warn("book not found for update", "book_id", id)
+		}
 		return err
 	}
 
@@ -148,7 +161,7 @@ func (s *PostgresStore) UpdateBook(ctx context.Context, id int, book m.Book) err
 	if len(book.Genres) > 0 {
 		_, err = s.DB.ExecContext(ctx, "DELETE FROM book_genres WHERE book_id = $1", id)
 		if err != nil {
-			log.Println("❌ Error clearing book genres:", err)
+			logging.FromContext(ctx).Error("error clearing book genres", "err", err)
 			return err
 		}
 
@@ -158,48 +171,114 @@ func (s *PostgresStore) UpdateBook(ctx context.Context, id int, book m.Book) err
 			if err == sql.ErrNoRows {
 				err = s.DB.QueryRowContext(ctx, `INSERT INTO genres (name) VALUES ($1) RETURNING id`, genre).Scan(&genreID)
 				if err != nil {
-					log.Println("❌ Error inserting genre:", err)
+					logging.FromContext(ctx).Error("error inserting genre", "err", err)
 					return err
 				}
 			} else if err != nil {
-				log.Println("❌ Error checking genre:", err)
+				logging.FromContext(ctx).Error("error checking genre", "err", err)
 				return err
 			}
 
 			_, err = s.DB.ExecContext(ctx, `INSERT INTO book_genres (book_id, genre_id) VALUES ($1, $2)`, id, genreID)
 			if err != nil {
-				log.Println("❌ Error linking book to genre:", err)
+				logging.FromContext(ctx).Error("error linking book to genre", "err", err)
 				return err
 			}
 		}
 	}
 
-	log.Println("✅ Book updated successfully")
+	logging.FromContext(ctx).Info("book updated", "book_id", id)
+	return nil
+}
+
+// PatchBook writes only the fields set in patch. Genres are relinked only
+// when the patch carries them.
+func (s *PostgresStore) PatchBook(ctx context.Context, id int, patch m.BookPatch) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var update assignments
+	if patch.Title != nil {
+		update.set("title", *patch.Title)
+	}
+	if patch.AuthorID != nil {
+		update.set("author_id", *patch.AuthorID)
+	}
+	if patch.PublishedAt != nil {
+		update.set("published_at", *patch.PublishedAt)
+	}
+	if patch.Price != nil {
+		update.set("price", *patch.Price)
+	}
+	if patch.Stock != nil {
+		update.set("stock", *patch.Stock)
+	}
+	if err := update.exec(ctx, tx, "books", id, patch.Version); err != nil {
+		if err != sql.ErrNoRows && err != ErrVersionMismatch {
+			logging.FromContext(ctx).Error("error patching book", "err", err)
+		}
+		return err
+	}
+
+	if patch.Genres != nil {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM book_genres WHERE book_id = $1", id); err != nil {
+			logging.FromContext(ctx).Error("error clearing book genres", "err", err)
+			return err
+		}
+		for _, genre := range uniqueGenres(*patch.Genres) {
+			var genreID int
+			err := tx.QueryRowContext(ctx, `SELECT id FROM genres WHERE name = $1`, genre).Scan(&genreID)
+			if err == sql.ErrNoRows {
+				err = tx.QueryRowContext(ctx, `INSERT INTO genres (name) VALUES ($1) RETURNING id`, genre).Scan(&genreID)
+			}
+			if err != nil {
+				logging.FromContext(ctx).Error("error resolving genre", "err", err)
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO book_genres (book_id, genre_id) VALUES ($1, $2)`, id, genreID); err != nil {
+				logging.FromContext(ctx).Error("error linking book to genre", "err", err)
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(ctx).Error("error committing book patch", "err", err)
+		return err
+	}
+	logging.FromContext(ctx).Info("book patched", "book_id", id)
 	return nil
 }
 
 // ✅ Delete a Book (Decrease Stock or Delete Completely)
-func (s *PostgresStore) DeleteBook(ctx context.Context, id int) error {
+func (s *PostgresStore) DeleteBook(ctx context.Context, id int, version int) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 
 	var stock int
 	err := s.DB.QueryRowContext(ctx, "SELECT stock FROM books WHERE id = $1", id).Scan(&stock)
 	if err != nil {
-		log.Println("❌ Error retrieving book stock:", err)
+		logging.FromContext(ctx).Error("error retrieving book stock", "err", err)
 		return err
 	}
 
+	// The book's genre links go with it (ON DELETE CASCADE)
+	var res sql.Result
 	if stock > 1 {
-		_, err = s.DB.ExecContext(ctx, "UPDATE books SET stock = stock - 1 WHERE id = $1", id)
+		res, err = s.DB.ExecContext(ctx, "UPDATE books SET stock = stock - 1 WHERE id = $1 AND "+versionMatches(2), id, version)
 	} else {
-		_, err = s.DB.ExecContext(ctx, "DELETE FROM book_genres WHERE book_id = $1", id)
-		if err == nil {
-			_, err = s.DB.ExecContext(ctx, "DELETE FROM books WHERE id = $1", id)
-		}
+		res, err = s.DB.ExecContext(ctx, "DELETE FROM books WHERE id = $1 AND "+versionMatches(2), id, version)
 	}
-
-	return err
+	if err != nil {
+		return err
+	}
+	return expectVersion(ctx, s.DB, res, "books", id)
 }
 
 // func (s *PostgresStore) SearchBooks(ctx context.Context, criteria m.SearchCriteriaBooks) ([]m.Book, error) {
@@ -339,7 +418,14 @@ func (s *PostgresStore) DeleteBook(ctx context.Context, id int) error {
 // 	return books, nil
 // }
 
-func (s *PostgresStore) SearchBooks(ctx context.Context, criteria m.SearchCriteriaBooks) ([]m.Book, error) {
+// SearchBooks returns one page of books matching criteria. It returns
+// sql.ErrNoRows when nothing matches at all.
+func (s *PostgresStore) SearchBooks(ctx context.Context, criteria m.SearchCriteriaBooks, params m.ListParams) (m.Page[m.Book], error) {
+	page, err := bookKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Book]{}, err
+	}
+
 	query := `SELECT b.id, b.title, b.published_at, b.price, b.stock, 
 	                 a.id, a.first_name, a.last_name,
 	                 COALESCE(array_agg(g.name) FILTER (WHERE g.name IS NOT NULL), '{}') AS genres
@@ -383,15 +469,16 @@ func (s *PostgresStore) SearchBooks(ctx context.Context, criteria m.SearchCriter
 		argCount++
 	}
 
-	query += " GROUP BY b.id, a.id"
+	after, afterArgs := page.where(argCount)
+	query += after + " GROUP BY b.id, a.id" + page.orderBy()
+	args = append(args, afterArgs...)
 
-	log.Println("Executing SearchBooks Query:", query)
-	log.Println("With Parameters:", args)
+	logging.FromContext(ctx).Debug("searching books", "query", query)
 
 	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Println("❌ Error searching books:", err)
-		return nil, err
+		logging.FromContext(ctx).Error("error searching books", "err", err)
+		return m.Page[m.Book]{}, err
 	}
 	defer rows.Close()
 
@@ -403,19 +490,23 @@ func (s *PostgresStore) SearchBooks(ctx context.Context, criteria m.SearchCriter
 		err := rows.Scan(&book.ID, &book.Title, &book.PublishedAt, &book.Price, &book.Stock,
 			&author.ID, &author.FirstName, &author.LastName, &genres)
 		if err != nil {
-			log.Println("❌ Error scanning book:", err)
-			return nil, err
+			logging.FromContext(ctx).Error("error scanning book", "err", err)
+			return m.Page[m.Book]{}, err
 		}
 		book.Genres = genres
 		book.Author = author
 		books = append(books, book)
 	}
 
-	if len(books) == 0 {
-		log.Println("🔍 No matching books found")
-		return nil, sql.ErrNoRows
+	if err := rows.Err(); err != nil {
+		return m.Page[m.Book]{}, err
+	}
+
+	if len(books) == 0 && params.Cursor == "" {
+		logging.FromContext(ctx).Debug("no matching books found")
+		return m.Page[m.Book]{}, sql.ErrNoRows
 	}
 
-	log.Println("✅ Books search successful")
-	return books, nil
+	logging.FromContext(ctx).Debug("books search successful")
+	return page.page(books)
 }
@@ -3,12 +3,18 @@ package stores
 import (
 	"context"
 	"database/sql"
-	"log"
+	"errors"
 	"strconv"
 
+	"github.com/lib/pq"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
 	m "project.com/myproject/models"
 )
 
+// ErrCustomerEmailExists is returned when another customer has the email.
+var ErrCustomerEmailExists = apperr.Conflict("customer_email_exists", "A customer with this email already exists")
+
 type PostgresCustomerStore struct {
 	DB *sql.DB
 }
@@ -26,7 +32,10 @@ func (s *PostgresStore) CreateCustomer(ctx context.Context, customer m.Customer)
 	var id int
 	err := s.DB.QueryRow(query, customer.Name, customer.Email, customer.Street, customer.City, customer.State, customer.PostalCode, customer.Country).Scan(&id)
 	if err != nil {
-		log.Println("❌ Error inserting customer:", err)
+		if isUniqueViolation(err) {
+			return m.Customer{}, ErrCustomerEmailExists
+		}
+		logging.FromContext(ctx).Error("error inserting customer", "err", err)
 		return m.Customer{}, err
 	}
 	customer.ID = id
@@ -35,11 +44,11 @@ func (s *PostgresStore) CreateCustomer(ctx context.Context, customer m.Customer)
 
 // ✅ Fetch a Single Customer with Correct Fields
 func (s *PostgresStore) GetCustomer(ctx context.Context, id int) (m.Customer, error) {
-	query := `SELECT id, name, email, street, city, state, postal_code, country FROM customers WHERE id = $1`
+	query := `SELECT id, name, email, street, city, state, postal_code, country, version FROM customers WHERE id = $1`
 	var customer m.Customer
-	err := s.DB.QueryRow(query, id).Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Street, &customer.City, &customer.State, &customer.PostalCode, &customer.Country)
+	err := s.DB.QueryRow(query, id).Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Street, &customer.City, &customer.State, &customer.PostalCode, &customer.Country, &customer.Version)
 	if err != nil {
-		log.Println("❌ Error retrieving customer:", err)
+		logging.FromContext(ctx).Error("error retrieving customer", "err", err)
 		return m.Customer{}, err
 	}
 	return customer, nil
@@ -49,27 +58,76 @@ func (s *PostgresStore) GetCustomer(ctx context.Context, id int) (m.Customer, er
 func (s *PostgresStore) UpdateCustomer(ctx context.Context, id int, customer m.Customer) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	query := `UPDATE customers SET name = $1, email = $2, street = $3, city = $4, state = $5, postal_code = $6, country = $7 WHERE id = $8`
-	_, err := s.DB.Exec(query, customer.Name, customer.Email, customer.Street, customer.City, customer.State, customer.PostalCode, customer.Country, id)
+	query := `UPDATE customers SET name = $1, email = $2, street = $3, city = $4, state = $5, postal_code = $6, country = $7
+	          WHERE id = $8 AND ` + versionMatches(9)
+	res, err := s.DB.ExecContext(ctx, query, customer.Name, customer.Email, customer.Street, customer.City, customer.State, customer.PostalCode, customer.Country, id, customer.Version)
+	if isUniqueViolation(err) {
+		return ErrCustomerEmailExists
+	} else if err != nil {
+		return err
+	}
+	return expectVersion(ctx, s.DB, res, "customers", id)
+}
+
+// ✅ Patch a Customer (Only the Fields Provided)
+func (s *PostgresStore) PatchCustomer(ctx context.Context, id int, patch m.CustomerPatch) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	var update assignments
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"name", patch.Name},
+		{"email", patch.Email},
+		{"street", patch.Street},
+		{"city", patch.City},
+		{"state", patch.State},
+		{"postal_code", patch.PostalCode},
+		{"country", patch.Country},
+	} {
+		if field.value != nil {
+			update.set(field.column, *field.value)
+		}
+	}
+	err := update.exec(ctx, s.DB, "customers", id, patch.Version)
+	if isUniqueViolation(err) {
+		return ErrCustomerEmailExists
+	}
 	return err
 }
 
+// isUniqueViolation reports whether err is a Postgres unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 // ✅ Delete a Customer
-func (s *PostgresStore) DeleteCustomer(ctx context.Context, id int) error {
+func (s *PostgresStore) DeleteCustomer(ctx context.Context, id int, version int) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	query := "DELETE FROM customers WHERE id = $1"
-	_, err := s.DB.Exec(query, id)
-	return err
+	query := "DELETE FROM customers WHERE id = $1 AND " + versionMatches(2)
+	res, err := s.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+	return expectVersion(ctx, s.DB, res, "customers", id)
 }
 
-// ✅ Fetch All Customers (Fixed Address Fields)
-func (s *PostgresStore) GetAllCustomers(ctx context.Context) ([]m.Customer, error) {
-	query := `SELECT id, name, email, street, city, state, postal_code, country FROM customers`
-	rows, err := s.DB.Query(query)
+// ✅ Fetch One Page of Customers
+func (s *PostgresStore) GetAllCustomers(ctx context.Context, params m.ListParams) (m.Page[m.Customer], error) {
+	page, err := customerKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Customer]{}, err
+	}
+
+	query := `SELECT id, name, email, street, city, state, postal_code, country FROM customers WHERE 1=1`
+	after, args := page.where(1)
+	rows, err := s.DB.QueryContext(ctx, query+after+page.orderBy(), args...)
 	if err != nil {
-		log.Println("❌ Error retrieving customers:", err)
-		return nil, err
+		logging.FromContext(ctx).Error("error retrieving customers", "err", err)
+		return m.Page[m.Customer]{}, err
 	}
 	defer rows.Close()
 
@@ -78,21 +136,28 @@ func (s *PostgresStore) GetAllCustomers(ctx context.Context) ([]m.Customer, erro
 		var customer m.Customer
 		err := rows.Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Street, &customer.City, &customer.State, &customer.PostalCode, &customer.Country)
 		if err != nil {
-			log.Println("❌ Error scanning customer:", err)
-			return nil, err
+			logging.FromContext(ctx).Error("error scanning customer", "err", err)
+			return m.Page[m.Customer]{}, err
 		}
 		customers = append(customers, customer)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Println("❌ Error in rows iteration:", err)
-		return nil, err
+		logging.FromContext(ctx).Error("error in rows iteration", "err", err)
+		return m.Page[m.Customer]{}, err
 	}
 
-	return customers, nil
+	return page.page(customers)
 }
 
-func (s *PostgresStore) SearchCustomers(ctx context.Context, criteria m.SearchCriteriaCustomers) ([]m.Customer, error) {
+// SearchCustomers returns one page of customers matching criteria. It returns
+// sql.ErrNoRows when nothing matches at all.
+func (s *PostgresStore) SearchCustomers(ctx context.Context, criteria m.SearchCriteriaCustomers, params m.ListParams) (m.Page[m.Customer], error) {
+	page, err := customerKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Customer]{}, err
+	}
+
 	// Base query
 	query := `SELECT id, name, email, street, city, state, postal_code, country FROM customers WHERE 1=1`
 	args := []interface{}{}
@@ -111,11 +176,15 @@ func (s *PostgresStore) SearchCustomers(ctx context.Context, criteria m.SearchCr
 		argCount++
 	}
 
+	after, afterArgs := page.where(argCount)
+	query += after + page.orderBy()
+	args = append(args, afterArgs...)
+
 	// Execute query
-	rows, err := s.DB.Query(query, args...)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Println("❌ Error searching customers:", err)
-		return nil, err
+		logging.FromContext(ctx).Error("error searching customers", "err", err)
+		return m.Page[m.Customer]{}, err
 	}
 	defer rows.Close()
 
@@ -125,18 +194,21 @@ func (s *PostgresStore) SearchCustomers(ctx context.Context, criteria m.SearchCr
 		var customer m.Customer
 		err := rows.Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Street, &customer.City, &customer.State, &customer.PostalCode, &customer.Country)
 		if err != nil {
-			log.Println("❌ Error scanning customer:", err)
-			return nil, err
+			logging.FromContext(ctx).Error("error scanning customer", "err", err)
+			return m.Page[m.Customer]{}, err
 		}
 		customers = append(customers, customer)
 	}
+	if err := rows.Err(); err != nil {
+		return m.Page[m.Customer]{}, err
+	}
 
 	// Check if no customers were found
-	if len(customers) == 0 {
-		log.Println("🔍 No matching customers found")
-		return nil, sql.ErrNoRows
+	if len(customers) == 0 && params.Cursor == "" {
+		logging.FromContext(ctx).Debug("no matching customers found")
+		return m.Page[m.Customer]{}, sql.ErrNoRows
 	}
 
-	log.Println("✅ Customers search successful")
-	return customers, nil
+	logging.FromContext(ctx).Debug("customers search successful")
+	return page.page(customers)
 }
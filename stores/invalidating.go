@@ -0,0 +1,156 @@
+package stores
+
+import (
+	"context"
+
+	"project.com/myproject/internal/cache"
+	"project.com/myproject/internal/logging"
+	m "project.com/myproject/models"
+)
+
+// TagInvalidator drops cached entries by tag; cache.Cache and cache.Loader
+// implement it.
+type TagInvalidator interface {
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
+
+// InvalidatingStore wraps a Store and, after every successful mutation,
+// invalidates the cache tags of the books, authors and genres it changed, so
+// handlers never have to know which cached responses embed what.
+type InvalidatingStore struct {
+	Store
+	cache TagInvalidator
+}
+
+func NewInvalidatingStore(store Store, c TagInvalidator) *InvalidatingStore {
+	return &InvalidatingStore{Store: store, cache: c}
+}
+
+func (s *InvalidatingStore) CreateBook(ctx context.Context, book m.Book) (m.Book, error) {
+	created, err := s.Store.CreateBook(ctx, book)
+	if err == nil {
+		// The book tag drops a cached "not found" for the new ID
+		s.invalidate(ctx, append(genreTags(created.Genres), cache.BookTag(created.ID), cache.BooksTag)...)
+	}
+	return created, err
+}
+
+func (s *InvalidatingStore) UpdateBook(ctx context.Context, id int, book m.Book) error {
+	err := s.Store.UpdateBook(ctx, id, book)
+	if err == nil {
+		// Entries holding the old genres carry the book tag as well
+		s.invalidate(ctx, append(genreTags(book.Genres), cache.BookTag(id), cache.BooksTag)...)
+	}
+	return err
+}
+
+func (s *InvalidatingStore) PatchBook(ctx context.Context, id int, patch m.BookPatch) error {
+	err := s.Store.PatchBook(ctx, id, patch)
+	if err == nil {
+		tags := []string{cache.BookTag(id), cache.BooksTag}
+		if patch.Genres != nil {
+			tags = append(tags, genreTags(*patch.Genres)...)
+		}
+		s.invalidate(ctx, tags...)
+	}
+	return err
+}
+
+func (s *InvalidatingStore) DeleteBook(ctx context.Context, id int, version int) error {
+	err := s.Store.DeleteBook(ctx, id, version)
+	if err == nil {
+		s.invalidate(ctx, cache.BookTag(id), cache.BooksTag)
+	}
+	return err
+}
+
+// UpdateAuthor also drops book lists, since searches by author name may now
+// match books they did not before.
+func (s *InvalidatingStore) UpdateAuthor(ctx context.Context, id int, author m.Author) error {
+	err := s.Store.UpdateAuthor(ctx, id, author)
+	if err == nil {
+		s.invalidate(ctx, cache.AuthorTag(id), cache.BooksTag)
+	}
+	return err
+}
+
+func (s *InvalidatingStore) PatchAuthor(ctx context.Context, id int, patch m.AuthorPatch) error {
+	err := s.Store.PatchAuthor(ctx, id, patch)
+	if err == nil {
+		s.invalidate(ctx, cache.AuthorTag(id), cache.BooksTag)
+	}
+	return err
+}
+
+// DeleteAuthor also deletes the author's books (ON DELETE CASCADE).
+func (s *InvalidatingStore) DeleteAuthor(ctx context.Context, id int, version int) error {
+	err := s.Store.DeleteAuthor(ctx, id, version)
+	if err == nil {
+		s.invalidate(ctx, cache.AuthorTag(id), cache.BooksTag)
+	}
+	return err
+}
+
+// Orders change book stock when they are placed, edited or cancelled.
+
+func (s *InvalidatingStore) CreateOrder(ctx context.Context, order m.Order) (m.Order, error) {
+	created, err := s.Store.CreateOrder(ctx, order)
+	if err == nil {
+		s.invalidate(ctx, stockTags(created.Items)...)
+	}
+	return created, err
+}
+
+// UpdateOrder restocks the order's books when it cancels the order.
+func (s *InvalidatingStore) UpdateOrder(ctx context.Context, id int, order m.Order, changedBy string) error {
+	err := s.Store.UpdateOrder(ctx, id, order, changedBy)
+	if err == nil && NormalizeOrderStatus(order.Status) == m.OrderStatusCancelled {
+		updated, _ := s.Store.GetOrder(ctx, id)
+		s.invalidate(ctx, stockTags(updated.Items)...)
+	}
+	return err
+}
+
+func (s *InvalidatingStore) UpdateOrderItems(ctx context.Context, id int, items []m.OrderItem, merge bool, version int) (m.Order, error) {
+	// Books removed from the order are restocked too
+	before, _ := s.Store.GetOrder(ctx, id)
+	updated, err := s.Store.UpdateOrderItems(ctx, id, items, merge, version)
+	if err == nil {
+		s.invalidate(ctx, stockTags(append(before.Items, updated.Items...))...)
+	}
+	return updated, err
+}
+
+func (s *InvalidatingStore) TransitionOrder(ctx context.Context, id int, to string, changedBy string, version int) (m.Order, error) {
+	updated, err := s.Store.TransitionOrder(ctx, id, to, changedBy, version)
+	if err == nil && to == m.OrderStatusCancelled {
+		s.invalidate(ctx, stockTags(updated.Items)...)
+	}
+	return updated, err
+}
+
+// invalidate runs even if the request was cancelled after the write
+// committed; failures are logged and the entries expire with their TTL.
+func (s *InvalidatingStore) invalidate(ctx context.Context, tags ...string) {
+	if err := s.cache.InvalidateTags(context.WithoutCancel(ctx), tags...); err != nil {
+		logging.FromContext(ctx).Error("error invalidating cache tags", "err", err)
+	}
+}
+
+func genreTags(genres []string) []string {
+	tags := make([]string, 0, len(genres)+2)
+	for _, genre := range genres {
+		tags = append(tags, cache.GenreTag(genre))
+	}
+	return tags
+}
+
+// stockTags returns the tags of the books in items plus the list tag, since
+// lists can be sorted by stock.
+func stockTags(items []m.OrderItem) []string {
+	tags := []string{cache.BooksTag}
+	for _, item := range items {
+		tags = append(tags, cache.BookTag(item.Book.ID))
+	}
+	return tags
+}
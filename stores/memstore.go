@@ -0,0 +1,1100 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	m "project.com/myproject/models"
+)
+
+// errMissingReference mirrors a foreign key violation in the Postgres schema.
+var errMissingReference = errors.New("referenced record does not exist")
+
+// MemoryStore keeps everything in maps with the same semantics as
+// PostgresStore: stock checks, genre linking, search filters, status history
+// and cascading deletes. It is meant for tests and local development.
+type MemoryStore struct {
+	Pricing PricingPolicy
+
+	mu        sync.Mutex
+	ids       map[string]int
+	authors   map[int]m.Author
+	books     map[int]m.Book // Author only carries the ID; it is resolved on read
+	customers map[int]m.Customer
+	orders    map[int]*memoryOrder
+	users     map[int]m.User
+	tokens    map[string]m.RefreshToken // keyed by token hash
+}
+
+// memoryOrder holds an order row (Customer only carries the ID), its item
+// lines with snapshotted title and unit price, and its status history.
+type memoryOrder struct {
+	order   m.Order
+	items   []m.OrderItem
+	history []m.OrderStatusChange
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		Pricing:   DefaultPricingPolicy,
+		ids:       make(map[string]int),
+		authors:   make(map[int]m.Author),
+		books:     make(map[int]m.Book),
+		customers: make(map[int]m.Customer),
+		orders:    make(map[int]*memoryOrder),
+		users:     make(map[int]m.User),
+		tokens:    make(map[string]m.RefreshToken),
+	}
+}
+
+// nextID emulates a per-table serial column.
+func (s *MemoryStore) nextID(table string) int {
+	s.ids[table]++
+	return s.ids[table]
+}
+
+// checkVersion emulates the version guard of the Postgres writes: a non-zero
+// version must match the stored one. Writers then store stored+1, like the
+// bump_version trigger.
+func checkVersion(stored, version int) error {
+	if version != 0 && version != stored {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// containsFold emulates ILIKE '%substr%'.
+func containsFold(value, substr string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(substr))
+}
+
+// Book Store Methods
+
+func (s *MemoryStore) CreateBook(ctx context.Context, book m.Book) (m.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.authors[book.Author.ID]; !ok {
+		return m.Book{}, errMissingReference
+	}
+	book.ID = s.nextID("books")
+	book.Genres = uniqueGenres(book.Genres)
+	book.Version = 1
+	s.books[book.ID] = book
+	return book, nil
+}
+
+func (s *MemoryStore) GetBook(ctx context.Context, id int) (m.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.books[id]; !ok {
+		return m.Book{}, sql.ErrNoRows
+	}
+	return s.book(id), nil
+}
+
+// book returns a copy of a stored book with its author resolved.
+func (s *MemoryStore) book(id int) m.Book {
+	book := s.books[id]
+	book.Author = s.authors[book.Author.ID]
+	book.Genres = append([]string{}, book.Genres...)
+	return book
+}
+
+func (s *MemoryStore) GetAllBooks(ctx context.Context, params m.ListParams) (m.Page[m.Book], error) {
+	return s.listBooks(m.SearchCriteriaBooks{}, params)
+}
+
+func (s *MemoryStore) UpdateBook(ctx context.Context, id int, book m.Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.books[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(existing.Version, book.Version); err != nil {
+		return err
+	}
+	if _, ok := s.authors[book.Author.ID]; !ok {
+		return errMissingReference
+	}
+
+	book.ID = id
+	book.Version = existing.Version + 1
+	book.Author = m.Author{ID: book.Author.ID}
+	if len(book.Genres) > 0 {
+		book.Genres = uniqueGenres(book.Genres)
+	} else {
+		book.Genres = existing.Genres
+	}
+	s.books[id] = book
+	return nil
+}
+
+func (s *MemoryStore) PatchBook(ctx context.Context, id int, patch m.BookPatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book, ok := s.books[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(book.Version, patch.Version); err != nil {
+		return err
+	}
+	if patch.AuthorID != nil {
+		if _, ok := s.authors[*patch.AuthorID]; !ok {
+			return errMissingReference
+		}
+		book.Author = m.Author{ID: *patch.AuthorID}
+	}
+	if patch.Title != nil {
+		book.Title = *patch.Title
+	}
+	if patch.Genres != nil {
+		book.Genres = uniqueGenres(*patch.Genres)
+	}
+	if patch.PublishedAt != nil {
+		book.PublishedAt = *patch.PublishedAt
+	}
+	if patch.Price != nil {
+		book.Price = *patch.Price
+	}
+	if patch.Stock != nil {
+		book.Stock = *patch.Stock
+	}
+	book.Version++
+	s.books[id] = book
+	return nil
+}
+
+// DeleteBook decreases the stock by one, deleting the book once it would run out.
+func (s *MemoryStore) DeleteBook(ctx context.Context, id int, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book, ok := s.books[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(book.Version, version); err != nil {
+		return err
+	}
+	if book.Stock > 1 {
+		book.Stock--
+		book.Version++
+		s.books[id] = book
+		return nil
+	}
+	s.deleteBook(id)
+	return nil
+}
+
+// deleteBook removes a book and, like ON DELETE CASCADE, its order lines.
+func (s *MemoryStore) deleteBook(id int) {
+	delete(s.books, id)
+	for _, o := range s.orders {
+		kept := o.items[:0]
+		for _, item := range o.items {
+			if item.Book.ID != id {
+				kept = append(kept, item)
+			}
+		}
+		o.items = kept
+	}
+}
+
+// SearchBooks returns one page of matches, or sql.ErrNoRows when nothing matches at all.
+func (s *MemoryStore) SearchBooks(ctx context.Context, criteria m.SearchCriteriaBooks, params m.ListParams) (m.Page[m.Book], error) {
+	result, err := s.listBooks(criteria, params)
+	if err == nil && len(result.Data) == 0 && params.Cursor == "" {
+		return m.Page[m.Book]{}, sql.ErrNoRows
+	}
+	return result, err
+}
+
+func (s *MemoryStore) listBooks(criteria m.SearchCriteriaBooks, params m.ListParams) (m.Page[m.Book], error) {
+	page, err := bookKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Book]{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var books []m.Book
+	for id := range s.books {
+		book := s.book(id)
+		if criteria.Title != "" && !containsFold(book.Title, criteria.Title) ||
+			criteria.AuthorFirstName != "" && !containsFold(book.Author.FirstName, criteria.AuthorFirstName) ||
+			criteria.AuthorName != "" && !containsFold(book.Author.LastName, criteria.AuthorName) ||
+			criteria.MinPrice > 0 && book.Price < criteria.MinPrice ||
+			criteria.MaxPrice > 0 && book.Price > criteria.MaxPrice {
+			continue
+		}
+		books = append(books, book)
+	}
+
+	return page.pageOf(books)
+}
+
+func uniqueGenres(genres []string) []string {
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, genre := range genres {
+		if !seen[genre] {
+			seen[genre] = true
+			unique = append(unique, genre)
+		}
+	}
+	return unique
+}
+
+// Author Store Methods
+
+func (s *MemoryStore) CreateAuthor(ctx context.Context, author m.Author) (m.Author, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	author.ID = s.nextID("authors")
+	author.Version = 1
+	s.authors[author.ID] = author
+	return author, nil
+}
+
+func (s *MemoryStore) GetAuthor(ctx context.Context, id int) (m.Author, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	author, ok := s.authors[id]
+	if !ok {
+		return m.Author{}, sql.ErrNoRows
+	}
+	return author, nil
+}
+
+func (s *MemoryStore) GetAllAuthors(ctx context.Context, params m.ListParams) (m.Page[m.Author], error) {
+	return s.listAuthors(m.SearchCriteriaAuthors{}, params)
+}
+
+func (s *MemoryStore) UpdateAuthor(ctx context.Context, id int, author m.Author) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.authors[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(existing.Version, author.Version); err != nil {
+		return err
+	}
+	author.ID = id
+	author.Version = existing.Version + 1
+	s.authors[id] = author
+	return nil
+}
+
+func (s *MemoryStore) PatchAuthor(ctx context.Context, id int, patch m.AuthorPatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	author, ok := s.authors[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(author.Version, patch.Version); err != nil {
+		return err
+	}
+	patchString(&author.FirstName, patch.FirstName)
+	patchString(&author.LastName, patch.LastName)
+	patchString(&author.Bio, patch.Bio)
+	author.Version++
+	s.authors[id] = author
+	return nil
+}
+
+func patchString(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// DeleteAuthor removes the author and, like ON DELETE CASCADE, their books.
+func (s *MemoryStore) DeleteAuthor(ctx context.Context, id int, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	author, ok := s.authors[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(author.Version, version); err != nil {
+		return err
+	}
+	delete(s.authors, id)
+	for bookID, book := range s.books {
+		if book.Author.ID == id {
+			s.deleteBook(bookID)
+		}
+	}
+	return nil
+}
+
+// SearchAuthors returns one page of matches, or sql.ErrNoRows when nothing matches at all.
+func (s *MemoryStore) SearchAuthors(ctx context.Context, criteria m.SearchCriteriaAuthors, params m.ListParams) (m.Page[m.Author], error) {
+	result, err := s.listAuthors(criteria, params)
+	if err == nil && len(result.Data) == 0 && params.Cursor == "" {
+		return m.Page[m.Author]{}, sql.ErrNoRows
+	}
+	return result, err
+}
+
+func (s *MemoryStore) listAuthors(criteria m.SearchCriteriaAuthors, params m.ListParams) (m.Page[m.Author], error) {
+	page, err := authorKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Author]{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var authors []m.Author
+	for _, author := range s.authors {
+		if criteria.FirstName != "" && !containsFold(author.FirstName, criteria.FirstName) ||
+			criteria.LastName != "" && !containsFold(author.LastName, criteria.LastName) {
+			continue
+		}
+		authors = append(authors, author)
+	}
+
+	return page.pageOf(authors)
+}
+
+// Customer Store Methods
+
+func (s *MemoryStore) CreateCustomer(ctx context.Context, customer m.Customer) (m.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.customerEmailTaken(customer.Email, 0) {
+		return m.Customer{}, ErrCustomerEmailExists
+	}
+	customer.ID = s.nextID("customers")
+	customer.Version = 1
+	s.customers[customer.ID] = customer
+	return customer, nil
+}
+
+func (s *MemoryStore) customerEmailTaken(email string, exceptID int) bool {
+	for id, customer := range s.customers {
+		if id != exceptID && customer.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) GetCustomer(ctx context.Context, id int) (m.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	customer, ok := s.customers[id]
+	if !ok {
+		return m.Customer{}, sql.ErrNoRows
+	}
+	return customer, nil
+}
+
+func (s *MemoryStore) GetAllCustomers(ctx context.Context, params m.ListParams) (m.Page[m.Customer], error) {
+	return s.listCustomers(m.SearchCriteriaCustomers{}, params)
+}
+
+func (s *MemoryStore) UpdateCustomer(ctx context.Context, id int, customer m.Customer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.customers[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(existing.Version, customer.Version); err != nil {
+		return err
+	}
+	if s.customerEmailTaken(customer.Email, id) {
+		return ErrCustomerEmailExists
+	}
+	customer.ID = id
+	customer.Version = existing.Version + 1
+	s.customers[id] = customer
+	return nil
+}
+
+func (s *MemoryStore) PatchCustomer(ctx context.Context, id int, patch m.CustomerPatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	customer, ok := s.customers[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(customer.Version, patch.Version); err != nil {
+		return err
+	}
+	if patch.Email != nil && s.customerEmailTaken(*patch.Email, id) {
+		return ErrCustomerEmailExists
+	}
+	patchString(&customer.Name, patch.Name)
+	patchString(&customer.Email, patch.Email)
+	patchString(&customer.Street, patch.Street)
+	patchString(&customer.City, patch.City)
+	patchString(&customer.State, patch.State)
+	patchString(&customer.PostalCode, patch.PostalCode)
+	patchString(&customer.Country, patch.Country)
+	customer.Version++
+	s.customers[id] = customer
+	return nil
+}
+
+// DeleteCustomer removes the customer and their orders, and unlinks their users.
+func (s *MemoryStore) DeleteCustomer(ctx context.Context, id int, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	customer, ok := s.customers[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(customer.Version, version); err != nil {
+		return err
+	}
+	delete(s.customers, id)
+	for orderID, o := range s.orders {
+		if o.order.Customer.ID == id {
+			delete(s.orders, orderID)
+		}
+	}
+	for userID, user := range s.users {
+		if user.CustomerID == id {
+			user.CustomerID = 0
+			s.users[userID] = user
+		}
+	}
+	return nil
+}
+
+// SearchCustomers returns one page of matches, or sql.ErrNoRows when nothing matches at all.
+func (s *MemoryStore) SearchCustomers(ctx context.Context, criteria m.SearchCriteriaCustomers, params m.ListParams) (m.Page[m.Customer], error) {
+	result, err := s.listCustomers(criteria, params)
+	if err == nil && len(result.Data) == 0 && params.Cursor == "" {
+		return m.Page[m.Customer]{}, sql.ErrNoRows
+	}
+	return result, err
+}
+
+func (s *MemoryStore) listCustomers(criteria m.SearchCriteriaCustomers, params m.ListParams) (m.Page[m.Customer], error) {
+	page, err := customerKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Customer]{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var customers []m.Customer
+	for _, customer := range s.customers {
+		if criteria.Name != "" && !containsFold(customer.Name, criteria.Name) ||
+			criteria.Email != "" && !containsFold(customer.Email, criteria.Email) {
+			continue
+		}
+		customers = append(customers, customer)
+	}
+
+	return page.pageOf(customers)
+}
+
+// Order Store Methods
+
+// CreateOrder checks stock for every book, prices the order from the current
+// book prices and decrements stock, all under the store lock.
+func (s *MemoryStore) CreateOrder(ctx context.Context, order m.Order) (m.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quantities := make(map[int]int)
+	var bookIDs []int
+	for _, item := range order.Items {
+		if _, seen := quantities[item.Book.ID]; !seen {
+			bookIDs = append(bookIDs, item.Book.ID)
+		}
+		quantities[item.Book.ID] += item.Quantity
+	}
+	sort.Ints(bookIDs)
+
+	var insufficient []int
+	for _, id := range bookIDs {
+		book, ok := s.books[id]
+		if !ok {
+			return m.Order{}, ErrBookNotFound
+		}
+		if book.Stock < quantities[id] {
+			insufficient = append(insufficient, id)
+		}
+	}
+	if len(insufficient) > 0 {
+		return m.Order{}, &ErrInsufficientStock{BookIDs: insufficient}
+	}
+	if _, ok := s.customers[order.Customer.ID]; !ok {
+		return m.Order{}, errMissingReference
+	}
+
+	order.Status = m.OrderStatusPending
+	for i := range order.Items {
+		book := s.books[order.Items[i].Book.ID]
+		order.Items[i].Book.Title = book.Title
+		order.Items[i].Book.Price = book.Price
+		order.Items[i].UnitPrice = book.Price
+	}
+	s.Pricing.Price(&order)
+
+	order.ID = s.nextID("orders")
+	order.CreatedAt = time.Now()
+	order.Version = 1
+
+	stored := &memoryOrder{order: order}
+	stored.order.Customer = m.Customer{ID: order.Customer.ID}
+	stored.order.Items = nil
+	for _, item := range order.Items {
+		stored.items = append(stored.items, m.OrderItem{
+			Book:      m.Book{ID: item.Book.ID, Title: item.Book.Title},
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+	stored.history = append(stored.history, m.OrderStatusChange{ToStatus: order.Status, ChangedAt: order.CreatedAt})
+	s.orders[order.ID] = stored
+
+	for _, id := range bookIDs {
+		book := s.books[id]
+		book.Stock -= quantities[id]
+		book.Version++
+		s.books[id] = book
+	}
+	return order, nil
+}
+
+func (s *MemoryStore) GetOrder(ctx context.Context, id int) (m.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[id]; !ok {
+		return m.Order{}, sql.ErrNoRows
+	}
+	return s.order(id, true), nil
+}
+
+// order returns a copy of a stored order with its customer resolved and, when
+// withItems is set, its items joined with the current book data.
+func (s *MemoryStore) order(id int, withItems bool) m.Order {
+	o := s.orders[id]
+	order := o.order
+	order.Customer = s.customers[o.order.Customer.ID]
+	if !withItems {
+		return order
+	}
+	for _, line := range o.items {
+		item := line
+		book := s.book(line.Book.ID)
+		item.Book = m.Book{ID: book.ID, Title: line.Book.Title, Author: book.Author,
+			PublishedAt: book.PublishedAt, Price: line.UnitPrice, Stock: book.Stock}
+		item.LineTotal = fromCents(toCents(item.UnitPrice) * int64(item.Quantity))
+		order.Items = append(order.Items, item)
+	}
+	return order
+}
+
+func (s *MemoryStore) GetAllOrders(ctx context.Context, params m.ListParams) (m.Page[m.Order], error) {
+	return s.SearchOrders(ctx, m.SearchCriteriaOrders{}, params)
+}
+
+// UpdateOrder changes the customer of an order and, if order.Status is set
+// and differs, its status, like PostgresStore.UpdateOrder.
+func (s *MemoryStore) UpdateOrder(ctx context.Context, id int, order m.Order, changedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(o.order.Version, order.Version); err != nil {
+		return err
+	}
+	if _, ok := s.customers[order.Customer.ID]; !ok {
+		return errMissingReference
+	}
+	to := NormalizeOrderStatus(order.Status)
+	changeStatus := to != "" && to != o.order.Status
+	if changeStatus && !CanTransition(o.order.Status, to) {
+		return &ErrInvalidTransition{From: o.order.Status, To: to}
+	}
+
+	o.order.Customer = m.Customer{ID: order.Customer.ID}
+	o.order.Version++
+	if changeStatus {
+		s.applyTransition(o, to, changedBy)
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteOrder(ctx context.Context, id int, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if err := checkVersion(o.order.Version, version); err != nil {
+		return err
+	}
+	delete(s.orders, id)
+	return nil
+}
+
+func (s *MemoryStore) SearchOrders(ctx context.Context, criteria m.SearchCriteriaOrders, params m.ListParams) (m.Page[m.Order], error) {
+	page, err := orderKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Order]{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := NormalizeOrderStatus(criteria.Status)
+	var orders []m.Order
+	for id, o := range s.orders {
+		if _, ok := s.customers[o.order.Customer.ID]; !ok {
+			continue
+		}
+		order := s.order(id, false)
+		if criteria.CustomerID != 0 && order.Customer.ID != criteria.CustomerID ||
+			criteria.CustomerName != "" && !containsFold(order.Customer.Name, criteria.CustomerName) ||
+			status != "" && order.Status != status {
+			continue
+		}
+		orders = append(orders, order)
+	}
+
+	result, err := page.pageOf(orders)
+	if err != nil {
+		return m.Page[m.Order]{}, err
+	}
+	if len(result.Data) == 0 && params.Cursor == "" && criteria != (m.SearchCriteriaOrders{}) {
+		return m.Page[m.Order]{}, sql.ErrNoRows
+	}
+	for i := range result.Data {
+		result.Data[i] = s.order(result.Data[i].ID, true)
+	}
+	return result, nil
+}
+
+// UpdateOrderItems replaces (or, with merge, patches) the items of a pending
+// order and moves stock by the difference, like PostgresStore.UpdateOrderItems.
+func (s *MemoryStore) UpdateOrderItems(ctx context.Context, id int, items []m.OrderItem, merge bool, version int) (m.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return m.Order{}, sql.ErrNoRows
+	}
+	if err := checkVersion(o.order.Version, version); err != nil {
+		return m.Order{}, err
+	}
+	if o.order.Status != m.OrderStatusPending {
+		return m.Order{}, ErrOrderNotPending
+	}
+
+	current := make(map[int]m.OrderItem)
+	for _, item := range o.items {
+		if existing, ok := current[item.Book.ID]; ok {
+			existing.Quantity += item.Quantity
+			item = existing
+		}
+		current[item.Book.ID] = item
+	}
+
+	requested := make(map[int]int)
+	if merge {
+		for bookID, item := range current {
+			requested[bookID] = item.Quantity
+		}
+		for _, item := range items {
+			requested[item.Book.ID] = 0
+		}
+	}
+	for _, item := range items {
+		requested[item.Book.ID] += item.Quantity
+	}
+	for bookID, quantity := range requested {
+		if quantity <= 0 {
+			delete(requested, bookID)
+		}
+	}
+	if len(requested) == 0 {
+		return m.Order{}, ErrEmptyOrder
+	}
+
+	var bookIDs []int
+	for bookID := range requested {
+		bookIDs = append(bookIDs, bookID)
+	}
+	for bookID := range current {
+		if _, ok := requested[bookID]; !ok {
+			bookIDs = append(bookIDs, bookID)
+		}
+	}
+	sort.Ints(bookIDs)
+
+	var insufficient []int
+	for _, bookID := range bookIDs {
+		book, ok := s.books[bookID]
+		if !ok {
+			if _, wanted := requested[bookID]; wanted {
+				return m.Order{}, ErrBookNotFound
+			}
+			continue
+		}
+		if delta := requested[bookID] - current[bookID].Quantity; delta > book.Stock {
+			insufficient = append(insufficient, bookID)
+		}
+	}
+	if len(insufficient) > 0 {
+		return m.Order{}, &ErrInsufficientStock{BookIDs: insufficient}
+	}
+
+	priced := m.Order{ID: id}
+	for _, bookID := range bookIDs {
+		if book, ok := s.books[bookID]; ok {
+			book.Stock -= requested[bookID] - current[bookID].Quantity
+			book.Version++
+			s.books[bookID] = book
+		}
+
+		quantity, ok := requested[bookID]
+		if !ok {
+			continue
+		}
+		item, existed := current[bookID]
+		if !existed {
+			book := s.books[bookID]
+			item = m.OrderItem{Book: m.Book{ID: bookID, Title: book.Title}, UnitPrice: book.Price}
+		}
+		item.Quantity = quantity
+		priced.Items = append(priced.Items, item)
+	}
+
+	s.Pricing.Price(&priced)
+	o.items = o.items[:0]
+	for _, item := range priced.Items {
+		o.items = append(o.items, m.OrderItem{Book: m.Book{ID: item.Book.ID, Title: item.Book.Title}, Quantity: item.Quantity, UnitPrice: item.UnitPrice})
+	}
+	o.order.Subtotal, o.order.Discount, o.order.Tax, o.order.TotalPrice = priced.Subtotal, priced.Discount, priced.Tax, priced.TotalPrice
+	o.order.Version++
+
+	return s.order(id, true), nil
+}
+
+// TransitionOrder moves an order to a new status; cancelling restocks its books.
+func (s *MemoryStore) TransitionOrder(ctx context.Context, id int, to string, changedBy string, version int) (m.Order, error) {
+	to = NormalizeOrderStatus(to)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return m.Order{}, sql.ErrNoRows
+	}
+	if err := checkVersion(o.order.Version, version); err != nil {
+		return m.Order{}, err
+	}
+	if !CanTransition(o.order.Status, to) {
+		return m.Order{}, &ErrInvalidTransition{From: o.order.Status, To: to}
+	}
+	o.order.Version++
+	s.applyTransition(o, to, changedBy)
+	return s.order(id, true), nil
+}
+
+// applyTransition moves o to status to, records the change and restocks the
+// order's books when cancelling. The caller checks CanTransition.
+func (s *MemoryStore) applyTransition(o *memoryOrder, to, changedBy string) {
+	from := o.order.Status
+	o.order.Status = to
+	o.history = append(o.history, m.OrderStatusChange{FromStatus: from, ToStatus: to, ChangedBy: changedBy, ChangedAt: time.Now()})
+
+	if to == m.OrderStatusCancelled {
+		for _, item := range o.items {
+			if book, ok := s.books[item.Book.ID]; ok {
+				book.Stock += item.Quantity
+				book.Version++
+				s.books[item.Book.ID] = book
+			}
+		}
+	}
+}
+
+func (s *MemoryStore) GetOrderStatusHistory(ctx context.Context, id int) ([]m.OrderStatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := []m.OrderStatusChange{}
+	if o, ok := s.orders[id]; ok {
+		history = append(history, o.history...)
+	}
+	return history, nil
+}
+
+// Report Store Methods
+
+// GetSalesReport aggregates revenue, order count and top selling books for
+// orders created within [startDate, endDate].
+func (s *MemoryStore) GetSalesReport(ctx context.Context, startDate, endDate time.Time) (m.SalesReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := m.SalesReport{Timestamp: time.Now()}
+	sold := make(map[int]int)
+	for _, o := range s.orders {
+		if o.order.CreatedAt.Before(startDate) || o.order.CreatedAt.After(endDate) {
+			continue
+		}
+		report.TotalRevenue += o.order.TotalPrice
+		report.TotalOrders++
+		for _, item := range o.items {
+			sold[item.Book.ID] += item.Quantity
+		}
+	}
+
+	for bookID, quantity := range sold {
+		book := s.books[bookID]
+		report.TopSellingBooks = append(report.TopSellingBooks, m.BookSales{
+			Book:     m.Book{ID: book.ID, Title: book.Title, PublishedAt: book.PublishedAt, Price: book.Price, Stock: book.Stock},
+			Quantity: quantity,
+		})
+	}
+	sort.Slice(report.TopSellingBooks, func(i, j int) bool {
+		a, b := report.TopSellingBooks[i], report.TopSellingBooks[j]
+		if a.Quantity != b.Quantity {
+			return a.Quantity > b.Quantity
+		}
+		return a.Book.ID < b.Book.ID
+	})
+	return report, nil
+}
+
+// User Store Methods
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user m.User) (m.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.Username = NormalizeUsername(user.Username)
+	user.Email = NormalizeEmail(user.Email)
+	if len(user.Roles) == 0 {
+		user.Roles = []string{DefaultUserRole}
+	}
+	for _, existing := range s.users {
+		if existing.Username == user.Username || existing.Email == user.Email {
+			return m.User{}, ErrUserExists
+		}
+	}
+	if user.CustomerID != 0 {
+		if _, ok := s.customers[user.CustomerID]; !ok {
+			return m.User{}, errMissingReference
+		}
+	}
+
+	now := time.Now()
+	user.ID = s.nextID("users")
+	user.Roles = append([]string{}, user.Roles...)
+	user.Disabled = false
+	user.CreatedAt, user.UpdatedAt = now, now
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, id int) (m.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return m.User{}, sql.ErrNoRows
+	}
+	user.Roles = append([]string{}, user.Roles...)
+	return user, nil
+}
+
+func (s *MemoryStore) GetUserByUsername(ctx context.Context, username string) (m.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	username = NormalizeUsername(username)
+	for _, user := range s.users {
+		if user.Username == username {
+			user.Roles = append([]string{}, user.Roles...)
+			return user, nil
+		}
+	}
+	return m.User{}, sql.ErrNoRows
+}
+
+func (s *MemoryStore) UpdateUser(ctx context.Context, id int, user m.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	email := NormalizeEmail(user.Email)
+	for otherID, other := range s.users {
+		if otherID != id && other.Email == email {
+			return ErrUserExists
+		}
+	}
+	existing.Email = email
+	existing.PasswordHash = user.PasswordHash
+	existing.UpdatedAt = time.Now()
+	s.users[id] = existing
+	return nil
+}
+
+func (s *MemoryStore) UpdateUserPassword(ctx context.Context, id int, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.PasswordHash = passwordHash
+	user.UpdatedAt = time.Now()
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) SetUserRoles(ctx context.Context, id int, roles []string, customerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if customerID != 0 {
+		if _, ok := s.customers[customerID]; !ok {
+			return errMissingReference
+		}
+	}
+	user.Roles = append([]string{}, roles...)
+	user.CustomerID = customerID
+	user.UpdatedAt = time.Now()
+	s.users[id] = user
+	return nil
+}
+
+func (s *MemoryStore) DisableUser(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Disabled = true
+	user.UpdatedAt = time.Now()
+	s.users[id] = user
+	return nil
+}
+
+// Token Store Methods
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, token m.RefreshToken) (m.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertRefreshToken(token)
+}
+
+func (s *MemoryStore) insertRefreshToken(token m.RefreshToken) (m.RefreshToken, error) {
+	if _, ok := s.users[token.UserID]; !ok {
+		return m.RefreshToken{}, errMissingReference
+	}
+	if _, ok := s.tokens[token.TokenHash]; ok {
+		return m.RefreshToken{}, fmt.Errorf("refresh token hash already exists")
+	}
+	token.ID = s.nextID("refresh_tokens")
+	token.CreatedAt = time.Now()
+	token.UsedAt, token.RevokedAt = nil, nil
+	s.tokens[token.TokenHash] = token
+	return token, nil
+}
+
+// RotateRefreshToken marks the presented token used and stores its
+// replacement; reusing a token revokes its whole family.
+func (s *MemoryStore) RotateRefreshToken(ctx context.Context, oldHash string, next m.RefreshToken) (m.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.tokens[oldHash]
+	if !ok {
+		return m.RefreshToken{}, ErrRefreshTokenInvalid
+	}
+	if current.UsedAt != nil || current.RevokedAt != nil {
+		s.revokeFamily(current.FamilyID)
+		return m.RefreshToken{}, ErrRefreshTokenReused
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return m.RefreshToken{}, ErrRefreshTokenInvalid
+	}
+
+	now := time.Now()
+	current.UsedAt = &now
+	s.tokens[oldHash] = current
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	return s.insertRefreshToken(next)
+}
+
+func (s *MemoryStore) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenHash]
+	if !ok {
+		return ErrRefreshTokenInvalid
+	}
+	s.revokeFamily(token.FamilyID)
+	return nil
+}
+
+func (s *MemoryStore) revokeFamily(familyID string) {
+	now := time.Now()
+	for hash, token := range s.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			s.tokens[hash] = token
+		}
+	}
+}
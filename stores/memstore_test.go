@@ -0,0 +1,166 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	m "project.com/myproject/models"
+)
+
+func seedMemoryStore(t *testing.T) (*MemoryStore, m.Book, m.Customer) {
+	t.Helper()
+	ctx := context.Background()
+	mem := NewMemoryStore()
+
+	author, _ := mem.CreateAuthor(ctx, m.Author{FirstName: "Jane", LastName: "Austen"})
+	book, err := mem.CreateBook(ctx, m.Book{Title: "Emma", Author: author, Genres: []string{"Classic", "Classic", "Romance"},
+		PublishedAt: time.Date(1815, 12, 23, 0, 0, 0, 0, time.UTC), Price: 12.50, Stock: 3})
+	if err != nil {
+		t.Fatalf("Failed to create book: %v", err)
+	}
+	customer, _ := mem.CreateCustomer(ctx, m.Customer{Name: "Anne Elliot", Email: "anne@example.com"})
+	return mem, book, customer
+}
+
+func TestMemoryStore_BooksAndSearch(t *testing.T) {
+	ctx := context.Background()
+	mem, book, _ := seedMemoryStore(t)
+
+	if _, err := mem.CreateBook(ctx, m.Book{Title: "Orphan", Author: m.Author{ID: 99}}); err == nil {
+		t.Fatal("Expected an error for a missing author")
+	}
+
+	fetched, err := mem.GetBook(ctx, book.ID)
+	if err != nil {
+		t.Fatalf("Failed to get book: %v", err)
+	}
+	if fetched.Author.LastName != "Austen" || len(fetched.Genres) != 2 {
+		t.Fatalf("Expected resolved author and 2 unique genres, got %+v", fetched)
+	}
+
+	found, err := mem.SearchBooks(ctx, m.SearchCriteriaBooks{AuthorName: "aust", MaxPrice: 20}, m.ListParams{})
+	if err != nil || len(found.Data) != 1 {
+		t.Fatalf("Expected one match, got %v (%v)", found.Data, err)
+	}
+	if _, err := mem.SearchBooks(ctx, m.SearchCriteriaBooks{MinPrice: 20}, m.ListParams{}); err != sql.ErrNoRows {
+		t.Fatalf("Expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestMemoryStore_Pagination(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	for _, name := range []string{"C", "A", "B"} {
+		mem.CreateAuthor(ctx, m.Author{FirstName: name, LastName: "Writer"})
+	}
+
+	params := m.ListParams{Limit: 2, Sort: []m.SortField{{Column: "first_name", Desc: true}}}
+	first, err := mem.GetAllAuthors(ctx, params)
+	if err != nil {
+		t.Fatalf("Failed to list authors: %v", err)
+	}
+	if len(first.Data) != 2 || first.Data[0].FirstName != "C" || first.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %+v", first)
+	}
+
+	params.Cursor = first.NextCursor
+	second, err := mem.GetAllAuthors(ctx, params)
+	if err != nil {
+		t.Fatalf("Failed to list authors: %v", err)
+	}
+	if len(second.Data) != 1 || second.Data[0].FirstName != "A" || second.NextCursor != "" {
+		t.Fatalf("Unexpected second page: %+v", second)
+	}
+}
+
+func TestMemoryStore_OrderStockAndCancel(t *testing.T) {
+	ctx := context.Background()
+	mem, book, customer := seedMemoryStore(t)
+
+	_, err := mem.CreateOrder(ctx, m.Order{Customer: customer, Items: []m.OrderItem{{Book: m.Book{ID: book.ID}, Quantity: 4}}})
+	var stockErr *ErrInsufficientStock
+	if !errors.As(err, &stockErr) || len(stockErr.BookIDs) != 1 {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+
+	order, err := mem.CreateOrder(ctx, m.Order{Customer: customer, Items: []m.OrderItem{{Book: m.Book{ID: book.ID}, Quantity: 2}}})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if order.Status != m.OrderStatusPending || order.Subtotal != 25 {
+		t.Fatalf("Expected a pending order with subtotal 25, got %+v", order)
+	}
+	if fetched, _ := mem.GetBook(ctx, book.ID); fetched.Stock != 1 {
+		t.Fatalf("Expected stock 1 after ordering, got %d", fetched.Stock)
+	}
+
+	if _, err := mem.TransitionOrder(ctx, order.ID, m.OrderStatusCancelled, "staff", 0); err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+	if fetched, _ := mem.GetBook(ctx, book.ID); fetched.Stock != 3 {
+		t.Fatalf("Expected stock 3 after cancelling, got %d", fetched.Stock)
+	}
+	history, _ := mem.GetOrderStatusHistory(ctx, order.ID)
+	if len(history) != 2 || history[1].FromStatus != m.OrderStatusPending {
+		t.Fatalf("Unexpected history: %+v", history)
+	}
+}
+
+func TestMemoryStore_DeleteAuthorCascades(t *testing.T) {
+	ctx := context.Background()
+	mem, book, customer := seedMemoryStore(t)
+
+	order, _ := mem.CreateOrder(ctx, m.Order{Customer: customer, Items: []m.OrderItem{{Book: m.Book{ID: book.ID}, Quantity: 1}}})
+	if err := mem.DeleteAuthor(ctx, book.Author.ID, 0); err != nil {
+		t.Fatalf("Failed to delete author: %v", err)
+	}
+	if _, err := mem.GetBook(ctx, book.ID); err != sql.ErrNoRows {
+		t.Fatalf("Expected the book to be deleted, got %v", err)
+	}
+	if fetched, _ := mem.GetOrder(ctx, order.ID); len(fetched.Items) != 0 {
+		t.Fatalf("Expected the order lines to be deleted, got %+v", fetched.Items)
+	}
+}
+
+// failingStore fails GetBook the way a broken database connection would.
+type failingStore struct{ Store }
+
+func (failingStore) GetBook(ctx context.Context, id int) (m.Book, error) {
+	return m.Book{}, errors.New("connection refused")
+}
+
+func TestTracingStore_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mem, book, _ := seedMemoryStore(t)
+	ctx := context.Background()
+
+	if _, err := NewTracingStore(mem).GetBook(ctx, book.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTracingStore(mem).GetBook(ctx, 999); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Expected sql.ErrNoRows, got %v", err)
+	}
+	if _, err := NewTracingStore(failingStore{mem}).GetBook(ctx, book.ID); err == nil {
+		t.Fatal("Expected the stub error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	// A missing row is an expected outcome, not a failed span
+	for i, want := range []codes.Code{codes.Unset, codes.Unset, codes.Error} {
+		if spans[i].Name() != "stores.GetBook" || spans[i].Status().Code != want {
+			t.Errorf("span %d: %s status %v, want stores.GetBook %v", i, spans[i].Name(), spans[i].Status().Code, want)
+		}
+	}
+}
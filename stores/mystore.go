@@ -8,6 +8,7 @@ import (
 type PostgresStore struct {
 	DB            *sql.DB
 	Mu            sync.Mutex
+	Pricing       PricingPolicy
 	BookStore     *PostgresBookStore
 	AuthorStore   *PostgresAuthorStore
 	CustomerStore *PostgresCustomerStore
@@ -18,6 +19,7 @@ type PostgresStore struct {
 func NewPostgresStore(db *sql.DB) *PostgresStore {
 	return &PostgresStore{
 		DB:            db,
+		Pricing:       DefaultPricingPolicy,
 		BookStore:     &PostgresBookStore{DB: db},
 		AuthorStore:   &PostgresAuthorStore{DB: db},
 		CustomerStore: &PostgresCustomerStore{DB: db},
@@ -0,0 +1,200 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/lib/pq"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
+	m "project.com/myproject/models"
+)
+
+// ErrOrderNotPending is returned when editing the items of an order that has
+// already moved past pending.
+var ErrOrderNotPending = apperr.Conflict("order_not_pending", "Only pending orders can be edited")
+
+// ErrEmptyOrder is returned when an edit would leave an order without items.
+var ErrEmptyOrder = apperr.Validation(apperr.FieldError{Field: "items", Code: "required", Message: "An order must contain at least one item"})
+
+// ✅ Replace (or, with merge, patch) the items of a pending order.
+//
+// The requested items are diffed against the current ones per book and stock
+// is moved up or down by the difference, all in one transaction with the order
+// and book rows locked. With merge set, books not mentioned keep their
+// quantity and a quantity of 0 removes a book. Books already on the order keep
+// their snapshotted price; newly added books are priced at the current price.
+// A non-zero version must match the order's current version.
+func (s *PostgresStore) UpdateOrderItems(ctx context.Context, id int, items []m.OrderItem, merge bool, version int) (m.Order, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return m.Order{}, err
+	}
+	defer tx.Rollback()
+
+	// Step 1: Lock the order and make sure it is still editable
+	var status string
+	var stored int
+	err = tx.QueryRowContext(ctx, `SELECT status, version FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&status, &stored)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.FromContext(ctx).Error("error locking order", "err", err)
+		}
+		return m.Order{}, err
+	}
+	if version != 0 && version != stored {
+		return m.Order{}, ErrVersionMismatch
+	}
+	if status != m.OrderStatusPending {
+		return m.Order{}, ErrOrderNotPending
+	}
+
+	// Step 2: Load the current items, one entry per book
+	current := make(map[int]m.OrderItem)
+	rows, err := tx.QueryContext(ctx, `SELECT book_id, quantity, unit_price, title FROM order_items WHERE order_id = $1 ORDER BY id`, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("error retrieving order items", "err", err)
+		return m.Order{}, err
+	}
+	for rows.Next() {
+		var item m.OrderItem
+		if err := rows.Scan(&item.Book.ID, &item.Quantity, &item.UnitPrice, &item.Book.Title); err != nil {
+			rows.Close()
+			logging.FromContext(ctx).Error("error scanning order item", "err", err)
+			return m.Order{}, err
+		}
+		if existing, ok := current[item.Book.ID]; ok {
+			existing.Quantity += item.Quantity
+			item = existing
+		}
+		current[item.Book.ID] = item
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return m.Order{}, err
+	}
+
+	// Step 3: Work out the requested quantity per book
+	requested := make(map[int]int)
+	if merge {
+		for bookID, item := range current {
+			requested[bookID] = item.Quantity
+		}
+		for _, item := range items {
+			requested[item.Book.ID] = 0
+		}
+	}
+	for _, item := range items {
+		requested[item.Book.ID] += item.Quantity
+	}
+	for bookID, quantity := range requested {
+		if quantity <= 0 {
+			delete(requested, bookID)
+		}
+	}
+	if len(requested) == 0 {
+		return m.Order{}, ErrEmptyOrder
+	}
+
+	// Step 4: Lock every affected book in ID order and check stock for increases
+	var bookIDs []int
+	for bookID := range requested {
+		bookIDs = append(bookIDs, bookID)
+	}
+	for bookID := range current {
+		if _, ok := requested[bookID]; !ok {
+			bookIDs = append(bookIDs, bookID)
+		}
+	}
+	sort.Ints(bookIDs)
+
+	books := make(map[int]m.Book)
+	rows, err = tx.QueryContext(ctx, `SELECT id, title, price, stock FROM books WHERE id = ANY($1) ORDER BY id FOR UPDATE`, pq.Array(bookIDs))
+	if err != nil {
+		logging.FromContext(ctx).Error("error locking books", "err", err)
+		return m.Order{}, err
+	}
+	for rows.Next() {
+		var book m.Book
+		if err := rows.Scan(&book.ID, &book.Title, &book.Price, &book.Stock); err != nil {
+			rows.Close()
+			logging.FromContext(ctx).Error("error scanning book stock", "err", err)
+			return m.Order{}, err
+		}
+		books[book.ID] = book
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return m.Order{}, err
+	}
+
+	var insufficient []int
+	for _, bookID := range bookIDs {
+		book, ok := books[bookID]
+		if !ok {
+			if _, wanted := requested[bookID]; wanted {
+				return m.Order{}, ErrBookNotFound
+			}
+			continue
+		}
+		if delta := requested[bookID] - current[bookID].Quantity; delta > book.Stock {
+			insufficient = append(insufficient, bookID)
+		}
+	}
+	if len(insufficient) > 0 {
+		return m.Order{}, &ErrInsufficientStock{BookIDs: insufficient}
+	}
+
+	// Step 5: Move stock by the difference and rewrite the item lines
+	order := m.Order{ID: id}
+	for _, bookID := range bookIDs {
+		delta := requested[bookID] - current[bookID].Quantity
+		if delta != 0 {
+			if _, err := tx.ExecContext(ctx, `UPDATE books SET stock = stock - $1 WHERE id = $2`, delta, bookID); err != nil {
+				logging.FromContext(ctx).Error("error adjusting book stock", "err", err)
+				return m.Order{}, err
+			}
+		}
+
+		quantity, ok := requested[bookID]
+		if !ok {
+			continue
+		}
+		item, existed := current[bookID]
+		if !existed {
+			item = m.OrderItem{Book: m.Book{ID: bookID, Title: books[bookID].Title}, UnitPrice: books[bookID].Price}
+		}
+		item.Quantity = quantity
+		order.Items = append(order.Items, item)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM order_items WHERE order_id = $1`, id); err != nil {
+		logging.FromContext(ctx).Error("error clearing order items", "err", err)
+		return m.Order{}, err
+	}
+	for _, item := range order.Items {
+		_, err := tx.ExecContext(ctx, `INSERT INTO order_items (order_id, book_id, quantity, unit_price, title) VALUES ($1, $2, $3, $4, $5)`,
+			id, item.Book.ID, item.Quantity, item.UnitPrice, item.Book.Title)
+		if err != nil {
+			logging.FromContext(ctx).Error("error inserting order item", "err", err)
+			return m.Order{}, err
+		}
+	}
+
+	// Step 6: Recompute the totals
+	s.Pricing.Price(&order)
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET subtotal = $1, discount = $2, tax = $3, total_price = $4 WHERE id = $5`,
+		order.Subtotal, order.Discount, order.Tax, order.TotalPrice, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("error updating order totals", "err", err)
+		return m.Order{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return m.Order{}, err
+	}
+
+	logging.FromContext(ctx).Info("order items updated", "order_id", id)
+	return s.GetOrder(ctx, id)
+}
@@ -0,0 +1,161 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
+	m "project.com/myproject/models"
+)
+
+// orderTransitions lists, for each status, the statuses an order may move to.
+// Cancelled and refunded orders are final.
+var orderTransitions = map[string][]string{
+	m.OrderStatusPending:   {m.OrderStatusPaid, m.OrderStatusCancelled},
+	m.OrderStatusPaid:      {m.OrderStatusPacked, m.OrderStatusCancelled, m.OrderStatusRefunded},
+	m.OrderStatusPacked:    {m.OrderStatusShipped, m.OrderStatusCancelled},
+	m.OrderStatusShipped:   {m.OrderStatusDelivered},
+	m.OrderStatusDelivered: {m.OrderStatusRefunded},
+	m.OrderStatusCancelled: {},
+	m.OrderStatusRefunded:  {},
+}
+
+// ErrInvalidTransition is returned when an order cannot move from From to To.
+type ErrInvalidTransition struct {
+	From string
+	To   string
+}
+
+func (e *ErrInvalidTransition) Error() string {
+	return fmt.Sprintf("cannot change order status from %q to %q", e.From, e.To)
+}
+
+func (e *ErrInvalidTransition) AppError() *apperr.Error {
+	return apperr.Conflict("invalid_transition", e.Error()).With("from", e.From).With("to", e.To)
+}
+
+// NormalizeOrderStatus lower-cases and trims a status string.
+func NormalizeOrderStatus(status string) string {
+	return strings.ToLower(strings.TrimSpace(status))
+}
+
+// ValidOrderStatus reports whether status is a known order status.
+func ValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether an order may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ✅ Move an order to a new status, recording the change and applying side
+// effects (cancelling restocks the order's books) in one transaction. A
+// non-zero version must match the order's current version.
+func (s *PostgresStore) TransitionOrder(ctx context.Context, id int, to string, changedBy string, version int) (m.Order, error) {
+	to = NormalizeOrderStatus(to)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return m.Order{}, err
+	}
+	defer tx.Rollback()
+
+	var from string
+	var stored int
+	err = tx.QueryRowContext(ctx, `SELECT status, version FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&from, &stored)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.FromContext(ctx).Error("error locking order", "err", err)
+		}
+		return m.Order{}, err
+	}
+	if version != 0 && version != stored {
+		return m.Order{}, ErrVersionMismatch
+	}
+
+	if err := applyTransition(ctx, tx, id, from, to, changedBy); err != nil {
+		return m.Order{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return m.Order{}, err
+	}
+
+	logging.FromContext(ctx).Info("order status changed", "order_id", id, "from", from, "to", to)
+	return s.GetOrder(ctx, id)
+}
+
+// ✅ Fetch the status history of an order, oldest first
+func (s *PostgresStore) GetOrderStatusHistory(ctx context.Context, id int) ([]m.OrderStatusChange, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT COALESCE(from_status, ''), to_status, COALESCE(changed_by, ''), changed_at
+	          FROM order_status_history WHERE order_id = $1 ORDER BY changed_at, id`, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("error retrieving order status history", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []m.OrderStatusChange{}
+	for rows.Next() {
+		var change m.OrderStatusChange
+		if err := rows.Scan(&change.FromStatus, &change.ToStatus, &change.ChangedBy, &change.ChangedAt); err != nil {
+			logging.FromContext(ctx).Error("error scanning order status change", "err", err)
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// applyTransition moves the order locked in tx from one status to another,
+// records the change and restocks the order's books when cancelling.
+func applyTransition(ctx context.Context, tx *sql.Tx, id int, from, to, changedBy string) error {
+	if !CanTransition(from, to) {
+		return &ErrInvalidTransition{From: from, To: to}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $1 WHERE id = $2`, to, id); err != nil {
+		logging.FromContext(ctx).Error("error updating order status", "err", err)
+		return err
+	}
+	if err := recordStatusChange(ctx, tx, id, from, to, changedBy); err != nil {
+		return err
+	}
+
+	if to == m.OrderStatusCancelled {
+		// Lock the books in ID order, then put the ordered quantities back
+		_, err := tx.ExecContext(ctx, `SELECT 1 FROM books WHERE id IN
+		          (SELECT book_id FROM order_items WHERE order_id = $1) ORDER BY id FOR UPDATE`, id)
+		if err != nil {
+			logging.FromContext(ctx).Error("error locking books for restock", "err", err)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE books b SET stock = b.stock + oi.quantity
+		          FROM (SELECT book_id, SUM(quantity) AS quantity FROM order_items WHERE order_id = $1 GROUP BY book_id) oi
+		          WHERE b.id = oi.book_id`, id)
+		if err != nil {
+			logging.FromContext(ctx).Error("error restocking books", "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func recordStatusChange(ctx context.Context, db execer, orderID int, from, to, changedBy string) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO order_status_history (order_id, from_status, to_status, changed_by)
+	          VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, ''))`, orderID, from, to, changedBy)
+	if err != nil {
+		logging.FromContext(ctx).Error("error recording order status change", "err", err)
+	}
+	return err
+}
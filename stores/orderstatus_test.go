@@ -0,0 +1,28 @@
+package stores
+
+import (
+	"testing"
+
+	m "project.com/myproject/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{m.OrderStatusPending, m.OrderStatusPaid, true},
+		{m.OrderStatusPending, m.OrderStatusCancelled, true},
+		{m.OrderStatusPending, m.OrderStatusShipped, false},
+		{m.OrderStatusShipped, m.OrderStatusCancelled, false},
+		{m.OrderStatusDelivered, m.OrderStatusRefunded, true},
+		{m.OrderStatusCancelled, m.OrderStatusPending, false},
+		{m.OrderStatusRefunded, m.OrderStatusPaid, false},
+	}
+
+	for _, c := range cases {
+		if got := CanTransition(c.from, c.to); got != c.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
@@ -3,9 +3,13 @@ package stores
 import (
 	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"sort"
 	"strconv"
 
+	"github.com/lib/pq"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
 	m "project.com/myproject/models"
 )
 
@@ -17,82 +21,168 @@ func NewPostgresOrderStore(db *sql.DB) *PostgresOrderStore {
 	return &PostgresOrderStore{DB: db}
 }
 
+// ErrInsufficientStock is returned by CreateOrder when one or more books do not
+// have enough stock; BookIDs lists every offending book.
+type ErrInsufficientStock struct {
+	BookIDs []int
+}
+
+func (e *ErrInsufficientStock) Error() string {
+	return fmt.Sprintf("insufficient stock for books %v", e.BookIDs)
+}
+
+func (e *ErrInsufficientStock) AppError() *apperr.Error {
+	return apperr.InsufficientStock(e.BookIDs)
+}
+
+// ErrBookNotFound is returned when an order references a book that does not exist.
+var ErrBookNotFound = apperr.New(apperr.KindValidation, "unknown_book", "An order item references a book that does not exist")
+
 // Order Store Methods
+
+// CreateOrder inserts the order and its items and decrements stock in a single
+// transaction. The book rows are locked with SELECT ... FOR UPDATE so that
+// concurrent orders (from any server instance) cannot oversell. Prices are
+// taken from books.price and snapshotted into order_items; any client-supplied
+// prices or totals are ignored.
 func (s *PostgresStore) CreateOrder(ctx context.Context, order m.Order) (m.Order, error) {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-	// Step 1: Insert the order
-	query := `INSERT INTO orders (customer_id, total_price, status) 
-	          VALUES ($1, $2, $3) RETURNING id`
-	var orderID int
-	err := s.DB.QueryRowContext(ctx, query, order.Customer.ID, order.TotalPrice, order.Status).Scan(&orderID)
+	// Merge duplicate lines so each book is checked against its total quantity
+	quantities := make(map[int]int)
+	var bookIDs []int
+	for _, item := range order.Items {
+		if _, seen := quantities[item.Book.ID]; !seen {
+			bookIDs = append(bookIDs, item.Book.ID)
+		}
+		quantities[item.Book.ID] += item.Quantity
+	}
+	sort.Ints(bookIDs)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println("❌ Error inserting order:", err)
+		logging.FromContext(ctx).Error("error starting order transaction", "err", err)
 		return m.Order{}, err
 	}
-	order.ID = orderID
+	defer tx.Rollback()
 
-	// Step 2: Handle order items (link books to order and decrease stock)
-	for _, item := range order.Items {
-		// Check if book exists and has enough stock
-		var availableStock int
-		err := s.DB.QueryRow("SELECT stock FROM books WHERE id = $1", item.Book.ID).Scan(&availableStock)
-		if err != nil {
-			log.Println("❌ Error checking book stock:", err)
+	// Step 1: Lock the book rows (in ID order to avoid deadlocks) and check stock
+	rows, err := tx.QueryContext(ctx, `SELECT id, title, price, stock FROM books WHERE id = ANY($1) ORDER BY id FOR UPDATE`, pq.Array(bookIDs))
+	if err != nil {
+		logging.FromContext(ctx).Error("error locking books", "err", err)
+		return m.Order{}, err
+	}
+	stock := make(map[int]int)
+	books := make(map[int]m.Book)
+	for rows.Next() {
+		var book m.Book
+		if err := rows.Scan(&book.ID, &book.Title, &book.Price, &book.Stock); err != nil {
+			rows.Close()
+			logging.FromContext(ctx).Error("error scanning book stock", "err", err)
 			return m.Order{}, err
 		}
+		stock[book.ID] = book.Stock
+		books[book.ID] = book
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return m.Order{}, err
+	}
 
-		if availableStock < item.Quantity {
-			log.Println("❌ Not enough stock for book:", item.Book.ID)
-			return m.Order{}, sql.ErrNoRows
+	var insufficient []int
+	for _, id := range bookIDs {
+		available, ok := stock[id]
+		if !ok {
+			logging.FromContext(ctx).Warn("book not found for order", "book_id", id)
+			return m.Order{}, ErrBookNotFound
 		}
+		if available < quantities[id] {
+			insufficient = append(insufficient, id)
+		}
+	}
+	if len(insufficient) > 0 {
+		logging.FromContext(ctx).Warn("not enough stock", "book_ids", insufficient)
+		return m.Order{}, &ErrInsufficientStock{BookIDs: insufficient}
+	}
 
-		// Insert into order_items table
-		_, err = s.DB.Exec(`INSERT INTO order_items (order_id, book_id, quantity) VALUES ($1, $2, $3)`, orderID, item.Book.ID, item.Quantity)
+	// Step 2: Snapshot prices and titles, then price the order. New orders
+	// always start out pending; use TransitionOrder to move them along.
+	order.Status = m.OrderStatusPending
+	for i := range order.Items {
+		book := books[order.Items[i].Book.ID]
+		order.Items[i].Book.Title = book.Title
+		order.Items[i].Book.Price = book.Price
+		order.Items[i].UnitPrice = book.Price
+	}
+	s.Pricing.Price(&order)
+
+	// Step 3: Insert the order
+	query := `INSERT INTO orders (customer_id, subtotal, discount, tax, total_price, status) 
+	          VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, order.Customer.ID, order.Subtotal, order.Discount, order.Tax, order.TotalPrice, order.Status).Scan(&order.ID, &order.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("error inserting order", "err", err)
+		return m.Order{}, err
+	}
+
+	if err := recordStatusChange(ctx, tx, order.ID, "", order.Status, ""); err != nil {
+		return m.Order{}, err
+	}
+
+	// Step 4: Insert order items and decrease stock
+	for _, item := range order.Items {
+		_, err = tx.ExecContext(ctx, `INSERT INTO order_items (order_id, book_id, quantity, unit_price, title) VALUES ($1, $2, $3, $4, $5)`,
+			order.ID, item.Book.ID, item.Quantity, item.UnitPrice, item.Book.Title)
 		if err != nil {
-			log.Println("❌ Error inserting order item:", err)
+			logging.FromContext(ctx).Error("error inserting order item", "err", err)
 			return m.Order{}, err
 		}
-
-		// Decrease stock
-		_, err = s.DB.Exec("UPDATE books SET stock = stock - $1 WHERE id = $2", item.Quantity, item.Book.ID)
+	}
+	for _, id := range bookIDs {
+		_, err = tx.ExecContext(ctx, "UPDATE books SET stock = stock - $1 WHERE id = $2", quantities[id], id)
 		if err != nil {
-			log.Println("❌ Error decreasing book stock:", err)
+			logging.FromContext(ctx).Error("error decreasing book stock", "err", err)
 			return m.Order{}, err
 		}
 	}
 
-	log.Println("✅ Order created successfully with stock updated")
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(ctx).Error("error committing order", "err", err)
+		return m.Order{}, err
+	}
+
+	logging.FromContext(ctx).Info("order created", "order_id", order.ID)
 	return order, nil
 }
 
-func (s *PostgresStore) GetOrder(ctx context.Context, id int) (m.Order, error) {
-	// Step 1: Fetch the Order & Customer
-	query := `SELECT o.id, o.customer_id, c.name, c.email, c.street, c.city, c.state, c.postal_code, c.country, o.total_price, o.status, o.created_at
+// orderSelect selects an order joined with its customer; scan it with scanOrder.
+const orderSelect = `SELECT o.id, o.customer_id, c.name, c.email, c.street, c.city, c.state, c.postal_code, c.country,
+	                 o.subtotal, o.discount, o.tax, o.total_price, o.status, o.created_at, o.version
 	          FROM orders o
-	          JOIN customers c ON o.customer_id = c.id
-	          WHERE o.id = $1`
+	          JOIN customers c ON o.customer_id = c.id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+func scanOrder(row rowScanner) (m.Order, error) {
 	var order m.Order
-	err := s.DB.QueryRow(query, id).Scan(
-		&order.ID, &order.Customer.ID, &order.Customer.Name, &order.Customer.Email, &order.Customer.Street, &order.Customer.City, &order.Customer.State, &order.Customer.PostalCode, &order.Customer.Country,
-		&order.TotalPrice, &order.Status, &order.CreatedAt,
-	)
-	if err != nil {
-		log.Println("❌ Error retrieving order:", err)
-		return m.Order{}, err
-	}
+	err := row.Scan(&order.ID, &order.Customer.ID, &order.Customer.Name, &order.Customer.Email, &order.Customer.Street, &order.Customer.City, &order.Customer.State, &order.Customer.PostalCode, &order.Customer.Country,
+		&order.Subtotal, &order.Discount, &order.Tax, &order.TotalPrice, &order.Status, &order.CreatedAt, &order.Version)
+	return order, err
+}
 
-	// Step 2: Fetch Order Items (Books + Authors)
-	itemQuery := `SELECT b.id, b.title, b.published_at, b.price, b.stock, a.id, a.first_name, a.last_name, oi.quantity
+// getOrderItems fetches the items of an order with the title and unit price
+// snapshotted when the order was placed (not the book's current values).
+func (s *PostgresStore) getOrderItems(ctx context.Context, orderID int) ([]m.OrderItem, error) {
+	itemQuery := `SELECT b.id, oi.title, b.published_at, oi.unit_price, b.stock, a.id, a.first_name, a.last_name, oi.quantity
 	              FROM order_items oi
 	              JOIN books b ON oi.book_id = b.id
 	              JOIN authors a ON b.author_id = a.id
-	              WHERE oi.order_id = $1`
-	rows, err := s.DB.Query(itemQuery, id)
+	              WHERE oi.order_id = $1
+	              ORDER BY oi.id`
+	rows, err := s.DB.QueryContext(ctx, itemQuery, orderID)
 	if err != nil {
-		log.Println("❌ Error retrieving order items:", err)
-		return m.Order{}, err
+		logging.FromContext(ctx).Error("error retrieving order items", "err", err)
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -100,102 +190,114 @@ func (s *PostgresStore) GetOrder(ctx context.Context, id int) (m.Order, error) {
 	for rows.Next() {
 		var item m.OrderItem
 		var author m.Author
-		err := rows.Scan(&item.Book.ID, &item.Book.Title, &item.Book.PublishedAt, &item.Book.Price, &item.Book.Stock,
+		err := rows.Scan(&item.Book.ID, &item.Book.Title, &item.Book.PublishedAt, &item.UnitPrice, &item.Book.Stock,
 			&author.ID, &author.FirstName, &author.LastName, &item.Quantity)
 		if err != nil {
-			log.Println("❌ Error scanning order item:", err)
-			return m.Order{}, err
+			logging.FromContext(ctx).Error("error scanning order item", "err", err)
+			return nil, err
 		}
 		item.Book.Author = author
+		item.Book.Price = item.UnitPrice
+		item.LineTotal = fromCents(toCents(item.UnitPrice) * int64(item.Quantity))
 		items = append(items, item)
 	}
-
-	order.Items = items
-	return order, nil
+	return items, rows.Err()
 }
 
-func (s *PostgresStore) UpdateOrder(ctx context.Context, id int, order m.Order) error {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-	query := "UPDATE orders SET customer_id = $1, total_price = $2, status = $3 WHERE id = $4"
-	_, err := s.DB.Exec(query, order.Customer.ID, order.TotalPrice, order.Status, id)
-	return err
-}
+func (s *PostgresStore) GetOrder(ctx context.Context, id int) (m.Order, error) {
+	// Step 1: Fetch the Order & Customer
+	order, err := scanOrder(s.DB.QueryRowContext(ctx, orderSelect+` WHERE o.id = $1`, id))
+	if err != nil {
+		logging.FromContext(ctx).Error("error retrieving order", "err", err)
+		return m.Order{}, err
+	}
 
-func (s *PostgresStore) DeleteOrder(ctx context.Context, id int) error {
-	s.Mu.Lock()
-	defer s.Mu.Unlock()
-	query := "DELETE FROM orders WHERE id = $1"
-	_, err := s.DB.Exec(query, id)
-	return err
+	// Step 2: Fetch Order Items (Books + Authors)
+	order.Items, err = s.getOrderItems(ctx, id)
+	if err != nil {
+		return m.Order{}, err
+	}
+	return order, nil
 }
 
-func (s *PostgresStore) GetAllOrders(ctx context.Context) ([]m.Order, error) {
-	query := `SELECT o.id, o.customer_id, c.name, c.email, c.street, c.city, c.state, c.postal_code, c.country, o.total_price, o.status, o.created_at
-	          FROM orders o
-	          JOIN customers c ON o.customer_id = c.id`
-
-	rows, err := s.DB.Query(query)
+// UpdateOrder changes the customer of an order and, if order.Status is set
+// and differs from the current status, moves it there like TransitionOrder.
+// Both happen in one transaction, so a rejected transition changes nothing.
+// Totals are always computed server-side.
+func (s *PostgresStore) UpdateOrder(ctx context.Context, id int, order m.Order, changedBy string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println("❌ Error retrieving orders:", err)
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var orders []m.Order
-	for rows.Next() {
-		var order m.Order
-		err := rows.Scan(&order.ID, &order.Customer.ID, &order.Customer.Name, &order.Customer.Email, &order.Customer.Street, &order.Customer.City, &order.Customer.State, &order.Customer.PostalCode, &order.Customer.Country,
-			&order.TotalPrice, &order.Status, &order.CreatedAt)
-		if err != nil {
-			log.Println("❌ Error scanning order:", err)
-			return nil, err
+	var from string
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT status, version FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&from, &version)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.FromContext(ctx).Error("error locking order", "err", err)
 		}
+		return err
+	}
+	if order.Version != 0 && order.Version != version {
+		return ErrVersionMismatch
+	}
 
-		// Fetch Books for this Order
-		itemQuery := `SELECT b.id, b.title, b.published_at, b.price, b.stock, a.id, a.first_name, a.last_name, oi.quantity
-		              FROM order_items oi
-		              JOIN books b ON oi.book_id = b.id
-		              JOIN authors a ON b.author_id = a.id
-		              WHERE oi.order_id = $1`
-		itemRows, err := s.DB.Query(itemQuery, order.ID)
-		if err != nil {
-			log.Println("❌ Error retrieving order items:", err)
-			return nil, err
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET customer_id = $1 WHERE id = $2`, order.Customer.ID, id); err != nil {
+		logging.FromContext(ctx).Error("error updating order", "err", err)
+		return err
+	}
+	to := NormalizeOrderStatus(order.Status)
+	if to != "" && to != from {
+		if err := applyTransition(ctx, tx, id, from, to, changedBy); err != nil {
+			return err
 		}
+	}
 
-		var items []m.OrderItem
-		for itemRows.Next() {
-			var item m.OrderItem
-			var author m.Author
-			err := itemRows.Scan(&item.Book.ID, &item.Book.Title, &item.Book.PublishedAt, &item.Book.Price, &item.Book.Stock,
-				&author.ID, &author.FirstName, &author.LastName, &item.Quantity)
-			if err != nil {
-				log.Println("❌ Error scanning order item:", err)
-				return nil, err
-			}
-			item.Book.Author = author
-			items = append(items, item)
-		}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if to != "" && to != from {
+		logging.FromContext(ctx).Info("order status changed", "order_id", id, "from", from, "to", to)
+	}
+	return nil
+}
 
-		itemRows.Close()
-		order.Items = items
-		orders = append(orders, order)
+func (s *PostgresStore) DeleteOrder(ctx context.Context, id int, version int) error {
+	query := "DELETE FROM orders WHERE id = $1 AND " + versionMatches(2)
+	res, err := s.DB.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
 	}
+	return expectVersion(ctx, s.DB, res, "orders", id)
+}
 
-	return orders, nil
+// GetAllOrders returns one page of orders with their items.
+func (s *PostgresStore) GetAllOrders(ctx context.Context, params m.ListParams) (m.Page[m.Order], error) {
+	return s.SearchOrders(ctx, m.SearchCriteriaOrders{}, params)
 }
 
-func (s *PostgresStore) SearchOrders(ctx context.Context, criteria m.SearchCriteriaOrders) ([]m.Order, error) {
+// SearchOrders returns one page of orders (with items) matching criteria. It
+// returns sql.ErrNoRows when criteria are given and nothing matches at all.
+func (s *PostgresStore) SearchOrders(ctx context.Context, criteria m.SearchCriteriaOrders, params m.ListParams) (m.Page[m.Order], error) {
+	page, err := orderKeyset.resolve(params)
+	if err != nil {
+		return m.Page[m.Order]{}, err
+	}
+
 	// Base query
-	query := `SELECT o.id, o.customer_id, c.name, c.email, c.street, c.city, c.state, c.postal_code, c.country, o.total_price, o.status, o.created_at
-	          FROM orders o
-	          JOIN customers c ON o.customer_id = c.id
-	          WHERE 1=1`
+	query := orderSelect + ` WHERE 1=1`
 	args := []interface{}{}
 	argCount := 1
 
 	// Add filters dynamically
+	if criteria.CustomerID != 0 {
+		query += ` AND o.customer_id = $` + strconv.Itoa(argCount)
+		args = append(args, criteria.CustomerID)
+		argCount++
+	}
+
 	if criteria.CustomerName != "" {
 		query += ` AND c.name ILIKE $` + strconv.Itoa(argCount)
 		args = append(args, "%"+criteria.CustomerName+"%")
@@ -203,38 +305,55 @@ func (s *PostgresStore) SearchOrders(ctx context.Context, criteria m.SearchCrite
 	}
 
 	if criteria.Status != "" {
-		query += ` AND o.status ILIKE $` + strconv.Itoa(argCount)
-		args = append(args, "%"+criteria.Status+"%")
+		query += ` AND o.status = $` + strconv.Itoa(argCount)
+		args = append(args, NormalizeOrderStatus(criteria.Status))
 		argCount++
 	}
 
+	after, afterArgs := page.where(argCount)
+	query += after + page.orderBy()
+	args = append(args, afterArgs...)
+
 	// Execute query
-	rows, err := s.DB.Query(query, args...)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		log.Println("❌ Error searching orders:", err)
-		return nil, err
+		logging.FromContext(ctx).Error("error searching orders", "err", err)
+		return m.Page[m.Order]{}, err
 	}
 	defer rows.Close()
 
 	// Collect results
 	var orders []m.Order
 	for rows.Next() {
-		var order m.Order
-		err := rows.Scan(&order.ID, &order.Customer.ID, &order.Customer.Name, &order.Customer.Email, &order.Customer.Street, &order.Customer.City, &order.Customer.State, &order.Customer.PostalCode, &order.Customer.Country,
-			&order.TotalPrice, &order.Status, &order.CreatedAt)
+		order, err := scanOrder(rows)
 		if err != nil {
-			log.Println("❌ Error scanning order:", err)
-			return nil, err
+			logging.FromContext(ctx).Error("error scanning order", "err", err)
+			return m.Page[m.Order]{}, err
 		}
 		orders = append(orders, order)
 	}
+	if err := rows.Err(); err != nil {
+		return m.Page[m.Order]{}, err
+	}
+	rows.Close()
 
 	// Check if no orders were found
-	if len(orders) == 0 {
-		log.Println("🔍 No matching orders found")
-		return nil, sql.ErrNoRows
+	if len(orders) == 0 && params.Cursor == "" && criteria != (m.SearchCriteriaOrders{}) {
+		logging.FromContext(ctx).Debug("no matching orders found")
+		return m.Page[m.Order]{}, sql.ErrNoRows
 	}
 
-	log.Println("✅ Orders search successful")
-	return orders, nil
+	result, err := page.page(orders)
+	if err != nil {
+		return m.Page[m.Order]{}, err
+	}
+
+	// Fetch Books for each Order on this page
+	for i := range result.Data {
+		result.Data[i].Items, err = s.getOrderItems(ctx, result.Data[i].ID)
+		if err != nil {
+			return m.Page[m.Order]{}, err
+		}
+	}
+	return result, nil
 }
@@ -2,7 +2,9 @@ package stores
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	m "project.com/myproject/models"
 )
@@ -42,3 +44,121 @@ func TestGetOrder_NotFound(t *testing.T) {
 		t.Fatalf("Expected error for non-existent order, got nil")
 	}
 }
+
+func TestCreateOrder_InsufficientStockRollsBack(t *testing.T) {
+	ctx := context.Background()
+
+	author, _ := store.CreateAuthor(ctx, m.Author{FirstName: "Stock", LastName: "Author"})
+	plenty, _ := store.CreateBook(ctx, m.Book{Title: "Plenty", Author: author, PublishedAt: time.Now(), Price: 5, Stock: 10})
+	scarce, _ := store.CreateBook(ctx, m.Book{Title: "Scarce", Author: author, PublishedAt: time.Now(), Price: 5, Stock: 1})
+
+	order := m.Order{
+		Customer:   m.Customer{ID: 1},
+		TotalPrice: 15,
+		Status:     "Pending",
+		Items: []m.OrderItem{
+			{Book: plenty, Quantity: 1},
+			{Book: scarce, Quantity: 2},
+		},
+	}
+
+	_, err := store.CreateOrder(ctx, order)
+	var stockErr *ErrInsufficientStock
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+	if len(stockErr.BookIDs) != 1 || stockErr.BookIDs[0] != scarce.ID {
+		t.Fatalf("Expected offending book %d, got %v", scarce.ID, stockErr.BookIDs)
+	}
+
+	// Stock of the other book must be untouched
+	fetched, err := store.GetBook(ctx, plenty.ID)
+	if err != nil {
+		t.Fatalf("Failed to get book: %v", err)
+	}
+	if fetched.Stock != 10 {
+		t.Fatalf("Expected stock 10 after rollback, got %d", fetched.Stock)
+	}
+}
+
+func TestTransitionOrder_CancelRestocks(t *testing.T) {
+	ctx := context.Background()
+
+	author, _ := store.CreateAuthor(ctx, m.Author{FirstName: "Cancel", LastName: "Author"})
+	book, _ := store.CreateBook(ctx, m.Book{Title: "Cancel Me", Author: author, PublishedAt: time.Now(), Price: 8, Stock: 5})
+
+	order, err := store.CreateOrder(ctx, m.Order{
+		Customer: m.Customer{ID: 1},
+		Items:    []m.OrderItem{{Book: book, Quantity: 3}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	if _, err := store.TransitionOrder(ctx, order.ID, m.OrderStatusShipped, "tester", 0); err == nil {
+		t.Fatalf("Expected pending -> shipped to be rejected")
+	}
+
+	cancelled, err := store.TransitionOrder(ctx, order.ID, m.OrderStatusCancelled, "tester", 0)
+	if err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+	if cancelled.Status != m.OrderStatusCancelled {
+		t.Fatalf("Expected status cancelled, got %s", cancelled.Status)
+	}
+
+	fetched, _ := store.GetBook(ctx, book.ID)
+	if fetched.Stock != 5 {
+		t.Fatalf("Expected stock restored to 5, got %d", fetched.Stock)
+	}
+
+	history, err := store.GetOrderStatusHistory(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("Failed to get order history: %v", err)
+	}
+	if len(history) != 2 || history[1].ToStatus != m.OrderStatusCancelled {
+		t.Fatalf("Expected pending then cancelled in history, got %+v", history)
+	}
+}
+
+func TestUpdateOrderItems_RebalancesStock(t *testing.T) {
+	ctx := context.Background()
+
+	author, _ := store.CreateAuthor(ctx, m.Author{FirstName: "Edit", LastName: "Author"})
+	first, _ := store.CreateBook(ctx, m.Book{Title: "First", Author: author, PublishedAt: time.Now(), Price: 10, Stock: 5})
+	second, _ := store.CreateBook(ctx, m.Book{Title: "Second", Author: author, PublishedAt: time.Now(), Price: 4, Stock: 5})
+
+	order, err := store.CreateOrder(ctx, m.Order{
+		Customer: m.Customer{ID: 1},
+		Items:    []m.OrderItem{{Book: first, Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	// Drop one copy of the first book and add three of the second
+	updated, err := store.UpdateOrderItems(ctx, order.ID, []m.OrderItem{
+		{Book: first, Quantity: 1},
+		{Book: second, Quantity: 3},
+	}, false, 0)
+	if err != nil {
+		t.Fatalf("Failed to update order items: %v", err)
+	}
+	if updated.TotalPrice != 22 {
+		t.Fatalf("Expected total 22, got %v", updated.TotalPrice)
+	}
+
+	fetchedFirst, _ := store.GetBook(ctx, first.ID)
+	fetchedSecond, _ := store.GetBook(ctx, second.ID)
+	if fetchedFirst.Stock != 4 || fetchedSecond.Stock != 2 {
+		t.Fatalf("Expected stock 4 and 2, got %d and %d", fetchedFirst.Stock, fetchedSecond.Stock)
+	}
+
+	if _, err := store.TransitionOrder(ctx, order.ID, m.OrderStatusPaid, "tester", 0); err != nil {
+		t.Fatalf("Failed to pay order: %v", err)
+	}
+	_, err = store.UpdateOrderItems(ctx, order.ID, []m.OrderItem{{Book: first, Quantity: 1}}, false, 0)
+	if err != ErrOrderNotPending {
+		t.Fatalf("Expected ErrOrderNotPending, got %v", err)
+	}
+}
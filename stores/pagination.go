@@ -0,0 +1,308 @@
+package stores
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"project.com/myproject/internal/apperr"
+	m "project.com/myproject/models"
+)
+
+var (
+	// ErrInvalidSort is returned when a sort field is not whitelisted for the resource.
+	ErrInvalidSort = apperr.BadRequest("invalid_sort", "Invalid sort field")
+	// ErrInvalidCursor is returned for malformed cursors or cursors issued for a different sort.
+	ErrInvalidCursor = apperr.BadRequest("invalid_cursor", "Invalid cursor")
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+type columnKind int
+
+const (
+	kindInt columnKind = iota
+	kindFloat
+	kindString
+	kindTime
+)
+
+// sortColumn is a whitelisted sort column: the SQL expression to order by and
+// how to read the same value from a loaded item when building the next cursor.
+type sortColumn[T any] struct {
+	expr  string
+	kind  columnKind
+	value func(T) interface{}
+}
+
+// keyset implements cursor (keyset) pagination over a set of sortable columns.
+// Every sort is made unique by appending "id" as a final tiebreaker.
+type keyset[T any] map[string]sortColumn[T]
+
+// pageQuery is a validated ListParams ready to be turned into SQL.
+type pageQuery[T any] struct {
+	fields []m.SortField
+	cols   []sortColumn[T]
+	after  []interface{} // sort values of the last item of the previous page
+	limit  int
+}
+
+// cursorPayload is the JSON encoded (then base64url encoded) in a cursor.
+type cursorPayload struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+func (k keyset[T]) resolve(params m.ListParams) (pageQuery[T], error) {
+	q := pageQuery[T]{limit: params.Limit}
+	if q.limit <= 0 {
+		q.limit = DefaultPageLimit
+	}
+	if q.limit > MaxPageLimit {
+		q.limit = MaxPageLimit
+	}
+
+	hasID := false
+	for _, field := range params.Sort {
+		col, ok := k[field.Column]
+		if !ok {
+			return pageQuery[T]{}, ErrInvalidSort
+		}
+		q.fields = append(q.fields, field)
+		q.cols = append(q.cols, col)
+		if field.Column == "id" {
+			hasID = true
+		}
+	}
+	if !hasID {
+		q.fields = append(q.fields, m.SortField{Column: "id"})
+		q.cols = append(q.cols, k["id"])
+	}
+
+	if params.Cursor == "" {
+		return q, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+	if err != nil {
+		return pageQuery[T]{}, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return pageQuery[T]{}, ErrInvalidCursor
+	}
+	if payload.Sort != sortKey(q.fields) || len(payload.Values) != len(q.cols) {
+		return pageQuery[T]{}, ErrInvalidCursor
+	}
+	for i, col := range q.cols {
+		value, err := decodeCursorValue(payload.Values[i], col.kind)
+		if err != nil {
+			return pageQuery[T]{}, ErrInvalidCursor
+		}
+		q.after = append(q.after, value)
+	}
+	return q, nil
+}
+
+// where returns the keyset predicate (prefixed with " AND ") for rows after
+// the cursor, with placeholders numbered from argCount.
+func (q pageQuery[T]) where(argCount int) (string, []interface{}) {
+	if q.after == nil {
+		return "", nil
+	}
+
+	// (a > $1) OR (a = $1 AND b < $2) OR (a = $1 AND b = $2 AND id > $3) ...
+	var ors []string
+	for i := range q.fields {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, q.cols[j].expr+" = $"+strconv.Itoa(argCount+j))
+		}
+		op := " > $"
+		if q.fields[i].Desc {
+			op = " < $"
+		}
+		ands = append(ands, q.cols[i].expr+op+strconv.Itoa(argCount+i))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return " AND (" + strings.Join(ors, " OR ") + ")", q.after
+}
+
+// orderBy returns the ORDER BY and LIMIT clauses. One extra row is fetched to
+// tell whether another page follows.
+func (q pageQuery[T]) orderBy() string {
+	var parts []string
+	for i, field := range q.fields {
+		part := q.cols[i].expr
+		if field.Desc {
+			part += " DESC"
+		}
+		parts = append(parts, part)
+	}
+	return " ORDER BY " + strings.Join(parts, ", ") + " LIMIT " + strconv.Itoa(q.limit+1)
+}
+
+// page trims the extra row fetched by orderBy and builds the next cursor.
+func (q pageQuery[T]) page(items []T) (m.Page[T], error) {
+	if items == nil {
+		items = []T{}
+	}
+	if len(items) <= q.limit {
+		return m.Page[T]{Data: items}, nil
+	}
+
+	items = items[:q.limit]
+	last := items[len(items)-1]
+	payload := cursorPayload{Sort: sortKey(q.fields)}
+	for _, col := range q.cols {
+		raw, err := json.Marshal(col.value(last))
+		if err != nil {
+			return m.Page[T]{}, err
+		}
+		payload.Values = append(payload.Values, raw)
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return m.Page[T]{}, err
+	}
+	return m.Page[T]{Data: items, NextCursor: base64.RawURLEncoding.EncodeToString(raw)}, nil
+}
+
+// pageOf sorts items in memory and returns the page after the cursor, so
+// MemoryStore pages exactly like the SQL queries built by where and orderBy.
+func (q pageQuery[T]) pageOf(items []T) (m.Page[T], error) {
+	sorted := make([]T, 0, len(items))
+	for _, item := range items {
+		if q.after == nil || q.compare(q.values(item), q.after) > 0 {
+			sorted = append(sorted, item)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return q.compare(q.values(sorted[i]), q.values(sorted[j])) < 0
+	})
+	if len(sorted) > q.limit+1 {
+		sorted = sorted[:q.limit+1]
+	}
+	return q.page(sorted)
+}
+
+func (q pageQuery[T]) values(item T) []interface{} {
+	values := make([]interface{}, len(q.cols))
+	for i, col := range q.cols {
+		values[i] = col.value(item)
+	}
+	return values
+}
+
+// compare orders two rows by their sort values, honouring descending fields.
+func (q pageQuery[T]) compare(a, b []interface{}) int {
+	for i, field := range q.fields {
+		c := compareValues(q.cols[i].kind, a[i], b[i])
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(kind columnKind, a, b interface{}) int {
+	switch kind {
+	case kindInt:
+		x, y := toInt64(a), toInt64(b)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case kindFloat:
+		x, y := a.(float64), b.(float64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case kindTime:
+		return a.(time.Time).Compare(b.(time.Time))
+	default:
+		return strings.Compare(a.(string), b.(string))
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	if i, ok := v.(int); ok {
+		return int64(i)
+	}
+	return v.(int64)
+}
+
+func sortKey(fields []m.SortField) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field.Column
+		if field.Desc {
+			parts[i] = "-" + field.Column
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeCursorValue(raw json.RawMessage, kind columnKind) (interface{}, error) {
+	switch kind {
+	case kindInt:
+		var v int64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case kindFloat:
+		var v float64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case kindTime:
+		var v time.Time
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	default:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
+}
+
+// Sortable columns per resource.
+
+var bookKeyset = keyset[m.Book]{
+	"id":           {"b.id", kindInt, func(b m.Book) interface{} { return b.ID }},
+	"title":        {"b.title", kindString, func(b m.Book) interface{} { return b.Title }},
+	"price":        {"b.price", kindFloat, func(b m.Book) interface{} { return b.Price }},
+	"stock":        {"b.stock", kindInt, func(b m.Book) interface{} { return b.Stock }},
+	"published_at": {"b.published_at", kindTime, func(b m.Book) interface{} { return b.PublishedAt }},
+}
+
+var authorKeyset = keyset[m.Author]{
+	"id":         {"id", kindInt, func(a m.Author) interface{} { return a.ID }},
+	"first_name": {"first_name", kindString, func(a m.Author) interface{} { return a.FirstName }},
+	"last_name":  {"last_name", kindString, func(a m.Author) interface{} { return a.LastName }},
+}
+
+var customerKeyset = keyset[m.Customer]{
+	"id":    {"id", kindInt, func(c m.Customer) interface{} { return c.ID }},
+	"name":  {"name", kindString, func(c m.Customer) interface{} { return c.Name }},
+	"email": {"email", kindString, func(c m.Customer) interface{} { return c.Email }},
+}
+
+var orderKeyset = keyset[m.Order]{
+	"id":          {"o.id", kindInt, func(o m.Order) interface{} { return o.ID }},
+	"created_at":  {"o.created_at", kindTime, func(o m.Order) interface{} { return o.CreatedAt }},
+	"total_price": {"o.total_price", kindFloat, func(o m.Order) interface{} { return o.TotalPrice }},
+	"status":      {"o.status", kindString, func(o m.Order) interface{} { return o.Status }},
+}
@@ -0,0 +1,80 @@
+package stores
+
+import (
+	"testing"
+
+	m "project.com/myproject/models"
+)
+
+func TestKeyset_CursorRoundTrip(t *testing.T) {
+	params := m.ListParams{Limit: 2, Sort: []m.SortField{{Column: "price"}, {Column: "title", Desc: true}}}
+	first, err := bookKeyset.resolve(params)
+	if err != nil {
+		t.Fatalf("Failed to resolve params: %v", err)
+	}
+	if got := first.orderBy(); got != " ORDER BY b.price, b.title DESC, b.id LIMIT 3" {
+		t.Fatalf("Unexpected ORDER BY: %q", got)
+	}
+
+	books := []m.Book{{ID: 4, Title: "B", Price: 5}, {ID: 2, Title: "A", Price: 5}, {ID: 9, Title: "C", Price: 7}}
+	page, err := first.page(books)
+	if err != nil {
+		t.Fatalf("Failed to build page: %v", err)
+	}
+	if len(page.Data) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected 2 books and a next cursor, got %d and %q", len(page.Data), page.NextCursor)
+	}
+
+	params.Cursor = page.NextCursor
+	next, err := bookKeyset.resolve(params)
+	if err != nil {
+		t.Fatalf("Failed to resolve cursor: %v", err)
+	}
+	where, args := next.where(3)
+	expected := " AND ((b.price > $3) OR (b.price = $3 AND b.title < $4) OR (b.price = $3 AND b.title = $4 AND b.id > $5))"
+	if where != expected {
+		t.Fatalf("Unexpected keyset predicate: %q", where)
+	}
+	if len(args) != 3 || args[0] != float64(5) || args[1] != "A" || args[2] != int64(2) {
+		t.Fatalf("Unexpected cursor values: %v", args)
+	}
+}
+
+func TestKeyset_LastPageHasNoCursor(t *testing.T) {
+	q, _ := authorKeyset.resolve(m.ListParams{Limit: 2})
+	page, err := q.page([]m.Author{{ID: 1}, {ID: 2}})
+	if err != nil {
+		t.Fatalf("Failed to build page: %v", err)
+	}
+	if page.NextCursor != "" {
+		t.Fatalf("Expected no next cursor, got %q", page.NextCursor)
+	}
+}
+
+func TestKeyset_Rejects(t *testing.T) {
+	if _, err := bookKeyset.resolve(m.ListParams{Sort: []m.SortField{{Column: "genres"}}}); err != ErrInvalidSort {
+		t.Fatalf("Expected ErrInvalidSort, got %v", err)
+	}
+	if _, err := bookKeyset.resolve(m.ListParams{Cursor: "not a cursor"}); err != ErrInvalidCursor {
+		t.Fatalf("Expected ErrInvalidCursor, got %v", err)
+	}
+
+	// A cursor is only valid for the sort it was issued for
+	q, _ := bookKeyset.resolve(m.ListParams{Limit: 1})
+	page, _ := q.page([]m.Book{{ID: 1}, {ID: 2}})
+	_, err := bookKeyset.resolve(m.ListParams{Cursor: page.NextCursor, Sort: []m.SortField{{Column: "price"}}})
+	if err != ErrInvalidCursor {
+		t.Fatalf("Expected ErrInvalidCursor for a different sort, got %v", err)
+	}
+}
+
+func TestDefaultLimitIsCapped(t *testing.T) {
+	q, _ := customerKeyset.resolve(m.ListParams{Limit: 10000})
+	if q.limit != MaxPageLimit {
+		t.Fatalf("Expected limit %d, got %d", MaxPageLimit, q.limit)
+	}
+	q, _ = customerKeyset.resolve(m.ListParams{})
+	if q.limit != DefaultPageLimit {
+		t.Fatalf("Expected limit %d, got %d", DefaultPageLimit, q.limit)
+	}
+}
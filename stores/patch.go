@@ -0,0 +1,37 @@
+package stores
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// assignments collects the SET clause of a partial UPDATE, one column per
+// field present in a patch.
+type assignments struct {
+	columns []string
+	args    []any
+}
+
+func (a *assignments) set(column string, value any) {
+	a.args = append(a.args, value)
+	a.columns = append(a.columns, column+" = $"+strconv.Itoa(len(a.args)))
+}
+
+// exec updates the row of table with the given id and version, returning
+// sql.ErrNoRows if there is none. An empty patch still checks that the row
+// exists and bumps its version.
+func (a *assignments) exec(ctx context.Context, db querier, table string, id, version int) error {
+	columns := a.columns
+	if len(columns) == 0 {
+		columns = []string{"id = id"}
+	}
+	args := append(a.args, id, version)
+	query := "UPDATE " + table + " SET " + strings.Join(columns, ", ") +
+		" WHERE id = $" + strconv.Itoa(len(args)-1) + " AND " + versionMatches(len(args))
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return expectVersion(ctx, db, res, table, id)
+}
@@ -0,0 +1,54 @@
+package stores
+
+import (
+	"math"
+
+	m "project.com/myproject/models"
+)
+
+// PricingPolicy computes order totals server-side from snapshotted unit prices.
+// All arithmetic is done in whole cents to avoid floating point drift.
+type PricingPolicy struct {
+	TaxRate float64 // e.g. 0.08 for 8%, applied after discounts
+
+	// Orders with at least BulkDiscountQuantity books get BulkDiscountRate off
+	// the subtotal. A zero quantity disables the discount.
+	BulkDiscountQuantity int
+	BulkDiscountRate     float64
+}
+
+// DefaultPricingPolicy charges list price with no discount or tax.
+var DefaultPricingPolicy = PricingPolicy{}
+
+// Price fills in each item's line total and the order's subtotal, discount,
+// tax and total. Items must already carry their UnitPrice.
+func (p PricingPolicy) Price(order *m.Order) {
+	var subtotal int64
+	var quantity int
+	for i := range order.Items {
+		item := &order.Items[i]
+		line := toCents(item.UnitPrice) * int64(item.Quantity)
+		item.LineTotal = fromCents(line)
+		subtotal += line
+		quantity += item.Quantity
+	}
+
+	var discount int64
+	if p.BulkDiscountQuantity > 0 && quantity >= p.BulkDiscountQuantity {
+		discount = int64(math.Round(float64(subtotal) * p.BulkDiscountRate))
+	}
+	tax := int64(math.Round(float64(subtotal-discount) * p.TaxRate))
+
+	order.Subtotal = fromCents(subtotal)
+	order.Discount = fromCents(discount)
+	order.Tax = fromCents(tax)
+	order.TotalPrice = fromCents(subtotal - discount + tax)
+}
+
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
@@ -0,0 +1,45 @@
+package stores
+
+import (
+	"testing"
+
+	m "project.com/myproject/models"
+)
+
+func TestPricingPolicy_Price(t *testing.T) {
+	policy := PricingPolicy{TaxRate: 0.1, BulkDiscountQuantity: 3, BulkDiscountRate: 0.05}
+
+	order := m.Order{
+		TotalPrice: 0.01, // client-supplied totals are overwritten
+		Items: []m.OrderItem{
+			{Book: m.Book{ID: 1}, Quantity: 2, UnitPrice: 10.99},
+			{Book: m.Book{ID: 2}, Quantity: 1, UnitPrice: 5.10},
+		},
+	}
+	policy.Price(&order)
+
+	if order.Items[0].LineTotal != 21.98 {
+		t.Fatalf("Expected line total 21.98, got %v", order.Items[0].LineTotal)
+	}
+	if order.Subtotal != 27.08 {
+		t.Fatalf("Expected subtotal 27.08, got %v", order.Subtotal)
+	}
+	if order.Discount != 1.35 {
+		t.Fatalf("Expected discount 1.35, got %v", order.Discount)
+	}
+	if order.Tax != 2.57 {
+		t.Fatalf("Expected tax 2.57, got %v", order.Tax)
+	}
+	if order.TotalPrice != 28.30 {
+		t.Fatalf("Expected total 28.30, got %v", order.TotalPrice)
+	}
+}
+
+func TestPricingPolicy_NoDiscountBelowThreshold(t *testing.T) {
+	order := m.Order{Items: []m.OrderItem{{Quantity: 1, UnitPrice: 12.99}}}
+	DefaultPricingPolicy.Price(&order)
+
+	if order.Discount != 0 || order.Tax != 0 || order.TotalPrice != 12.99 {
+		t.Fatalf("Expected list price 12.99 with no discount or tax, got %+v", order)
+	}
+}
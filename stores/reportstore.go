@@ -155,9 +155,9 @@ package stores
 import (
 	"context"
 	"database/sql"
-	"log"
 	"time"
 
+	"project.com/myproject/internal/logging"
 	m "project.com/myproject/models"
 )
 
@@ -188,7 +188,7 @@ func (rs *PostgresStore) buildSalesReport(ctx context.Context, startDate, endDat
 	for rows.Next() {
 		var price float64
 		if err := rows.Scan(&price); err != nil {
-			log.Println("Error scanning order total price:", err)
+			logging.FromContext(ctx).Error("error scanning order total price", "err", err)
 			return m.SalesReport{}, err
 		}
 		totalRevenue += price
@@ -221,7 +221,7 @@ func (rs *PostgresStore) buildSalesReport(ctx context.Context, startDate, endDat
 		var stock int
 		var quantity int
 		if err := rowsTop.Scan(&bookID, &title, &publishedAt, &price, &stock, &quantity); err != nil {
-			log.Println("Error scanning top selling book:", err)
+			logging.FromContext(ctx).Error("error scanning top selling book", "err", err)
 			return m.SalesReport{}, err
 		}
 		book := m.Book{
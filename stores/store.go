@@ -0,0 +1,105 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	m "project.com/myproject/models"
+)
+
+// Updates and deletes of books, authors, customers and orders fail with
+// ErrVersionMismatch when given a non-zero version the record no longer has.
+
+// BookStore persists books and their genres.
+type BookStore interface {
+	CreateBook(ctx context.Context, book m.Book) (m.Book, error)
+	GetBook(ctx context.Context, id int) (m.Book, error)
+	GetAllBooks(ctx context.Context, params m.ListParams) (m.Page[m.Book], error)
+	UpdateBook(ctx context.Context, id int, book m.Book) error
+	PatchBook(ctx context.Context, id int, patch m.BookPatch) error
+	DeleteBook(ctx context.Context, id int, version int) error
+	SearchBooks(ctx context.Context, criteria m.SearchCriteriaBooks, params m.ListParams) (m.Page[m.Book], error)
+}
+
+// AuthorStore persists authors.
+type AuthorStore interface {
+	CreateAuthor(ctx context.Context, author m.Author) (m.Author, error)
+	GetAuthor(ctx context.Context, id int) (m.Author, error)
+	GetAllAuthors(ctx context.Context, params m.ListParams) (m.Page[m.Author], error)
+	UpdateAuthor(ctx context.Context, id int, author m.Author) error
+	PatchAuthor(ctx context.Context, id int, patch m.AuthorPatch) error
+	DeleteAuthor(ctx context.Context, id int, version int) error
+	SearchAuthors(ctx context.Context, criteria m.SearchCriteriaAuthors, params m.ListParams) (m.Page[m.Author], error)
+}
+
+// CustomerStore persists customers.
+type CustomerStore interface {
+	CreateCustomer(ctx context.Context, customer m.Customer) (m.Customer, error)
+	GetCustomer(ctx context.Context, id int) (m.Customer, error)
+	GetAllCustomers(ctx context.Context, params m.ListParams) (m.Page[m.Customer], error)
+	UpdateCustomer(ctx context.Context, id int, customer m.Customer) error
+	PatchCustomer(ctx context.Context, id int, patch m.CustomerPatch) error
+	DeleteCustomer(ctx context.Context, id int, version int) error
+	SearchCustomers(ctx context.Context, criteria m.SearchCriteriaCustomers, params m.ListParams) (m.Page[m.Customer], error)
+}
+
+// OrderStore persists orders, their items and their status history.
+type OrderStore interface {
+	CreateOrder(ctx context.Context, order m.Order) (m.Order, error)
+	GetOrder(ctx context.Context, id int) (m.Order, error)
+	GetAllOrders(ctx context.Context, params m.ListParams) (m.Page[m.Order], error)
+	UpdateOrder(ctx context.Context, id int, order m.Order, changedBy string) error
+	DeleteOrder(ctx context.Context, id int, version int) error
+	SearchOrders(ctx context.Context, criteria m.SearchCriteriaOrders, params m.ListParams) (m.Page[m.Order], error)
+	UpdateOrderItems(ctx context.Context, id int, items []m.OrderItem, merge bool, version int) (m.Order, error)
+	TransitionOrder(ctx context.Context, id int, to string, changedBy string, version int) (m.Order, error)
+	GetOrderStatusHistory(ctx context.Context, id int) ([]m.OrderStatusChange, error)
+}
+
+// ReportStore builds sales reports.
+type ReportStore interface {
+	GetSalesReport(ctx context.Context, startDate, endDate time.Time) (m.SalesReport, error)
+}
+
+// UserStore persists user accounts.
+type UserStore interface {
+	CreateUser(ctx context.Context, user m.User) (m.User, error)
+	GetUser(ctx context.Context, id int) (m.User, error)
+	GetUserByUsername(ctx context.Context, username string) (m.User, error)
+	UpdateUser(ctx context.Context, id int, user m.User) error
+	UpdateUserPassword(ctx context.Context, id int, passwordHash string) error
+	SetUserRoles(ctx context.Context, id int, roles []string, customerID int) error
+	DisableUser(ctx context.Context, id int) error
+}
+
+// TokenStore persists refresh tokens.
+type TokenStore interface {
+	CreateRefreshToken(ctx context.Context, token m.RefreshToken) (m.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldHash string, next m.RefreshToken) (m.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+}
+
+// Store is everything the API handlers need.
+type Store interface {
+	BookStore
+	AuthorStore
+	CustomerStore
+	OrderStore
+	ReportStore
+}
+
+// AuthStore is everything the authentication handlers need.
+type AuthStore interface {
+	UserStore
+	TokenStore
+}
+
+var (
+	_ Store     = (*PostgresStore)(nil)
+	_ AuthStore = (*PostgresStore)(nil)
+	_ Store     = (*MemoryStore)(nil)
+	_ AuthStore = (*MemoryStore)(nil)
+	_ Store     = (*InvalidatingStore)(nil)
+	_ Store     = (*TracingStore)(nil)
+	_ AuthStore = (*TracingAuthStore)(nil)
+)
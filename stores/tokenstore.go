@@ -0,0 +1,116 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"project.com/myproject/internal/logging"
+	m "project.com/myproject/models"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown or expired refresh tokens.
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	// ErrRefreshTokenReused is returned when an already-rotated token is presented
+	// again; the whole token family is revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// ✅ Persist a new refresh token (hash only)
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, token m.RefreshToken) (m.RefreshToken, error) {
+	query := `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at)
+	          VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+	err := s.DB.QueryRowContext(ctx, query, token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("error inserting refresh token", "err", err)
+		return m.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// ✅ Rotate a refresh token: mark the presented one used and store its
+// replacement in the same family. Presenting a token that was already used or
+// revoked revokes the entire family and returns ErrRefreshTokenReused.
+func (s *PostgresStore) RotateRefreshToken(ctx context.Context, oldHash string, next m.RefreshToken) (m.RefreshToken, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return m.RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	var current m.RefreshToken
+	query := `SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+	          FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, oldHash).Scan(
+		&current.ID, &current.UserID, &current.FamilyID, &current.ExpiresAt, &current.UsedAt, &current.RevokedAt)
+	if err == sql.ErrNoRows {
+		return m.RefreshToken{}, ErrRefreshTokenInvalid
+	} else if err != nil {
+		logging.FromContext(ctx).Error("error retrieving refresh token", "err", err)
+		return m.RefreshToken{}, err
+	}
+
+	if current.UsedAt != nil || current.RevokedAt != nil {
+		logging.FromContext(ctx).Warn("refresh token reuse detected, revoking family", "family_id", current.FamilyID)
+		if err := revokeFamily(ctx, tx, current.FamilyID); err != nil {
+			return m.RefreshToken{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return m.RefreshToken{}, err
+		}
+		return m.RefreshToken{}, ErrRefreshTokenReused
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return m.RefreshToken{}, ErrRefreshTokenInvalid
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`, current.ID)
+	if err != nil {
+		logging.FromContext(ctx).Error("error marking refresh token used", "err", err)
+		return m.RefreshToken{}, err
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	err = tx.QueryRowContext(ctx, `INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at)
+	          VALUES ($1, $2, $3, $4) RETURNING id, created_at`,
+		next.UserID, next.TokenHash, next.FamilyID, next.ExpiresAt).Scan(&next.ID, &next.CreatedAt)
+	if err != nil {
+		logging.FromContext(ctx).Error("error inserting rotated refresh token", "err", err)
+		return m.RefreshToken{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return m.RefreshToken{}, err
+	}
+	return next, nil
+}
+
+// ✅ Revoke every token in the family of the given refresh token (logout)
+func (s *PostgresStore) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	var familyID string
+	err := s.DB.QueryRowContext(ctx, `SELECT family_id FROM refresh_tokens WHERE token_hash = $1`, tokenHash).Scan(&familyID)
+	if err == sql.ErrNoRows {
+		return ErrRefreshTokenInvalid
+	} else if err != nil {
+		logging.FromContext(ctx).Error("error retrieving refresh token", "err", err)
+		return err
+	}
+	return revokeFamily(ctx, s.DB, familyID)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func revokeFamily(ctx context.Context, db execer, familyID string) error {
+	_, err := db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+	          WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	if err != nil {
+		logging.FromContext(ctx).Error("error revoking refresh token family", "err", err)
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package stores
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	m "project.com/myproject/models"
+)
+
+func TestRotateRefreshToken_ReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+
+	user, err := store.CreateUser(ctx, m.User{
+		Username:     "refresh_user",
+		Email:        "refresh_user@example.com",
+		PasswordHash: "$2a$12$placeholderplaceholderplaceholderplaceholderplace",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	first, err := store.CreateRefreshToken(ctx, m.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: "1111111111111111111111111111111111111111111111111111111111111111",
+		FamilyID:  "test-family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create refresh token: %v", err)
+	}
+
+	second, err := store.RotateRefreshToken(ctx, first.TokenHash, m.RefreshToken{
+		TokenHash: "2222222222222222222222222222222222222222222222222222222222222222",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to rotate refresh token: %v", err)
+	}
+
+	// Presenting the first token again must revoke the whole family
+	_, err = store.RotateRefreshToken(ctx, first.TokenHash, m.RefreshToken{
+		TokenHash: "3333333333333333333333333333333333333333333333333333333333333333",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != ErrRefreshTokenReused {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	_, err = store.RotateRefreshToken(ctx, second.TokenHash, m.RefreshToken{
+		TokenHash: "4444444444444444444444444444444444444444444444444444444444444444",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != ErrRefreshTokenReused {
+		t.Fatalf("Expected revoked sibling token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/tracing"
+	m "project.com/myproject/models"
+)
+
+// TracingStore wraps a Store and records a span for every method, so a trace
+// shows which store calls a request made; the SQL statements appear as child
+// spans when the database is opened with otelsql.
+type TracingStore struct {
+	Store
+}
+
+func NewTracingStore(store Store) *TracingStore {
+	return &TracingStore{Store: store}
+}
+
+// TracingAuthStore is TracingStore for the authentication stores.
+type TracingAuthStore struct {
+	AuthStore
+}
+
+func NewTracingAuthStore(store AuthStore) *TracingAuthStore {
+	return &TracingAuthStore{AuthStore: store}
+}
+
+var tracer = otel.Tracer("project.com/myproject/stores")
+
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "stores."+method, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, marking it failed unless err is an expected outcome such
+// as a missing row or a rejected request.
+func endSpan(span trace.Span, err error) {
+	// Domain errors are answered with a 4xx, not failures of the store
+	var domain *apperr.Error
+	var coder apperr.Coder
+	if errors.As(err, &domain) || errors.As(err, &coder) {
+		err = nil
+	}
+	tracing.End(span, err, sql.ErrNoRows, ErrRefreshTokenInvalid, ErrRefreshTokenReused)
+}
+
+func listAttrs(params m.ListParams) []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.Int("page.limit", params.Limit), attribute.Bool("page.cursor", params.Cursor != "")}
+}
+
+// Books
+
+func (s *TracingStore) CreateBook(ctx context.Context, book m.Book) (_ m.Book, err error) {
+	ctx, span := startSpan(ctx, "CreateBook")
+	defer func() { endSpan(span, err) }()
+	return s.Store.CreateBook(ctx, book)
+}
+
+func (s *TracingStore) GetBook(ctx context.Context, id int) (_ m.Book, err error) {
+	ctx, span := startSpan(ctx, "GetBook", attribute.Int("book.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetBook(ctx, id)
+}
+
+func (s *TracingStore) GetAllBooks(ctx context.Context, params m.ListParams) (_ m.Page[m.Book], err error) {
+	ctx, span := startSpan(ctx, "GetAllBooks", listAttrs(params)...)
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetAllBooks(ctx, params)
+}
+
+func (s *TracingStore) UpdateBook(ctx context.Context, id int, book m.Book) (err error) {
+	ctx, span := startSpan(ctx, "UpdateBook", attribute.Int("book.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.UpdateBook(ctx, id, book)
+}
+
+func (s *TracingStore) PatchBook(ctx context.Context, id int, patch m.BookPatch) (err error) {
+	ctx, span := startSpan(ctx, "PatchBook", attribute.Int("book.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.PatchBook(ctx, id, patch)
+}
+
+func (s *TracingStore) DeleteBook(ctx context.Context, id int, version int) (err error) {
+	ctx, span := startSpan(ctx, "DeleteBook", attribute.Int("book.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.DeleteBook(ctx, id, version)
+}
+
+func (s *TracingStore) SearchBooks(ctx context.Context, criteria m.SearchCriteriaBooks, params m.ListParams) (_ m.Page[m.Book], err error) {
+	ctx, span := startSpan(ctx, "SearchBooks", listAttrs(params)...)
+	defer func() { endSpan(span, err) }()
+	return s.Store.SearchBooks(ctx, criteria, params)
+}
+
+// Authors
+
+func (s *TracingStore) CreateAuthor(ctx context.Context, author m.Author) (_ m.Author, err error) {
+	ctx, span := startSpan(ctx, "CreateAuthor")
+	defer func() { endSpan(span, err) }()
+	return s.Store.CreateAuthor(ctx, author)
+}
+
+func (s *TracingStore) GetAuthor(ctx context.Context, id int) (_ m.Author, err error) {
+	ctx, span := startSpan(ctx, "GetAuthor", attribute.Int("author.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetAuthor(ctx, id)
+}
+
+func (s *TracingStore) GetAllAuthors(ctx context.Context, params m.ListParams) (_ m.Page[m.Author], err error) {
+	ctx, span := startSpan(ctx, "GetAllAuthors", listAttrs(params)...)
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetAllAuthors(ctx, params)
+}
+
+func (s *TracingStore) UpdateAuthor(ctx context.Context, id int, author m.Author) (err error) {
+	ctx, span := startSpan(ctx, "UpdateAuthor", attribute.Int("author.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.UpdateAuthor(ctx, id, author)
+}
+
+func (s *TracingStore) PatchAuthor(ctx context.Context, id int, patch m.AuthorPatch) (err error) {
+	ctx, span := startSpan(ctx, "PatchAuthor", attribute.Int("author.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.PatchAuthor(ctx, id, patch)
+}
+
+func (s *TracingStore) DeleteAuthor(ctx context.Context, id int, version int) (err error) {
+	ctx, span := startSpan(ctx, "DeleteAuthor", attribute.Int("author.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.DeleteAuthor(ctx, id, version)
+}
+
+func (s *TracingStore) SearchAuthors(ctx context.Context, criteria m.SearchCriteriaAuthors, params m.ListParams) (_ m.Page[m.Author], err error) {
+	ctx, span := startSpan(ctx, "SearchAuthors", listAttrs(params)...)
+	defer func() { endSpan(span, err) }()
+	return s.Store.SearchAuthors(ctx, criteria, params)
+}
+
+// Customers
+
+func (s *TracingStore) CreateCustomer(ctx context.Context, customer m.Customer) (_ m.Customer, err error) {
+	ctx, span := startSpan(ctx, "CreateCustomer")
+	defer func() { endSpan(span, err) }()
+	return s.Store.CreateCustomer(ctx, customer)
+}
+
+func (s *TracingStore) GetCustomer(ctx context.Context, id int) (_ m.Customer, err error) {
+	ctx, span := startSpan(ctx, "GetCustomer", attribute.Int("customer.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetCustomer(ctx, id)
+}
+
+func (s *TracingStore) GetAllCustomers(ctx context.Context, params m.ListParams) (_ m.Page[m.Customer], err error) {
+	ctx, span := startSpan(ctx, "GetAllCustomers", listAttrs(params)...)
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetAllCustomers(ctx, params)
+}
+
+func (s *TracingStore) UpdateCustomer(ctx context.Context, id int, customer m.Customer) (err error) {
+	ctx, span := startSpan(ctx, "UpdateCustomer", attribute.Int("customer.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.UpdateCustomer(ctx, id, customer)
+}
+
+func (s *TracingStore) PatchCustomer(ctx context.Context, id int, patch m.CustomerPatch) (err error) {
+	ctx, span := startSpan(ctx, "PatchCustomer", attribute.Int("customer.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.PatchCustomer(ctx, id, patch)
+}
+
+func (s *TracingStore) DeleteCustomer(ctx context.Context, id int, version int) (err error) {
+	ctx, span := startSpan(ctx, "DeleteCustomer", attribute.Int("customer.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.DeleteCustomer(ctx, id, version)
+}
+
+func (s *TracingStore) SearchCustomers(ctx context.Context, criteria m.SearchCriteriaCustomers, params m.ListParams) (_ m.Page[m.Customer], err error) {
+	ctx, span := startSpan(ctx, "SearchCustomers", listAttrs(params)...)
+	defer func() { endSpan(span, err) }()
+	return s.Store.SearchCustomers(ctx, criteria, params)
+}
+
+// Orders
+
+func (s *TracingStore) CreateOrder(ctx context.Context, order m.Order) (_ m.Order, err error) {
+	ctx, span := startSpan(ctx, "CreateOrder", attribute.Int("order.items", len(order.Items)))
+	defer func() { endSpan(span, err) }()
+	return s.Store.CreateOrder(ctx, order)
+}
+
+func (s *TracingStore) GetOrder(ctx context.Context, id int) (_ m.Order, err error) {
+	ctx, span := startSpan(ctx, "GetOrder", attribute.Int("order.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetOrder(ctx, id)
+}
+
+func (s *TracingStore) GetAllOrders(ctx context.Context, params m.ListParams) (_ m.Page[m.Order], err error) {
+	ctx, span := startSpan(ctx, "GetAllOrders", listAttrs(params)...)
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetAllOrders(ctx, params)
+}
+
+func (s *TracingStore) UpdateOrder(ctx context.Context, id int, order m.Order, changedBy string) (err error) {
+	ctx, span := startSpan(ctx, "UpdateOrder", attribute.Int("order.id", id), attribute.String("order.status", order.Status))
+	defer func() { endSpan(span, err) }()
+	return s.Store.UpdateOrder(ctx, id, order, changedBy)
+}
+
+func (s *TracingStore) DeleteOrder(ctx context.Context, id int, version int) (err error) {
+	ctx, span := startSpan(ctx, "DeleteOrder", attribute.Int("order.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.DeleteOrder(ctx, id, version)
+}
+
+func (s *TracingStore) SearchOrders(ctx context.Context, criteria m.SearchCriteriaOrders, params m.ListParams) (_ m.Page[m.Order], err error) {
+	ctx, span := startSpan(ctx, "SearchOrders", listAttrs(params)...)
+	defer func() { endSpan(span, err) }()
+	return s.Store.SearchOrders(ctx, criteria, params)
+}
+
+func (s *TracingStore) UpdateOrderItems(ctx context.Context, id int, items []m.OrderItem, merge bool, version int) (_ m.Order, err error) {
+	ctx, span := startSpan(ctx, "UpdateOrderItems", attribute.Int("order.id", id), attribute.Int("order.items", len(items)), attribute.Bool("order.merge", merge))
+	defer func() { endSpan(span, err) }()
+	return s.Store.UpdateOrderItems(ctx, id, items, merge, version)
+}
+
+func (s *TracingStore) TransitionOrder(ctx context.Context, id int, to string, changedBy string, version int) (_ m.Order, err error) {
+	ctx, span := startSpan(ctx, "TransitionOrder", attribute.Int("order.id", id), attribute.String("order.status", to))
+	defer func() { endSpan(span, err) }()
+	return s.Store.TransitionOrder(ctx, id, to, changedBy, version)
+}
+
+func (s *TracingStore) GetOrderStatusHistory(ctx context.Context, id int) (_ []m.OrderStatusChange, err error) {
+	ctx, span := startSpan(ctx, "GetOrderStatusHistory", attribute.Int("order.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetOrderStatusHistory(ctx, id)
+}
+
+// Reports
+
+func (s *TracingStore) GetSalesReport(ctx context.Context, startDate, endDate time.Time) (_ m.SalesReport, err error) {
+	ctx, span := startSpan(ctx, "GetSalesReport", attribute.String("report.start", startDate.Format(time.RFC3339)), attribute.String("report.end", endDate.Format(time.RFC3339)))
+	defer func() { endSpan(span, err) }()
+	return s.Store.GetSalesReport(ctx, startDate, endDate)
+}
+
+// Users
+
+func (s *TracingAuthStore) CreateUser(ctx context.Context, user m.User) (_ m.User, err error) {
+	ctx, span := startSpan(ctx, "CreateUser")
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.CreateUser(ctx, user)
+}
+
+func (s *TracingAuthStore) GetUser(ctx context.Context, id int) (_ m.User, err error) {
+	ctx, span := startSpan(ctx, "GetUser", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.GetUser(ctx, id)
+}
+
+func (s *TracingAuthStore) GetUserByUsername(ctx context.Context, username string) (_ m.User, err error) {
+	ctx, span := startSpan(ctx, "GetUserByUsername")
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.GetUserByUsername(ctx, username)
+}
+
+func (s *TracingAuthStore) UpdateUser(ctx context.Context, id int, user m.User) (err error) {
+	ctx, span := startSpan(ctx, "UpdateUser", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.UpdateUser(ctx, id, user)
+}
+
+func (s *TracingAuthStore) UpdateUserPassword(ctx context.Context, id int, passwordHash string) (err error) {
+	ctx, span := startSpan(ctx, "UpdateUserPassword", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.UpdateUserPassword(ctx, id, passwordHash)
+}
+
+func (s *TracingAuthStore) SetUserRoles(ctx context.Context, id int, roles []string, customerID int) (err error) {
+	ctx, span := startSpan(ctx, "SetUserRoles", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.SetUserRoles(ctx, id, roles, customerID)
+}
+
+func (s *TracingAuthStore) DisableUser(ctx context.Context, id int) (err error) {
+	ctx, span := startSpan(ctx, "DisableUser", attribute.Int("user.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.DisableUser(ctx, id)
+}
+
+// Refresh tokens
+
+func (s *TracingAuthStore) CreateRefreshToken(ctx context.Context, token m.RefreshToken) (_ m.RefreshToken, err error) {
+	ctx, span := startSpan(ctx, "CreateRefreshToken", attribute.Int("user.id", token.UserID))
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.CreateRefreshToken(ctx, token)
+}
+
+func (s *TracingAuthStore) RotateRefreshToken(ctx context.Context, oldHash string, next m.RefreshToken) (_ m.RefreshToken, err error) {
+	ctx, span := startSpan(ctx, "RotateRefreshToken", attribute.Int("user.id", next.UserID))
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.RotateRefreshToken(ctx, oldHash, next)
+}
+
+func (s *TracingAuthStore) RevokeRefreshToken(ctx context.Context, tokenHash string) (err error) {
+	ctx, span := startSpan(ctx, "RevokeRefreshToken")
+	defer func() { endSpan(span, err) }()
+	return s.AuthStore.RevokeRefreshToken(ctx, tokenHash)
+}
@@ -0,0 +1,146 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/lib/pq"
+	"project.com/myproject/internal/apperr"
+	"project.com/myproject/internal/logging"
+	m "project.com/myproject/models"
+)
+
+// ErrUserExists is returned when the username or email is already taken.
+var ErrUserExists = apperr.Conflict("user_exists", "User already exists")
+
+// DefaultUserRole is assigned to users created without explicit roles.
+const DefaultUserRole = "customer"
+
+// NormalizeUsername trims and lower-cases a username so lookups are case-insensitive.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// NormalizeEmail trims and lower-cases an email address.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ✅ Create a User (username and email must be unique)
+func (s *PostgresStore) CreateUser(ctx context.Context, user m.User) (m.User, error) {
+	user.Username = NormalizeUsername(user.Username)
+	user.Email = NormalizeEmail(user.Email)
+
+	if len(user.Roles) == 0 {
+		user.Roles = []string{DefaultUserRole}
+	}
+
+	query := `INSERT INTO users (username, email, password_hash, roles, customer_id)
+	          VALUES ($1, $2, $3, $4, $5) RETURNING id, disabled, created_at, updated_at`
+	err := s.DB.QueryRowContext(ctx, query, user.Username, user.Email, user.PasswordHash,
+		pq.StringArray(user.Roles), nullableID(user.CustomerID)).
+		Scan(&user.ID, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return m.User{}, ErrUserExists
+		}
+		logging.FromContext(ctx).Error("error inserting user", "err", err)
+		return m.User{}, err
+	}
+	return user, nil
+}
+
+// ✅ Fetch a User by ID
+func (s *PostgresStore) GetUser(ctx context.Context, id int) (m.User, error) {
+	query := `SELECT id, username, email, password_hash, roles, customer_id, disabled, created_at, updated_at
+	          FROM users WHERE id = $1`
+	return s.scanUser(ctx, s.DB.QueryRowContext(ctx, query, id))
+}
+
+// ✅ Fetch a User by (normalized) username
+func (s *PostgresStore) GetUserByUsername(ctx context.Context, username string) (m.User, error) {
+	query := `SELECT id, username, email, password_hash, roles, customer_id, disabled, created_at, updated_at
+	          FROM users WHERE username = $1`
+	return s.scanUser(ctx, s.DB.QueryRowContext(ctx, query, NormalizeUsername(username)))
+}
+
+func (s *PostgresStore) scanUser(ctx context.Context, row *sql.Row) (m.User, error) {
+	var user m.User
+	var roles pq.StringArray
+	var customerID sql.NullInt64
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &roles, &customerID, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logging.FromContext(ctx).Error("error retrieving user", "err", err)
+		}
+		return m.User{}, err
+	}
+	user.Roles = roles
+	user.CustomerID = int(customerID.Int64)
+	return user, nil
+}
+
+// ✅ Update a User's email and password hash
+func (s *PostgresStore) UpdateUser(ctx context.Context, id int, user m.User) error {
+	query := `UPDATE users SET email = $1, password_hash = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`
+	res, err := s.DB.ExecContext(ctx, query, NormalizeEmail(user.Email), user.PasswordHash, id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrUserExists
+		}
+		logging.FromContext(ctx).Error("error updating user", "err", err)
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// ✅ Replace only the password hash (used for rehash-on-login)
+func (s *PostgresStore) UpdateUserPassword(ctx context.Context, id int, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	res, err := s.DB.ExecContext(ctx, query, passwordHash, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("error updating user password", "err", err)
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// ✅ Replace a User's roles and linked customer record
+func (s *PostgresStore) SetUserRoles(ctx context.Context, id int, roles []string, customerID int) error {
+	query := `UPDATE users SET roles = $1, customer_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`
+	res, err := s.DB.ExecContext(ctx, query, pq.StringArray(roles), nullableID(customerID), id)
+	if err != nil {
+		logging.FromContext(ctx).Error("error updating user roles", "err", err)
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// ✅ Disable a User so they can no longer log in
+func (s *PostgresStore) DisableUser(ctx context.Context, id int) error {
+	query := `UPDATE users SET disabled = true, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	res, err := s.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("error disabling user", "err", err)
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// expectOneRow turns an UPDATE that matched nothing into sql.ErrNoRows.
+func expectOneRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// nullableID maps the zero ID to SQL NULL for optional foreign keys.
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
@@ -0,0 +1,40 @@
+package stores
+
+import (
+	"context"
+	"testing"
+
+	m "project.com/myproject/models"
+)
+
+func TestCreateUser(t *testing.T) {
+	user := m.User{
+		Username:     "  TestUser  ",
+		Email:        "TestUser@Example.com",
+		PasswordHash: "$2a$12$placeholderplaceholderplaceholderplaceholderplace",
+	}
+
+	createdUser, err := store.CreateUser(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if createdUser.Username != "testuser" {
+		t.Fatalf("Expected normalized username testuser, got %s", createdUser.Username)
+	}
+
+	_, err = store.CreateUser(context.Background(), m.User{
+		Username:     "another_user",
+		Email:        "testuser@example.com",
+		PasswordHash: user.PasswordHash,
+	})
+	if err != ErrUserExists {
+		t.Fatalf("Expected ErrUserExists for duplicate email, got %v", err)
+	}
+}
+
+func TestGetUserByUsername_NotFound(t *testing.T) {
+	_, err := store.GetUserByUsername(context.Background(), "no_such_user")
+	if err == nil {
+		t.Fatalf("Expected error for non-existent user, got nil")
+	}
+}
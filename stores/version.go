@@ -0,0 +1,46 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"project.com/myproject/internal/apperr"
+)
+
+// ErrVersionMismatch is returned when a record has changed since the caller
+// read the version it passed in.
+var ErrVersionMismatch = apperr.New(apperr.KindPreconditionFailed, "version_mismatch",
+	"The record was changed by another request")
+
+// versionMatches is the WHERE condition guarding a write with the version
+// in parameter n; version 0 always matches.
+func versionMatches(n int) string {
+	param := "$" + strconv.Itoa(n)
+	return "(" + param + " = 0 OR version = " + param + ")"
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	execer
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// expectVersion checks the result of a write of the row of table guarded by
+// versionMatches. If no row was written, it tells a missing row
+// (sql.ErrNoRows) from one with another version.
+func expectVersion(ctx context.Context, db querier, res sql.Result, table string, id int) error {
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+	var exists bool
+	err = db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM "+table+" WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return ErrVersionMismatch
+}